@@ -0,0 +1,240 @@
+package archive
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// creatorUnix is the "version made by" host for Unix in the ZIP spec; only
+// entries written with it carry meaningful permission bits.
+const creatorUnix = 3
+
+// unixOwnerExtraID is the Info-ZIP "new Unix" extra field holding uid/gid.
+const unixOwnerExtraID = 0x7875
+
+// maxSymlinkTarget bounds how much of a symlink entry is read.
+const maxSymlinkTarget = 4096
+
+// appendOwnerExtra adds the Info-ZIP uid/gid extra field for info, if the
+// platform reports an owner.
+func appendOwnerExtra(extra []byte, info fs.FileInfo) []byte {
+	uid, gid, ok := fileOwner(info)
+	if !ok {
+		return extra
+	}
+	var field [4 + 11]byte
+	binary.LittleEndian.PutUint16(field[0:2], unixOwnerExtraID)
+	binary.LittleEndian.PutUint16(field[2:4], 11)
+	field[4] = 1 // version
+	field[5] = 4
+	binary.LittleEndian.PutUint32(field[6:10], uint32(uid))
+	field[10] = 4
+	binary.LittleEndian.PutUint32(field[11:15], uint32(gid))
+	return append(extra, field[:]...)
+}
+
+// entryOwner returns the uid/gid recorded in an entry's extra fields.
+func entryOwner(f *zip.File) (uid, gid int, ok bool) {
+	extra := f.Extra
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra[0:2])
+		size := int(binary.LittleEndian.Uint16(extra[2:4]))
+		if len(extra) < 4+size {
+			return 0, 0, false
+		}
+		body := extra[4 : 4+size]
+		extra = extra[4+size:]
+		if id != unixOwnerExtraID || len(body) < 2 || body[0] != 1 {
+			continue
+		}
+		uid, body, ok = readOwnerID(body[1:])
+		if !ok {
+			return 0, 0, false
+		}
+		gid, _, ok = readOwnerID(body)
+		return uid, gid, ok
+	}
+	return 0, 0, false
+}
+
+// readOwnerID reads one size-prefixed little-endian id.
+func readOwnerID(b []byte) (int, []byte, bool) {
+	if len(b) < 1 {
+		return 0, nil, false
+	}
+	n := int(b[0])
+	if n == 0 || n > 8 || len(b) < 1+n {
+		return 0, nil, false
+	}
+	var id uint64
+	for i := n - 1; i >= 0; i-- {
+		id = id<<8 | uint64(b[1+i])
+	}
+	return int(id), b[1+n:], true
+}
+
+// entryPerm returns the permission bits of an entry written on Unix.
+func entryPerm(f *zip.File) (fs.FileMode, bool) {
+	if f.CreatorVersion>>8 != creatorUnix {
+		return 0, false
+	}
+	return f.Mode().Perm(), true
+}
+
+// isSymlink reports whether an entry is a stored symlink.
+func isSymlink(f *zip.File) bool {
+	return f.Mode()&fs.ModeSymlink != 0
+}
+
+// extractSymlink recreates a symlink entry at destPath. A link whose
+// parent directory is reached through a symlink is refused with an error.
+// A link whose target is absolute, leads outside root or passes through
+// another symlink is not created; the reason is returned as skip, since
+// such links are common in real folders and losing one should not abort
+// the restore. The target is resolved from the real parent directory, and
+// traversed collects the directories earlier targets pass through so that
+// no later link can be created at one of them; together this makes every
+// link resolve where the check expects.
+func extractSymlink(f *zip.File, root, destPath string, traversed map[string]bool) (skip, err error) {
+	raw, err := readSymlinkTarget(f)
+	if err != nil {
+		return nil, err
+	}
+	unsafe := func(format string, args ...any) error {
+		return &ExtractError{Name: f.Name, Err: ErrUnsafePath, Detail: fmt.Sprintf(format, args...)}
+	}
+
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return nil, err
+	}
+	parent := filepath.Dir(destPath)
+	realParent, err := filepath.EvalSymlinks(parent)
+	if err != nil {
+		return nil, err
+	}
+	relParent, err := filepath.Rel(root, parent)
+	if err != nil || realParent != filepath.Join(realRoot, relParent) {
+		return nil, unsafe("parent directory is a symlink")
+	}
+
+	target := filepath.FromSlash(raw)
+	if filepath.IsAbs(target) {
+		return unsafe("symlink target %q is absolute", raw), nil
+	}
+	var through []string
+	cur := realParent
+	parts := strings.Split(target, string(filepath.Separator))
+	for i, part := range parts {
+		if part == "" || part == "." {
+			continue
+		}
+		cur = filepath.Join(cur, part)
+		if i == len(parts)-1 || part == ".." {
+			continue
+		}
+		if fi, err := os.Lstat(cur); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+			return unsafe("symlink target %q passes through another symlink", raw), nil
+		}
+		through = append(through, cur)
+	}
+	if !withinDir(realRoot, cur) {
+		return unsafe("symlink target %q escapes the output directory", raw), nil
+	}
+	realDest := filepath.Join(realParent, filepath.Base(destPath))
+	if traversed[realDest] {
+		return unsafe("another symlink's target passes through it"), nil
+	}
+	for _, dir := range through {
+		traversed[dir] = true
+	}
+
+	tmp := destPath + ".tmp"
+	if err := removeLeaf(tmp); err != nil {
+		return nil, err
+	}
+	if err := os.Symlink(target, tmp); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp, destPath); err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+	return nil, nil
+}
+
+// removeLeaf removes whatever is at path unless it is a directory,
+// without following a symlink.
+func removeLeaf(path string) error {
+	fi, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return fmt.Errorf("%s is a directory", path)
+	}
+	return os.Remove(path)
+}
+
+// readSymlinkTarget returns the slash-separated target stored in a symlink
+// entry.
+func readSymlinkTarget(f *zip.File) (string, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	raw, err := io.ReadAll(io.LimitReader(rc, maxSymlinkTarget+1))
+	rc.Close()
+	if err != nil {
+		return "", err
+	}
+	if len(raw) > maxSymlinkTarget {
+		return "", &ExtractError{Name: f.Name, Err: ErrUnsafePath, Detail: "symlink target too long"}
+	}
+	return string(raw), nil
+}
+
+// restoreAttrs applies the recorded permissions and, if requested, owner
+// and modification time of an entry to path. Symlinks only get their owner
+// restored; their mode and times are not portable.
+func restoreAttrs(f *zip.File, path string, opts UnzipOptions) error {
+	if opts.RestoreOwner {
+		if uid, gid, ok := entryOwner(f); ok {
+			if err := os.Lchown(path, uid, gid); err != nil {
+				return fmt.Errorf("restoring owner of %s: %w", f.Name, err)
+			}
+		}
+	}
+	if isSymlink(f) {
+		return nil
+	}
+	// Chmod and Chtimes follow symlinks.
+	if fi, err := os.Lstat(path); err != nil {
+		return err
+	} else if fi.Mode()&os.ModeSymlink != 0 {
+		return &ExtractError{Name: f.Name, Err: ErrUnsafePath, Detail: "replaced by a symlink"}
+	}
+	if perm, ok := entryPerm(f); ok {
+		if err := os.Chmod(path, perm); err != nil {
+			return err
+		}
+	}
+	if opts.RestoreTimes && !f.Modified.IsZero() {
+		mtime := f.Modified.In(time.Local)
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
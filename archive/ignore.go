@@ -0,0 +1,169 @@
+package archive
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// IgnoreFileName is read from the root of every folder being archived.
+const IgnoreFileName = ".ecryptignore"
+
+// ignoreRule is one gitignore-style pattern.
+type ignoreRule struct {
+	segments []string // pattern split on "/"
+	negate   bool     // "!pattern"
+	dirOnly  bool     // "pattern/"
+	anchored bool     // contains a slash, so it matches from the root
+}
+
+// parseIgnoreRule parses one line of gitignore syntax. It returns false for
+// blank lines and comments.
+func parseIgnoreRule(line string) (ignoreRule, bool, error) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false, nil
+	}
+
+	var r ignoreRule
+	if strings.HasPrefix(line, "!") {
+		r.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\`) {
+		line = line[1:] // "\#" and "\!" escape the first character
+	}
+	if strings.HasSuffix(line, "/") {
+		r.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if strings.Contains(line, "/") {
+		r.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return ignoreRule{}, false, nil
+	}
+	if _, err := path.Match(line, ""); err != nil {
+		return ignoreRule{}, false, &PatternError{Pattern: line, Err: err}
+	}
+	r.segments = strings.Split(line, "/")
+	return r, true, nil
+}
+
+// match reports whether the rule matches rel (slash-separated, relative to
+// the root). isDir tells whether rel is a directory.
+func (r ignoreRule) match(rel string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	if r.anchored {
+		return matchSegments(r.segments, strings.Split(rel, "/"))
+	}
+	return matchSegments(r.segments, []string{path.Base(rel)})
+}
+
+// ignoreRules is an ordered rule list where the last matching rule wins.
+type ignoreRules []ignoreRule
+
+// add parses and appends patterns.
+func (rs *ignoreRules) add(patterns ...string) error {
+	for _, p := range patterns {
+		r, ok, err := parseIgnoreRule(p)
+		if err != nil {
+			return err
+		}
+		if ok {
+			*rs = append(*rs, r)
+		}
+	}
+	return nil
+}
+
+// matches reports whether the last rule matching rel is a positive one.
+func (rs ignoreRules) matches(rel string, isDir bool) bool {
+	matched := false
+	for _, r := range rs {
+		if r.match(rel, isDir) {
+			matched = !r.negate
+		}
+	}
+	return matched
+}
+
+// PathFilter decides which files of a folder are archived. Exclude rules
+// (from .ecryptignore and then the command line) use gitignore semantics:
+// the last matching pattern wins and "!pattern" re-includes. When Include
+// rules are present, only files matching one of them, or lying under a
+// matching directory, are archived.
+type PathFilter struct {
+	include ignoreRules
+	exclude ignoreRules
+}
+
+// NewPathFilter builds a filter for root from the .ecryptignore file in
+// root (if any) followed by the given exclude patterns, plus the given
+// include patterns.
+func NewPathFilter(root string, include, exclude []string) (*PathFilter, error) {
+	pf := &PathFilter{}
+
+	lines, err := readIgnoreFile(filepath.Join(root, IgnoreFileName))
+	if err != nil {
+		return nil, err
+	}
+	if err := pf.exclude.add(lines...); err != nil {
+		return nil, err
+	}
+	if err := pf.exclude.add(exclude...); err != nil {
+		return nil, err
+	}
+	if err := pf.include.add(include...); err != nil {
+		return nil, err
+	}
+	return pf, nil
+}
+
+// readIgnoreFile returns the lines of an ignore file, or nothing if it
+// does not exist.
+func readIgnoreFile(name string) ([]string, error) {
+	f, err := os.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		lines = append(lines, sc.Text())
+	}
+	return lines, sc.Err()
+}
+
+// Excluded reports whether rel is excluded. Excluded directories are not
+// descended into.
+func (pf *PathFilter) Excluded(rel string, isDir bool) bool {
+	return pf != nil && pf.exclude.matches(rel, isDir)
+}
+
+// Included reports whether rel passes the include rules, either directly
+// or through one of its parent directories.
+func (pf *PathFilter) Included(rel string, isDir bool) bool {
+	if pf == nil || len(pf.include) == 0 {
+		return true
+	}
+	if pf.include.matches(rel, isDir) {
+		return true
+	}
+	for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+		if pf.include.matches(dir, true) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,233 @@
+package archive
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseIgnoreRule(t *testing.T) {
+	tests := []struct {
+		line string
+		ok   bool
+		want ignoreRule
+	}{
+		{"", false, ignoreRule{}},
+		{"   ", false, ignoreRule{}},
+		{"# comment", false, ignoreRule{}},
+		{"*.log", true, ignoreRule{segments: []string{"*.log"}}},
+		{"*.log  ", true, ignoreRule{segments: []string{"*.log"}}},
+		{"!keep.log", true, ignoreRule{segments: []string{"keep.log"}, negate: true}},
+		{`\#notes`, true, ignoreRule{segments: []string{"#notes"}}},
+		{`\!important`, true, ignoreRule{segments: []string{"!important"}}},
+		{"build/", true, ignoreRule{segments: []string{"build"}, dirOnly: true}},
+		{"/build", true, ignoreRule{segments: []string{"build"}, anchored: true}},
+		{"doc/*.txt", true, ignoreRule{segments: []string{"doc", "*.txt"}, anchored: true}},
+		{"!/out/", true, ignoreRule{segments: []string{"out"}, negate: true, dirOnly: true, anchored: true}},
+		{"**/tmp", true, ignoreRule{segments: []string{"**", "tmp"}, anchored: true}},
+		{"/", false, ignoreRule{}},
+	}
+	for _, tt := range tests {
+		r, ok, err := parseIgnoreRule(tt.line)
+		if err != nil {
+			t.Errorf("%q: %v", tt.line, err)
+			continue
+		}
+		if ok != tt.ok || !equalRules(r, tt.want) {
+			t.Errorf("%q = %+v, %v; want %+v, %v", tt.line, r, ok, tt.want, tt.ok)
+		}
+	}
+
+	var pe *PatternError
+	if _, _, err := parseIgnoreRule("[abc"); !errors.As(err, &pe) {
+		t.Errorf("malformed pattern: err = %v, want a PatternError", err)
+	}
+}
+
+func equalRules(a, b ignoreRule) bool {
+	if a.negate != b.negate || a.dirOnly != b.dirOnly || a.anchored != b.anchored || len(a.segments) != len(b.segments) {
+		return false
+	}
+	for i := range a.segments {
+		if a.segments[i] != b.segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestPathFilter(t *testing.T) {
+	type check struct {
+		rel   string
+		isDir bool
+		want  bool
+	}
+	tests := []struct {
+		name     string
+		ignore   string // .ecryptignore contents
+		include  []string
+		exclude  []string
+		excluded []check
+		included []check
+	}{
+		{
+			name:    "negation",
+			exclude: []string{"*.log", "!keep.log"},
+			excluded: []check{
+				{"a.log", false, true},
+				{"sub/b.log", false, true},
+				{"keep.log", false, false},
+				{"sub/keep.log", false, false},
+				{"a.txt", false, false},
+			},
+		},
+		{
+			name:    "last match wins",
+			exclude: []string{"!keep.log", "*.log"},
+			excluded: []check{
+				{"keep.log", false, true},
+			},
+		},
+		{
+			name:    "ignore file then command line",
+			ignore:  "# build output\n*.o\n\ndebug/\n",
+			exclude: []string{"!main.o"},
+			excluded: []check{
+				{"x.o", false, true},
+				{"main.o", false, false},
+				{"debug", true, true},
+				{"src/debug", true, true},
+			},
+		},
+		{
+			name:    "dir only",
+			exclude: []string{"build/"},
+			excluded: []check{
+				{"build", true, true},
+				{"src/build", true, true},
+				{"build", false, false},
+				{"src/build", false, false},
+			},
+		},
+		{
+			name:    "anchored",
+			exclude: []string{"/build", "doc/*.txt"},
+			excluded: []check{
+				{"build", true, true},
+				{"build", false, true},
+				{"src/build", true, false},
+				{"doc/a.txt", false, true},
+				{"x/doc/a.txt", false, false},
+				{"doc/sub/a.txt", false, false},
+			},
+		},
+		{
+			name:    "double star",
+			exclude: []string{"**/tmp", "logs/**", "a/**/z"},
+			excluded: []check{
+				{"tmp", true, true},
+				{"x/y/tmp", false, true},
+				{"logs/2024/app.log", false, true},
+				{"logs", true, true}, // "**" also matches no segments
+				{"a/z", false, true},
+				{"a/b/c/z", false, true},
+				{"b/a/z", false, false},
+			},
+		},
+		{
+			name:    "escapes",
+			exclude: []string{`\#notes`, `\!important`},
+			excluded: []check{
+				{"#notes", false, true},
+				{"!important", false, true},
+				{"important", false, false},
+				{"notes", false, false},
+			},
+		},
+		{
+			name:    "include through parents",
+			include: []string{"docs", "src/", "*.md"},
+			included: []check{
+				{"docs", true, true},
+				{"docs/a/b.txt", false, true},
+				{"src/cmd/main.go", false, true},
+				{"src", false, false},
+				{"README.md", false, true},
+				{"notes/todo.md", false, true},
+				{"notes/todo.txt", false, false},
+				{"other/docs.txt", false, false},
+			},
+		},
+		{
+			name:    "include with negation",
+			include: []string{"*.go", "!*_test.go"},
+			included: []check{
+				{"main.go", false, true},
+				{"cmd/run.go", false, true},
+				{"main_test.go", false, false},
+				{"cmd/run_test.go", false, false},
+			},
+		},
+		{
+			name: "no include rules",
+			included: []check{
+				{"anything", false, true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			if tt.ignore != "" {
+				if err := os.WriteFile(filepath.Join(root, IgnoreFileName), []byte(tt.ignore), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			pf, err := NewPathFilter(root, tt.include, tt.exclude)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, c := range tt.excluded {
+				if got := pf.Excluded(c.rel, c.isDir); got != c.want {
+					t.Errorf("Excluded(%q, dir=%v) = %v, want %v", c.rel, c.isDir, got, c.want)
+				}
+			}
+			for _, c := range tt.included {
+				if got := pf.Included(c.rel, c.isDir); got != c.want {
+					t.Errorf("Included(%q, dir=%v) = %v, want %v", c.rel, c.isDir, got, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"*.tmp", "c.tmp", true},
+		{"*.tmp", "a/b/c.tmp", true},
+		{"*.tmp", "a/b.tmp/c", false},
+		{"a/*", "a/b", true},
+		{"a/*", "a/b/c", false},
+		{"a/*", "x/a/b", false},
+		{"/docs/*", "docs/a", true},
+		{"docs/", "docs", true},
+		{"**", "a/b/c", true},
+		{"docs/**", "docs/a/b", true},
+		{"docs/**/*.pdf", "docs/x.pdf", true},
+		{"docs/**/*.pdf", "docs/a/b/x.pdf", true},
+		{"docs/**/*.pdf", "other/docs/x.pdf", false},
+		{"**/*.pdf", "x.pdf", true},
+		{"a/**/**/b", "a/b", true},
+		{"a/**/b", "a/x/c", false},
+		{"[", "[", false},
+	}
+	for _, tt := range tests {
+		if got := MatchPattern(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("MatchPattern(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
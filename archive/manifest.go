@@ -1,14 +1,52 @@
 package archive
 
-// Manifest placeholder for future chunked encryption support.
-// Currently unused; kept for plan alignment.
+import (
+	"archive/zip"
+	"io"
+)
+
+// Manifest lists the members of an archive without extracting them.
 type Manifest struct {
-    Version int
-    Files   []FileEntry
+	Version int         `json:"version"`
+	Files   []FileEntry `json:"files"`
 }
 
+// FileEntry describes one archive member. Mtime is in Unix seconds
+// (0 when unknown).
 type FileEntry struct {
-    Name  string
-    Size  int64
-    Mtime int64
-}
\ No newline at end of file
+	Name  string `json:"name"`
+	Size  int64  `json:"size"`
+	Mtime int64  `json:"mtime"`
+}
+
+// TotalSize returns the sum of all member sizes.
+func (m *Manifest) TotalSize() int64 {
+	var total int64
+	for _, f := range m.Files {
+		total += f.Size
+	}
+	return total
+}
+
+// ReadManifest reads the ZIP central directory through r. Only the end of
+// the archive is read, so listing a large archive is cheap. If r does not
+// contain a ZIP archive, the returned error wraps zip.ErrFormat.
+func ReadManifest(r io.ReaderAt, size int64) (*Manifest, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manifest{Files: make([]FileEntry, 0, len(zr.File))}
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		entry := FileEntry{Name: f.Name, Size: int64(f.UncompressedSize64)}
+		if !f.Modified.IsZero() {
+			entry.Mtime = f.Modified.Unix()
+		}
+		m.Files = append(m.Files, entry)
+	}
+	return m, nil
+}
@@ -0,0 +1,6 @@
+//go:build !unix
+
+package archive
+
+// oNoFollow is not available here; O_EXCL alone refuses existing symlinks.
+const oNoFollow = 0
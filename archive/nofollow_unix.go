@@ -0,0 +1,8 @@
+//go:build unix
+
+package archive
+
+import "syscall"
+
+// oNoFollow makes OpenFile fail instead of following a symlink.
+const oNoFollow = syscall.O_NOFOLLOW
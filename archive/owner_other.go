@@ -0,0 +1,10 @@
+//go:build !unix
+
+package archive
+
+import "io/fs"
+
+// fileOwner reports no owner on platforms without Unix uids.
+func fileOwner(info fs.FileInfo) (uid, gid int, ok bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,108 @@
+package archive
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Filter selects archive members by slash-separated path. A member is
+// selected when it matches at least one Include pattern (or Include is
+// empty) and no Exclude pattern.
+//
+// Patterns use path.Match syntax per segment, plus "**" which matches any
+// number of segments. A pattern without a slash matches the base name at
+// any depth, so "*.tmp" matches "a/b/c.tmp".
+type Filter struct {
+	Include []string
+	Exclude []string
+}
+
+// Validate reports the first malformed pattern.
+func (f *Filter) Validate() error {
+	for _, p := range append(append([]string{}, f.Include...), f.Exclude...) {
+		if _, err := path.Match(p, ""); err != nil {
+			return &PatternError{Pattern: p, Err: err}
+		}
+	}
+	return nil
+}
+
+// Empty reports whether the filter selects every member.
+func (f *Filter) Empty() bool {
+	return f == nil || (len(f.Include) == 0 && len(f.Exclude) == 0)
+}
+
+// Match reports whether name is selected by the filter. A nil filter
+// selects everything.
+func (f *Filter) Match(name string) bool {
+	if f == nil {
+		return true
+	}
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if len(f.Include) > 0 && !matchAny(f.Include, name) {
+		return false
+	}
+	return !matchAny(f.Exclude, name)
+}
+
+// PatternError describes a malformed include or exclude pattern.
+type PatternError struct {
+	Pattern string
+	Err     error
+}
+
+func (e *PatternError) Error() string {
+	return fmt.Sprintf("invalid pattern %q: %v", e.Pattern, e.Err)
+}
+
+func (e *PatternError) Unwrap() error {
+	return e.Err
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if MatchPattern(p, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchPattern reports whether the slash-separated name matches pattern.
+// See Filter for the pattern syntax.
+func MatchPattern(pattern, name string) bool {
+	pattern = strings.Trim(pattern, "/")
+	if !strings.Contains(pattern, "/") && pattern != "**" {
+		return matchSegments([]string{pattern}, []string{path.Base(name)})
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// Collapse repeated "**" and try every possible split point.
+			for len(pattern) > 0 && pattern[0] == "**" {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
@@ -0,0 +1,177 @@
+package archive
+
+import (
+	"io"
+	"time"
+)
+
+// Phase is the stage of an operation a progress report refers to.
+type Phase string
+
+// Operation phases.
+const (
+	PhaseScanning    Phase = "scanning"    // counting the files to archive
+	PhaseCompressing Phase = "compressing" // archiving, compressing and encrypting a folder
+	PhaseEncrypting  Phase = "encrypting"  // encrypting a single file
+	PhaseDecrypting  Phase = "decrypting"  // decrypting a single file
+	PhaseExtracting  Phase = "extracting"  // decrypting and extracting archive members
+	PhaseWriting     Phase = "writing"     // writing the archive index and finishing the output
+)
+
+// Progress is a snapshot of an operation's progress. Bytes count the
+// plaintext read (when encrypting) or written (when decrypting); totals
+// are zero while unknown.
+type Progress struct {
+	Phase      Phase
+	File       string // file being processed, empty between files
+	FilesDone  int
+	FilesTotal int
+	BytesDone  int64
+	BytesTotal int64
+}
+
+// Percent returns how far the operation has got, by bytes when the total
+// is known and by files otherwise.
+func (p Progress) Percent() int {
+	percent := 0
+	switch {
+	case p.BytesTotal > 0:
+		percent = int(p.BytesDone * 100 / p.BytesTotal)
+	case p.FilesTotal > 0:
+		percent = p.FilesDone * 100 / p.FilesTotal
+	}
+	return min(percent, 100)
+}
+
+// Rate returns the average throughput in bytes per second after elapsed.
+func (p Progress) Rate(elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(p.BytesDone) / elapsed.Seconds()
+}
+
+// ETA estimates the time left from the average throughput so far. ok is
+// false until there is something to estimate from.
+func (p Progress) ETA(elapsed time.Duration) (eta time.Duration, ok bool) {
+	rate := p.Rate(elapsed)
+	if p.BytesTotal <= 0 || rate <= 0 {
+		return 0, false
+	}
+	left := max(p.BytesTotal-p.BytesDone, 0)
+	return time.Duration(float64(left) / rate * float64(time.Second)), true
+}
+
+// ProgressFunc receives progress reports. It is called from the goroutine
+// doing the work, so it should return quickly.
+type ProgressFunc func(Progress)
+
+// progressFunc adapts a per-file callback to a ProgressFunc that calls it
+// once as each file starts.
+func (cb ProgressCallback) progressFunc() ProgressFunc {
+	if cb == nil {
+		return nil
+	}
+	var last string
+	return func(p Progress) {
+		if p.File != "" && p.File != last {
+			last = p.File
+			cb(p.File)
+		}
+	}
+}
+
+// meterStep is how many bytes may pass between two reports within a file.
+const meterStep = 256 << 10
+
+// Meter accumulates progress and reports it to a ProgressFunc: on every
+// phase and file change, and within a file every meterStep bytes. A Meter
+// with a nil ProgressFunc only counts.
+type Meter struct {
+	fn   ProgressFunc
+	p    Progress
+	last int64 // BytesDone at the last report
+}
+
+// NewMeter returns a Meter reporting to fn.
+func NewMeter(fn ProgressFunc) *Meter {
+	return &Meter{fn: fn}
+}
+
+// Progress returns the current progress.
+func (m *Meter) Progress() Progress {
+	return m.p
+}
+
+func (m *Meter) report() {
+	m.last = m.p.BytesDone
+	if m.fn != nil {
+		m.fn(m.p)
+	}
+}
+
+// SetPhase starts a new phase.
+func (m *Meter) SetPhase(phase Phase) {
+	m.p.Phase = phase
+	m.report()
+}
+
+// SetTotals records how many files and bytes the operation will process.
+func (m *Meter) SetTotals(files int, bytes int64) {
+	m.p.FilesTotal = files
+	m.p.BytesTotal = bytes
+	m.report()
+}
+
+// StartFile reports that work on the named file has begun.
+func (m *Meter) StartFile(name string) {
+	m.p.File = name
+	m.report()
+}
+
+// FinishFile counts the current file as done.
+func (m *Meter) FinishFile() {
+	m.p.File = ""
+	m.p.FilesDone++
+	m.report()
+}
+
+// Add counts n more bytes.
+func (m *Meter) Add(n int64) {
+	m.p.BytesDone += n
+	if m.p.BytesDone-m.last >= meterStep {
+		m.report()
+	}
+}
+
+// Reader returns r counting the bytes read through it.
+func (m *Meter) Reader(r io.Reader) io.Reader {
+	return meterReader{r, m}
+}
+
+// Writer returns w counting the bytes written through it.
+func (m *Meter) Writer(w io.Writer) io.Writer {
+	return meterWriter{w, m}
+}
+
+type meterReader struct {
+	r io.Reader
+	m *Meter
+}
+
+func (r meterReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.m.Add(int64(n))
+	return n, err
+}
+
+type meterWriter struct {
+	w io.Writer
+	m *Meter
+}
+
+func (w meterWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.m.Add(int64(n))
+	return n, err
+}
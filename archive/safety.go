@@ -0,0 +1,172 @@
+package archive
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Errors wrapped by ExtractError.
+var (
+	// ErrUnsafePath means an entry would be written outside the output
+	// directory (absolute path, ".." traversal or a symlink escape).
+	ErrUnsafePath = errors.New("unsafe path")
+	// ErrLimitExceeded means an extraction limit was hit.
+	ErrLimitExceeded = errors.New("extraction limit exceeded")
+)
+
+// ExtractError reports why an archive entry was refused. Use errors.Is
+// with ErrUnsafePath or ErrLimitExceeded to tell the cases apart.
+type ExtractError struct {
+	Name   string // entry name as stored in the archive
+	Err    error  // ErrUnsafePath or ErrLimitExceeded
+	Detail string
+}
+
+func (e *ExtractError) Error() string {
+	if e.Name == "" {
+		return fmt.Sprintf("refusing to extract archive: %v: %s", e.Err, e.Detail)
+	}
+	return fmt.Sprintf("refusing to extract %q: %v: %s", e.Name, e.Err, e.Detail)
+}
+
+func (e *ExtractError) Unwrap() error {
+	return e.Err
+}
+
+// Limits caps what an extraction may write. A zero field means no limit.
+type Limits struct {
+	MaxTotalBytes int64 // sum of all extracted file sizes
+	MaxFileBytes  int64 // size of any single file
+	MaxEntries    int   // number of entries in the archive
+	MaxRatio      int64 // uncompressed/compressed size of any single file
+}
+
+// DefaultLimits returns the limits used when none are configured. They are
+// generous enough for real backups while stopping obvious archive bombs,
+// whose output is capped by the bytes actually written. There is no
+// compression ratio cap by default: sparse files, disk images and
+// zero-padded databases compress past 1000:1 and must still restore.
+func DefaultLimits() Limits {
+	return Limits{
+		MaxTotalBytes: 1 << 40,  // 1 TiB
+		MaxFileBytes:  64 << 30, // 64 GiB
+		MaxEntries:    1 << 20,
+	}
+}
+
+// checkEntries validates the entry count and the declared sizes of the
+// selected entries before anything is written.
+func (l Limits) checkEntries(files []*zip.File, selected func(*zip.File) bool) error {
+	if l.MaxEntries > 0 && len(files) > l.MaxEntries {
+		return &ExtractError{Err: ErrLimitExceeded, Detail: fmt.Sprintf("%d entries (limit %d)", len(files), l.MaxEntries)}
+	}
+
+	var total uint64
+	for _, f := range files {
+		if !selected(f) {
+			continue
+		}
+		size := f.UncompressedSize64
+		if l.MaxFileBytes > 0 && size > uint64(l.MaxFileBytes) {
+			return &ExtractError{Name: f.Name, Err: ErrLimitExceeded, Detail: fmt.Sprintf("%d bytes (per-file limit %d)", size, l.MaxFileBytes)}
+		}
+		// A declared compressed size of 0 gives no ratio to check; the
+		// bytes written are still capped by limitedCopy.
+		if l.MaxRatio > 0 && f.CompressedSize64 > 0 && size/f.CompressedSize64 > uint64(l.MaxRatio) {
+			return &ExtractError{Name: f.Name, Err: ErrLimitExceeded, Detail: fmt.Sprintf("compression ratio exceeds %d:1", l.MaxRatio)}
+		}
+		total += size
+		if l.MaxTotalBytes > 0 && total > uint64(l.MaxTotalBytes) {
+			return &ExtractError{Err: ErrLimitExceeded, Detail: fmt.Sprintf("more than %d bytes in total", l.MaxTotalBytes)}
+		}
+	}
+	return nil
+}
+
+// limitedCopy copies one entry to w, enforcing the per-file and remaining
+// total limits on the bytes actually produced rather than the sizes the
+// archive claims. It returns the number of bytes written.
+func (l Limits) limitedCopy(w io.Writer, r io.Reader, name string, written int64) (int64, error) {
+	max := int64(-1)
+	if l.MaxFileBytes > 0 {
+		max = l.MaxFileBytes
+	}
+	if l.MaxTotalBytes > 0 {
+		if remaining := l.MaxTotalBytes - written; max < 0 || remaining < max {
+			max = remaining
+		}
+	}
+	if max < 0 {
+		return io.Copy(w, r)
+	}
+
+	n, err := io.Copy(w, io.LimitReader(r, max+1))
+	if err != nil {
+		return n, err
+	}
+	if n > max {
+		return n, &ExtractError{Name: name, Err: ErrLimitExceeded, Detail: "entry is larger than allowed"}
+	}
+	return n, nil
+}
+
+// safeEntryPath returns the destination of entry name under root. It
+// rejects absolute paths, ".." traversal, and paths whose existing parent
+// directories include a symlink that leads outside root.
+func safeEntryPath(root, name string) (string, error) {
+	rel := filepath.FromSlash(name)
+	if strings.Contains(name, `\`) || !filepath.IsLocal(rel) {
+		return "", &ExtractError{Name: name, Err: ErrUnsafePath, Detail: "path is absolute or escapes the output directory"}
+	}
+	if err := checkSymlinkParents(root, rel); err != nil {
+		return "", &ExtractError{Name: name, Err: ErrUnsafePath, Detail: err.Error()}
+	}
+	return filepath.Join(root, rel), nil
+}
+
+// checkSymlinkParents walks the parent directories of rel below root and
+// fails if one of them is a symlink resolving outside root.
+func checkSymlinkParents(root, rel string) error {
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return err
+	}
+
+	cur := root
+	parts := strings.Split(filepath.Dir(rel), string(filepath.Separator))
+	for _, part := range parts {
+		if part == "." {
+			continue
+		}
+		cur = filepath.Join(cur, part)
+		fi, err := os.Lstat(cur)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil // the rest will be created as plain directories
+		}
+		if err != nil {
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+		target, err := filepath.EvalSymlinks(cur)
+		if err != nil {
+			return err
+		}
+		if !withinDir(realRoot, target) {
+			return fmt.Errorf("%s is a symlink outside the output directory", part)
+		}
+	}
+	return nil
+}
+
+// withinDir reports whether path is dir or lies below it.
+func withinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && filepath.IsLocal(rel)
+}
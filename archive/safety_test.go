@@ -0,0 +1,141 @@
+package archive
+
+import (
+	"archive/zip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUnzipLimits(t *testing.T) {
+	small := []testEntry{{name: "a", data: "hello"}, {name: "d/", data: ""}, {name: "d/b", data: "world"}}
+	tests := []struct {
+		name    string
+		entries []testEntry
+		limits  Limits
+		wantErr bool
+	}{
+		{"within limits", small, Limits{MaxTotalBytes: 10, MaxFileBytes: 5, MaxEntries: 3, MaxRatio: 10}, false},
+		{"no limits", small, Limits{}, false},
+		{"too many entries", small, Limits{MaxEntries: 2}, true},
+		{"file too large", small, Limits{MaxFileBytes: 4}, true},
+		{"total too large", small, Limits{MaxTotalBytes: 9}, true},
+		{"compression ratio", []testEntry{{name: "zeros", data: strings.Repeat("\x00", 1<<20)}}, Limits{MaxRatio: 100}, true},
+		{"compression ratio allowed", []testEntry{{name: "zeros", data: strings.Repeat("\x00", 1<<20)}}, Limits{MaxRatio: 1100}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := t.TempDir()
+			err := unzipEntries(t, out, tt.entries, UnzipOptions{Limits: &tt.limits})
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			var ee *ExtractError
+			if !errors.As(err, &ee) || !errors.Is(err, ErrLimitExceeded) {
+				t.Fatalf("error = %v, want an ExtractError wrapping ErrLimitExceeded", err)
+			}
+			// Declared sizes are checked before anything is written.
+			if names, _ := os.ReadDir(out); len(names) != 0 {
+				t.Errorf("refused archive left %d entries behind", len(names))
+			}
+		})
+	}
+}
+
+// Zero-filled files, such as sparse files and disk images, compress past
+// 1000:1 and must restore with the default limits.
+func TestUnzipZeroFilledDefaultLimits(t *testing.T) {
+	data := strings.Repeat("\x00", 32<<20)
+	out := t.TempDir()
+	if err := unzipEntries(t, out, []testEntry{{name: "disk.img", data: data}}, UnzipOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(filepath.Join(out, "disk.img"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != data {
+		t.Error("restored file differs")
+	}
+}
+
+// An entry declaring a compressed size of 0 has no ratio to check.
+func TestCheckEntriesZeroCompressedSize(t *testing.T) {
+	f := &zip.File{FileHeader: zip.FileHeader{Name: "f", UncompressedSize64: 100}}
+	l := Limits{MaxRatio: 10}
+	if err := l.checkEntries([]*zip.File{f}, func(*zip.File) bool { return true }); err != nil {
+		t.Error(err)
+	}
+}
+
+// limitedCopy enforces the limits on the bytes actually read, whatever the
+// archive declares.
+func TestLimitedCopy(t *testing.T) {
+	tests := []struct {
+		name    string
+		limits  Limits
+		size    int
+		written int64
+		wantErr bool
+	}{
+		{"no limits", Limits{}, 100, 0, false},
+		{"at the file limit", Limits{MaxFileBytes: 100}, 100, 0, false},
+		{"over the file limit", Limits{MaxFileBytes: 99}, 100, 0, true},
+		{"at the total limit", Limits{MaxTotalBytes: 150}, 100, 50, false},
+		{"over the total limit", Limits{MaxTotalBytes: 150}, 100, 51, true},
+		{"total tighter than file", Limits{MaxFileBytes: 1000, MaxTotalBytes: 150}, 100, 60, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := tt.limits.limitedCopy(io.Discard, strings.NewReader(strings.Repeat("x", tt.size)), "f", tt.written)
+			if tt.wantErr {
+				if !errors.Is(err, ErrLimitExceeded) {
+					t.Errorf("error = %v, want ErrLimitExceeded", err)
+				}
+				return
+			}
+			if err != nil || n != int64(tt.size) {
+				t.Errorf("copied %d bytes, err = %v; want %d, nil", n, err, tt.size)
+			}
+		})
+	}
+}
+
+func TestUnzipUnsafePaths(t *testing.T) {
+	for _, name := range []string{"../evil", "/etc/evil", "a/../../evil", `a\..\..\evil`, `C:\evil`, "a/./../../evil"} {
+		t.Run(name, func(t *testing.T) {
+			out := t.TempDir()
+			entries := []testEntry{{name: "ok", data: "fine"}, {name: name, data: "PWNED"}}
+			err := unzipEntries(t, out, entries, UnzipOptions{})
+			if !errors.Is(err, ErrUnsafePath) {
+				t.Fatalf("error = %v, want ErrUnsafePath", err)
+			}
+			// Paths are checked before anything is written.
+			if names, _ := os.ReadDir(out); len(names) != 0 {
+				t.Errorf("refused archive left %d entries behind", len(names))
+			}
+		})
+	}
+}
+
+// Unselected members count towards MaxEntries but not towards the size
+// limits, since they are never decompressed.
+func TestUnzipLimitsFiltered(t *testing.T) {
+	entries := []testEntry{{name: "keep", data: "small"}, {name: "skip", data: strings.Repeat("x", 1000)}}
+	filter := &Filter{Include: []string{"keep"}}
+	limits := Limits{MaxFileBytes: 10, MaxTotalBytes: 10}
+	if err := unzipEntries(t, t.TempDir(), entries, UnzipOptions{Filter: filter, Limits: &limits}); err != nil {
+		t.Fatal(err)
+	}
+	limits = Limits{MaxEntries: 1}
+	err := unzipEntries(t, t.TempDir(), entries, UnzipOptions{Filter: filter, Limits: &limits})
+	if !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("error = %v, want ErrLimitExceeded", err)
+	}
+}
@@ -0,0 +1,223 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+)
+
+// ZipStream writes a ZIP archive of files added one at a time, such as the
+// parts of an upload, when they cannot be walked like a folder.
+type ZipStream struct {
+	zw    *zip.Writer
+	m     *Meter
+	names map[string]bool
+}
+
+// NewZipStream starts a ZIP archive on w, reporting compressing progress
+// to progress if it is not nil. Totals are not known in advance.
+func NewZipStream(w io.Writer, progress ProgressFunc) *ZipStream {
+	m := NewMeter(progress)
+	m.SetPhase(PhaseCompressing)
+	return &ZipStream{zw: zip.NewWriter(w), m: m, names: make(map[string]bool)}
+}
+
+// Add archives the contents of r as a regular file. name is a
+// slash-separated path relative to the archive root; absolute paths, ".."
+// and duplicate names are refused with an error wrapping ErrUnsafePath.
+func (z *ZipStream) Add(name string, r io.Reader) error {
+	clean := path.Clean(strings.TrimPrefix(name, "./"))
+	if strings.Contains(name, `\`) || !fs.ValidPath(clean) || clean == "." {
+		return fmt.Errorf("%w: %q", ErrUnsafePath, name)
+	}
+	if z.names[clean] {
+		return fmt.Errorf("%w: duplicate file %q", ErrUnsafePath, clean)
+	}
+	z.names[clean] = true
+
+	hdr := &zip.FileHeader{Name: clean, Method: zip.Deflate, Modified: time.Now()}
+	hdr.SetMode(0o644)
+	w, err := z.zw.CreateHeader(hdr)
+	if err != nil {
+		return err
+	}
+	z.m.StartFile(clean)
+	if _, err := io.Copy(w, z.m.Reader(r)); err != nil {
+		return err
+	}
+	z.m.FinishFile()
+	return nil
+}
+
+// Close writes the archive index. It does not close the underlying writer.
+func (z *ZipStream) Close() error {
+	z.m.SetPhase(PhaseWriting)
+	return z.zw.Close()
+}
+
+// ZipToTar streams the ZIP archive in r to w as a tar archive, keeping
+// modes, modification times, owners and symlinks. Entry names are checked
+// as for extraction, and symlinks come last and are checked the way
+// UnzipWithOptions checks them, so the tar can be unpacked safely: links
+// whose target is absolute, leads outside the archive or passes through
+// another link are left out, and an archive with an entry below a link is
+// refused. If r does not contain a ZIP archive, the returned error wraps
+// zip.ErrFormat.
+func ZipToTar(w io.Writer, r io.ReaderAt, size int64, progress ProgressFunc) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+	linkNames := make(map[string]bool)
+	for _, f := range zr.File {
+		if name := strings.TrimSuffix(f.Name, "/"); strings.Contains(name, `\`) || !fs.ValidPath(name) {
+			return &ExtractError{Name: f.Name, Err: ErrUnsafePath, Detail: "path is absolute or escapes the output directory"}
+		}
+		if isSymlink(f) {
+			linkNames[f.Name] = true
+		}
+	}
+	for _, f := range zr.File {
+		for dir := path.Dir(strings.TrimSuffix(f.Name, "/")); dir != "."; dir = path.Dir(dir) {
+			if linkNames[dir] {
+				return &ExtractError{Name: f.Name, Err: ErrUnsafePath, Detail: "path passes through a symlink"}
+			}
+		}
+	}
+
+	m := NewMeter(progress)
+	m.SetPhase(PhaseExtracting)
+	if progress != nil {
+		var files int
+		var total int64
+		for _, f := range zr.File {
+			if f.Mode().IsRegular() && !isSymlink(f) {
+				files++
+				total += int64(f.UncompressedSize64)
+			}
+		}
+		m.SetTotals(files, total)
+	}
+
+	tw := tar.NewWriter(w)
+	var links []*zip.File
+	for _, f := range zr.File {
+		if isSymlink(f) {
+			links = append(links, f)
+			continue
+		}
+		hdr := tarHeader(f)
+		if f.FileInfo().IsDir() {
+			hdr.Typeflag = tar.TypeDir
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			continue
+		}
+		hdr.Typeflag = tar.TypeReg
+		hdr.Size = int64(f.UncompressedSize64)
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		m.StartFile(f.Name)
+		if err := copyMember(tw, f, m); err != nil {
+			return err
+		}
+		m.FinishFile()
+	}
+
+	tl := tarLinks{links: make(map[string]bool), traversed: make(map[string]bool)}
+	for _, f := range links {
+		target, err := readSymlinkTarget(f)
+		if err != nil {
+			return err
+		}
+		if !tl.add(f.Name, target) {
+			continue // skipped, as UnzipWithOptions does
+		}
+		hdr := tarHeader(f)
+		hdr.Typeflag = tar.TypeSymlink
+		hdr.Linkname = target
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+	}
+
+	m.SetPhase(PhaseWriting)
+	return tw.Close()
+}
+
+// tarHeader returns the tar header fields shared by every kind of entry.
+func tarHeader(f *zip.File) *tar.Header {
+	hdr := &tar.Header{
+		Name:    f.Name,
+		Mode:    int64(f.Mode().Perm()),
+		ModTime: f.Modified,
+		Format:  tar.FormatPAX,
+	}
+	if uid, gid, ok := entryOwner(f); ok {
+		hdr.Uid, hdr.Gid = uid, gid
+	}
+	return hdr
+}
+
+// tarLinks applies the checks extractSymlink makes on disk to the links of
+// a tar being written, where the links written so far exist only as
+// entries.
+type tarLinks struct {
+	links     map[string]bool // links written so far
+	traversed map[string]bool // directories their targets pass through
+}
+
+// add reports whether the link name -> target is safe to write after the
+// links already added, and records it if so.
+func (t *tarLinks) add(name, target string) bool {
+	if path.IsAbs(target) {
+		return false
+	}
+	var through []string
+	cur := path.Dir(name)
+	parts := strings.Split(target, "/")
+	for i, part := range parts {
+		if part == "" || part == "." {
+			continue
+		}
+		cur = path.Join(cur, part)
+		if cur == ".." || strings.HasPrefix(cur, "../") {
+			return false
+		}
+		if i == len(parts)-1 || part == ".." {
+			continue
+		}
+		if t.links[cur] {
+			return false
+		}
+		through = append(through, cur)
+	}
+	if t.traversed[name] {
+		return false
+	}
+	for _, dir := range through {
+		t.traversed[dir] = true
+	}
+	t.links[name] = true
+	return true
+}
+
+// copyMember writes the contents of f to w, counting the bytes in m. The
+// zip reader fails if the data does not match the recorded size.
+func copyMember(w io.Writer, f *zip.File, m *Meter) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	_, err = io.Copy(m.Writer(w), rc)
+	return err
+}
@@ -0,0 +1,115 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"slices"
+	"testing"
+)
+
+// tarEntries converts entries with ZipToTar and returns the names in the
+// tar, with symlinks as "name -> target".
+func tarEntries(t *testing.T, entries []testEntry) ([]string, error) {
+	t.Helper()
+	r := buildZip(t, entries)
+	var buf bytes.Buffer
+	if err := ZipToTar(&buf, r, r.Size(), nil); err != nil {
+		return nil, err
+	}
+	var names []string
+	tr := tar.NewReader(&buf)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return names, nil
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		name := hdr.Name
+		if hdr.Typeflag == tar.TypeSymlink {
+			name += " -> " + hdr.Linkname
+		}
+		names = append(names, name)
+	}
+}
+
+func TestZipToTarSymlinks(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []testEntry
+		want    []string // nil when the archive is refused
+	}{
+		{
+			name: "links come last",
+			entries: []testEntry{
+				{name: "link", target: "d/f"},
+				{name: "d/", data: ""},
+				{name: "d/f", data: "data"},
+				{name: "d/up", target: "../link"},
+			},
+			want: []string{"d/", "d/f", "link -> d/f", "d/up -> ../link"},
+		},
+		{
+			name: "escaping targets left out",
+			entries: []testEntry{
+				{name: "abs", target: "/etc/passwd"},
+				{name: "up", target: "../outside"},
+				{name: "d/up", target: "../../outside"},
+				{name: "ok", data: "data"},
+			},
+			want: []string{"ok"},
+		},
+		{
+			// z resolves through y, so it could point anywhere y does.
+			name: "target through a link",
+			entries: []testEntry{
+				{name: "y", target: "."},
+				{name: "z", target: "y/.."},
+			},
+			want: []string{"y -> ."},
+		},
+		{
+			name: "link at a directory another target passes through",
+			entries: []testEntry{
+				{name: "a", target: "d/x"},
+				{name: "d", target: "e"},
+			},
+			want: []string{"a -> d/x"},
+		},
+		{
+			name: "chain with an entry below a link",
+			entries: []testEntry{
+				{name: "y", target: "."},
+				{name: "z", target: "y/.."},
+				{name: "z/evil", data: "PWNED"},
+			},
+		},
+		{
+			name: "link below a link",
+			entries: []testEntry{
+				{name: "y", target: "."},
+				{name: "y/z", target: "x"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tarEntries(t, tt.entries)
+			if tt.want == nil {
+				if !errors.Is(err, ErrUnsafePath) {
+					t.Fatalf("error = %v, want ErrUnsafePath", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("tar holds %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
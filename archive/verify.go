@@ -0,0 +1,47 @@
+package archive
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// Verify checks the structure of a ZIP archive read through r: every
+// member is decompressed and its CRC-32 checked, and member names must be
+// safe to extract. Nothing is written. It returns the number of members.
+// If r does not contain a ZIP archive, the returned error wraps zip.ErrFormat.
+func Verify(r io.ReaderAt, size int64) (int, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, f := range zr.File {
+		if strings.Contains(f.Name, `\`) || !filepath.IsLocal(filepath.FromSlash(f.Name)) {
+			return 0, &ExtractError{Name: f.Name, Err: ErrUnsafePath, Detail: "path is absolute or escapes the output directory"}
+		}
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		if err := verifyMember(f); err != nil {
+			// %v, not %w: a damaged member must not look like "not a ZIP".
+			return 0, fmt.Errorf("%s: %v", f.Name, err)
+		}
+	}
+	return len(zr.File), nil
+}
+
+// verifyMember reads one member to the end, which makes archive/zip check
+// its CRC-32 and declared size.
+func verifyMember(f *zip.File) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	_, err = io.Copy(io.Discard, rc)
+	return err
+}
@@ -3,13 +3,18 @@ package archive
 import (
 	"archive/zip"
 	"bytes"
+	"errors"
+	"fmt"
 	"io"
 	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
 )
 
-// ProgressCallback is called for each file processed
+// ProgressCallback is called for each file processed. See ProgressFunc for
+// byte-level progress.
 type ProgressCallback func(filename string)
 
 // ZipFolder compresses a folder into a ZIP archive (bytes).
@@ -20,62 +25,163 @@ func ZipFolder(root string) ([]byte, error) {
 // ZipFolderWithProgress compresses a folder with progress reporting
 func ZipFolderWithProgress(root string, onProgress ProgressCallback) ([]byte, error) {
 	buf := &bytes.Buffer{}
-	zw := zip.NewWriter(buf)
-	defer zw.Close()
+	if err := ZipFolderTo(buf, root, onProgress); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
 
-	root = filepath.Clean(root)
-	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+// ZipOptions controls which files ZipFolderWithOptions archives and how
+// progress is reported.
+type ZipOptions struct {
+	// Include limits the archive to matching files (gitignore syntax).
+	Include []string
+	// Exclude skips matching files, after the rules in .ecryptignore.
+	Exclude []string
+	// Progress receives scanning, compressing and writing progress. When it
+	// is set the folder is walked twice, first to count the totals.
+	Progress ProgressFunc
+}
+
+// ZipFolderTo streams a ZIP archive of a folder to w without buffering
+// the archive in memory. A .ecryptignore file in root is honored.
+func ZipFolderTo(w io.Writer, root string, onProgress ProgressCallback) error {
+	return ZipFolderWithOptions(w, root, ZipOptions{Progress: onProgress.progressFunc()})
+}
+
+// ZipFolderWithOptions streams a ZIP archive of the files in root selected
+// by opts. Permission bits, directories (including empty ones),
+// modification times and Unix owners are recorded. Symlinks are stored as
+// links and never followed.
+func ZipFolderWithOptions(w io.Writer, root string, opts ZipOptions) error {
+	filter, err := NewPathFilter(root, opts.Include, opts.Exclude)
+	if err != nil {
+		return err
+	}
+
+	m := NewMeter(opts.Progress)
+	if opts.Progress != nil {
+		m.SetPhase(PhaseScanning)
+		var files int
+		var size int64
+		err := WalkFolder(root, filter, func(_, _ string, info fs.FileInfo) error {
+			if info.Mode().IsRegular() {
+				files++
+				size += info.Size()
+			}
+			return nil
+		})
 		if err != nil {
 			return err
 		}
-		if d.IsDir() {
-			return nil
-		}
+		m.SetTotals(files, size)
+	}
+	m.SetPhase(PhaseCompressing)
 
-		rel, err := filepath.Rel(root, path)
+	zw := zip.NewWriter(w)
+	err = WalkFolder(root, filter, func(path, rel string, info fs.FileInfo) error {
+		mode := info.Mode()
+
+		hdr, err := zip.FileInfoHeader(info)
 		if err != nil {
 			return err
 		}
+		hdr.Name = filepath.ToSlash(rel)
+		hdr.Extra = appendOwnerExtra(hdr.Extra, info)
 
-		// Report progress
-		if onProgress != nil {
-			onProgress(rel)
+		switch {
+		case mode.IsDir():
+			hdr.Name += "/"
+			_, err := zw.CreateHeader(hdr)
+			return err
+		case mode&fs.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			hdr.Method = zip.Store
+			w, err := zw.CreateHeader(hdr)
+			if err != nil {
+				return err
+			}
+			_, err = io.WriteString(w, filepath.ToSlash(target))
+			return err
 		}
 
-		info, err := d.Info()
+		m.StartFile(rel)
+		hdr.Method = zip.Deflate
+		w, err := zw.CreateHeader(hdr)
 		if err != nil {
 			return err
 		}
+		if err := copyFile(w, path, m); err != nil {
+			return err
+		}
+		m.FinishFile()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	m.SetPhase(PhaseWriting)
+	return zw.Close()
+}
 
-		hdr := &zip.FileHeader{
-			Name:   filepath.ToSlash(rel),
-			Method: zip.Deflate,
+// WalkFolder calls fn for every directory, regular file and symlink under
+// root that filter selects, in lexical order. Excluded directories are not
+// descended into; symlinks are not followed and other special files are
+// skipped. rel is relative to root using the OS separator.
+func WalkFolder(root string, filter *PathFilter, fn func(path, rel string, info fs.FileInfo) error) error {
+	root = filepath.Clean(root)
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
 		}
-		hdr.SetModTime(info.ModTime())
 
-		w, err := zw.CreateHeader(hdr)
+		rel, err := filepath.Rel(root, path)
 		if err != nil {
 			return err
 		}
+		if d.IsDir() && rel == "." {
+			return nil
+		}
+
+		slashRel := filepath.ToSlash(rel)
+		if filter.Excluded(slashRel, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !filter.Included(slashRel, d.IsDir()) {
+			return nil // directories are still searched for included files
+		}
 
-		f, err := os.Open(path)
+		info, err := d.Info()
 		if err != nil {
 			return err
 		}
-		defer f.Close()
+		mode := info.Mode()
+		if !mode.IsRegular() && !mode.IsDir() && mode&fs.ModeSymlink == 0 {
+			return nil
+		}
 
-		_, err = io.Copy(w, f)
-		return err
+		return fn(path, rel, info)
 	})
+}
+
+// copyFile copies the contents of the file at path to w, counting the
+// bytes read in m.
+func copyFile(w io.Writer, path string, m *Meter) error {
+	f, err := os.Open(path)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	defer f.Close()
 
-    if err := zw.Close(); err != nil {
-        return nil, err
-    }
-
-    return buf.Bytes(), nil
+	_, err = io.Copy(w, m.Reader(f))
+	return err
 }
 
 // UnzipTo extracts a ZIP archive (bytes) to a target folder.
@@ -85,58 +191,216 @@ func UnzipTo(outDir string, zipBytes []byte) error {
 
 // UnzipToWithProgress extracts a ZIP archive with progress reporting
 func UnzipToWithProgress(outDir string, zipBytes []byte, onProgress ProgressCallback) error {
-	readerAt := bytes.NewReader(zipBytes)
-	zr, err := zip.NewReader(readerAt, int64(len(zipBytes)))
+	return UnzipReaderAt(outDir, bytes.NewReader(zipBytes), int64(len(zipBytes)), onProgress)
+}
+
+// UnzipOptions controls which members are extracted, the limits applied
+// and how progress is reported.
+type UnzipOptions struct {
+	// Filter selects the members to extract; nil extracts everything.
+	Filter *Filter
+	// Limits caps the extraction; nil uses DefaultLimits.
+	Limits *Limits
+	// Progress receives extraction progress; totals come from the sizes
+	// recorded in the archive.
+	Progress ProgressFunc
+	// RestoreOwner applies the recorded uid/gid (usually requires root).
+	RestoreOwner bool
+	// RestoreTimes applies the recorded modification times.
+	RestoreTimes bool
+	// OnSkip is called for each symlink that is not created because its
+	// target is absolute, leads outside the output directory or passes
+	// through another symlink; err says why. Such links are skipped
+	// silently when it is nil.
+	OnSkip func(name string, err error)
+}
+
+// UnzipReaderAt extracts a ZIP archive read through r, which lets callers
+// extract from a decrypting reader without holding the archive in memory.
+// If r does not contain a ZIP archive, the returned error wraps zip.ErrFormat.
+func UnzipReaderAt(outDir string, r io.ReaderAt, size int64, onProgress ProgressCallback) error {
+	return UnzipWithOptions(outDir, r, size, UnzipOptions{Progress: onProgress.progressFunc()})
+}
+
+// UnzipWithOptions is like UnzipReaderAt but only extracts the members
+// selected by opts.Filter. Unselected members are never decompressed.
+//
+// Every selected entry is checked before anything is written: entries that
+// would land outside outDir and archives exceeding opts.Limits are refused
+// with an *ExtractError. Sizes are enforced again while writing, so an
+// archive that lies about its sizes cannot get past the limits.
+func UnzipWithOptions(outDir string, r io.ReaderAt, size int64, opts UnzipOptions) error {
+	zr, err := zip.NewReader(r, size)
 	if err != nil {
 		return err
 	}
 
+	limits := DefaultLimits()
+	if opts.Limits != nil {
+		limits = *opts.Limits
+	}
+	selected := func(f *zip.File) bool { return opts.Filter.Match(f.Name) }
+
+	if err := os.MkdirAll(outDir, 0o755); err != nil {
+		return err
+	}
+	if err := limits.checkEntries(zr.File, selected); err != nil {
+		return err
+	}
 	for _, f := range zr.File {
-		destPath := filepath.Join(outDir, filepath.FromSlash(f.Name))
+		if !selected(f) {
+			continue
+		}
+		if _, err := safeEntryPath(outDir, f.Name); err != nil {
+			return err
+		}
+	}
+
+	m := NewMeter(opts.Progress)
+	m.SetPhase(PhaseExtracting)
+	if opts.Progress != nil {
+		var files int
+		var total int64
+		for _, f := range zr.File {
+			if selected(f) && f.Mode().IsRegular() && !isSymlink(f) {
+				files++
+				total += int64(f.UncompressedSize64)
+			}
+		}
+		m.SetTotals(files, total)
+	}
+
+	var written int64
+	var dirs, links []*zip.File
+	for _, f := range zr.File {
+		if !selected(f) {
+			continue
+		}
+
+		// Checked again in case an earlier entry changed the tree.
+		destPath, err := safeEntryPath(outDir, f.Name)
+		if err != nil {
+			return err
+		}
 
 		if f.FileInfo().IsDir() {
 			if err := os.MkdirAll(destPath, 0o755); err != nil {
 				return err
 			}
+			dirs = append(dirs, f)
 			continue
 		}
 
-		// Report progress
-		if onProgress != nil {
-			onProgress(f.Name)
+		// Symlinks are created after everything else, so that no entry
+		// is ever written through one the archive planted.
+		if isSymlink(f) {
+			links = append(links, f)
+			continue
 		}
 
 		if err := os.MkdirAll(filepath.Dir(destPath), 0o755); err != nil {
 			return err
 		}
 
-		rc, err := f.Open()
+		m.StartFile(f.Name)
+		n, err := extractFile(f, destPath, limits, written, m)
 		if err != nil {
 			return err
 		}
+		written += n
+		m.FinishFile()
 
-		tmp := destPath + ".tmp"
-		df, err := os.Create(tmp)
-		if err != nil {
-			rc.Close()
+		if err := restoreAttrs(f, destPath, opts); err != nil {
 			return err
 		}
+	}
 
-		if _, err := io.Copy(df, rc); err != nil {
-			rc.Close()
-			df.Close()
+	traversed := make(map[string]bool)
+	for _, f := range links {
+		destPath, err := safeEntryPath(outDir, f.Name)
+		if err != nil {
 			return err
 		}
-
-		rc.Close()
-		if err := df.Close(); err != nil {
+		if err := os.MkdirAll(filepath.Dir(destPath), 0o755); err != nil {
+			return err
+		}
+		skip, err := extractSymlink(f, outDir, destPath, traversed)
+		if err != nil {
+			return err
+		}
+		if skip != nil {
+			if opts.OnSkip != nil {
+				opts.OnSkip(f.Name, skip)
+			}
+			continue
+		}
+		if err := restoreAttrs(f, destPath, opts); err != nil {
 			return err
 		}
+	}
 
-		if err := os.Rename(tmp, destPath); err != nil {
+	// Directory attributes are applied last, deepest first, so that
+	// read-only modes and mtimes are not disturbed by writing their contents.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		destPath := filepath.Join(outDir, filepath.FromSlash(dirs[i].Name))
+		if err := restoreAttrs(dirs[i], destPath, opts); err != nil {
 			return err
 		}
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// extractFile writes one entry to destPath via a .tmp file, counting the
+// bytes in m, and returns the number of bytes written.
+func extractFile(f *zip.File, destPath string, limits Limits, written int64, m *Meter) (int64, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+
+	// O_EXCL (and O_NOFOLLOW) make sure a planted symlink is never
+	// followed.
+	tmp := destPath + ".tmp"
+	if err := removeLeaf(tmp); err != nil {
+		return 0, err
+	}
+	df, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL|oNoFollow, 0o666)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := limits.limitedCopy(m.Writer(df), rc, f.Name, written)
+	if cerr := df.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return n, err
+	}
+
+	return n, os.Rename(tmp, destPath)
+}
+
+// ErrMemberNotFound is returned by OpenMember when the archive has no
+// member with the requested name.
+var ErrMemberNotFound = errors.New("file not found in archive")
+
+// OpenMember opens a single archive member for reading without extracting
+// anything else. name is a slash-separated path relative to the archive root.
+// If r does not contain a ZIP archive, the returned error wraps zip.ErrFormat.
+func OpenMember(r io.ReaderAt, size int64, name string) (io.ReadCloser, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	name = strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(name)), "/")
+	for _, f := range zr.File {
+		if f.Name == name && !f.FileInfo().IsDir() {
+			return f.Open()
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrMemberNotFound, name)
+}
@@ -0,0 +1,196 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testEntry is one member of an archive built by buildZip. A target makes
+// it a symlink, a trailing slash in name a directory.
+type testEntry struct {
+	name, data, target string
+}
+
+func buildZip(t *testing.T, entries []testEntry) *bytes.Reader {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	for _, e := range entries {
+		hdr := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+		data := e.data
+		switch {
+		case e.target != "":
+			hdr.SetMode(fs.ModeSymlink | 0o777)
+			hdr.Method = zip.Store
+			data = e.target
+		case e.name[len(e.name)-1] == '/':
+			hdr.SetMode(fs.ModeDir | 0o755)
+		default:
+			hdr.SetMode(0o644)
+		}
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(w, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return bytes.NewReader(buf.Bytes())
+}
+
+func unzipEntries(t *testing.T, outDir string, entries []testEntry, opts UnzipOptions) error {
+	t.Helper()
+	r := buildZip(t, entries)
+	return UnzipWithOptions(outDir, r, r.Size(), opts)
+}
+
+func TestUnzipSymlinkEscape(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []testEntry
+		skipped string // link skipped instead of refusing the archive
+	}{
+		{
+			// A file written through a planted link to its .tmp path.
+			name: "tmp through link",
+			entries: []testEntry{
+				{name: "a", target: "."},
+				{name: "a/y.tmp", target: "../evil"},
+				{name: "y", data: "PWNED"},
+			},
+		},
+		{
+			name: "leaf through link",
+			entries: []testEntry{
+				{name: "a", target: "."},
+				{name: "a/y", target: "../evil"},
+			},
+		},
+		{
+			name: "target through link",
+			entries: []testEntry{
+				{name: "d/", data: ""},
+				{name: "a", target: "d"},
+				{name: "d/x", target: "."},
+				{name: "b", target: "a/x/../../evil"},
+			},
+			skipped: "b",
+		},
+		{
+			name: "link at traversed directory",
+			entries: []testEntry{
+				{name: "d/", data: ""},
+				{name: "b", target: "d/e/../.."},
+				{name: "d/e", target: ".."},
+			},
+			skipped: "d/e",
+		},
+		{
+			name: "absolute target",
+			entries: []testEntry{
+				{name: "a", target: "/etc"},
+			},
+			skipped: "a",
+		},
+		{
+			name: "dotdot target",
+			entries: []testEntry{
+				{name: "a", target: "../evil"},
+			},
+			skipped: "a",
+		},
+		{
+			name: "file written through link",
+			entries: []testEntry{
+				{name: "a", target: ".."},
+				{name: "a/evil", data: "PWNED"},
+			},
+			skipped: "a",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := t.TempDir()
+			outDir := filepath.Join(base, "out")
+			var skipped []string
+			err := unzipEntries(t, outDir, tt.entries, UnzipOptions{
+				OnSkip: func(name string, err error) {
+					if !errors.Is(err, ErrUnsafePath) {
+						t.Errorf("skip reason = %v, want ErrUnsafePath", err)
+					}
+					skipped = append(skipped, name)
+				},
+			})
+			if tt.skipped == "" {
+				if !errors.Is(err, ErrUnsafePath) {
+					t.Errorf("error = %v, want ErrUnsafePath", err)
+				}
+			} else {
+				if err != nil {
+					t.Errorf("error = %v, want nil", err)
+				}
+				if len(skipped) != 1 || skipped[0] != tt.skipped {
+					t.Errorf("skipped %q, want [%s]", skipped, tt.skipped)
+				}
+				if fi, err := os.Lstat(filepath.Join(outDir, tt.skipped)); err == nil && fi.Mode()&fs.ModeSymlink != 0 {
+					t.Errorf("skipped link %s was created", tt.skipped)
+				}
+			}
+			if _, err := os.Lstat(filepath.Join(base, "evil")); err == nil {
+				t.Fatal("extraction wrote outside the output directory")
+			}
+		})
+	}
+}
+
+func TestUnzipSymlinks(t *testing.T) {
+	outDir := t.TempDir()
+	err := unzipEntries(t, outDir, []testEntry{
+		{name: "link", target: "dir/file"},
+		{name: "dir/", data: ""},
+		{name: "dir/file", data: "hello"},
+		{name: "dir/up", target: "../link"},
+	}, UnzipOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"link", "dir/up"} {
+		data, err := os.ReadFile(filepath.Join(outDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "hello" {
+			t.Errorf("%s = %q, want %q", name, data, "hello")
+		}
+	}
+}
+
+func TestUnzipReplacesPlantedTmp(t *testing.T) {
+	base := t.TempDir()
+	outDir := filepath.Join(base, "out")
+	if err := os.MkdirAll(outDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(base, "evil"), filepath.Join(outDir, "y.tmp")); err != nil {
+		t.Fatal(err)
+	}
+	if err := unzipEntries(t, outDir, []testEntry{{name: "y", data: "data"}}, UnzipOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(filepath.Join(base, "evil")); err == nil {
+		t.Fatal("extraction followed an existing .tmp symlink")
+	}
+	if data, _ := os.ReadFile(filepath.Join(outDir, "y")); string(data) != "data" {
+		t.Errorf("y = %q, want %q", data, "data")
+	}
+}
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"ecrypto/crypto"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// defaultArgonMaxMemory caps the memory calibration may choose (1 GiB in KiB).
+const defaultArgonMaxMemory = 1024 * 1024
+
+// defaultArgonThreads is the parallelism calibration uses: the number of
+// CPUs, but at most 4 so that smaller machines can still decrypt quickly.
+func defaultArgonThreads() uint8 {
+    n := runtime.NumCPU()
+    if n > 4 {
+        n = 4
+    }
+    return uint8(n)
+}
+
+// applySavedArgon replaces m, t and p with the parameters of the active
+// profile, or else of the config file's [argon2] section, except for those
+// whose --argon-m, --argon-t or --argon-p flag was set on c. A nil c
+// applies all of them.
+func applySavedArgon(c *cobra.Command, m, t *uint32, p *uint8) error {
+    if err := loadProfile(); err != nil {
+        return err
+    }
+    changed := func(name string) bool {
+        return c != nil && c.Flags().Changed(name)
+    }
+    if savedArgon != nil {
+        if !changed("argon-m") {
+            *m = savedArgon.Memory
+        }
+        if !changed("argon-t") {
+            *t = savedArgon.Time
+        }
+        if !changed("argon-p") {
+            *p = savedArgon.Parallelism
+        }
+    }
+    if activeProfile.ArgonM != 0 && !changed("argon-m") {
+        *m = activeProfile.ArgonM
+    }
+    if activeProfile.ArgonT != 0 && !changed("argon-t") {
+        *t = activeProfile.ArgonT
+    }
+    if activeProfile.ArgonP != 0 && !changed("argon-p") {
+        *p = activeProfile.ArgonP
+    }
+    return nil
+}
+
+// currentArgon returns the --argon-* defaults with applySavedArgon
+// applied, for encryptions started outside the encrypt command. The
+// globals are left untouched, so concurrent encryptions do not race.
+func currentArgon() (m, t uint32, p uint8, err error) {
+    m, t, p = encArgonM, encArgonT, encArgonP
+    err = applySavedArgon(nil, &m, &t, &p)
+    return m, t, p, err
+}
+
+// autoArgon calibrates Argon2id for target within maxMemory KiB and stores
+// the result in m, t and p. It refuses explicit --argon-m/t/p flags on c.
+func autoArgon(c *cobra.Command, target time.Duration, maxMemory uint32, m, t *uint32, p *uint8) error {
+    for _, name := range []string{"argon-m", "argon-t", "argon-p"} {
+        if c.Flags().Changed(name) {
+            return errors.New("--argon-auto cannot be combined with --argon-m, --argon-t or --argon-p")
+        }
+    }
+    if target <= 0 {
+        return errors.New("--argon-target must be positive")
+    }
+
+    fmt.Fprintf(os.Stderr, "Calibrating Argon2id for %v (max %d KiB)...\n", target, maxMemory)
+    params, took := crypto.CalibrateArgon2id(target, maxMemory, defaultArgonThreads())
+    *m, *t, *p = params.Memory, params.Time, params.Threads
+    fmt.Fprintf(os.Stderr, "Calibrated in %v per derivation\n", took.Round(time.Millisecond))
+    return nil
+}
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"ecrypto/config"
+	"ecrypto/crypto"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+    benchTarget    = time.Second
+    benchMaxMemory uint32 = defaultArgonMaxMemory
+    benchThreads   uint8
+    benchSave      bool
+)
+
+var benchmarkKDFCmd = &cobra.Command{
+    Use:   "benchmark-kdf",
+    Short: "Measure Argon2id on this machine and recommend parameters",
+    Long: `Measure how fast Argon2id runs on this machine and pick the memory,
+iterations and parallelism that make one key derivation take about --target
+without using more than --max-memory KiB.
+
+With --save the parameters are written to the config file
+(~/.config/ecrypto/config.toml) and used by encrypt and rekey for new
+passphrases unless --argon-m, --argon-t or --argon-p are given.`,
+    RunE: func(cmd *cobra.Command, args []string) error {
+        if benchTarget <= 0 {
+            return errors.New("--target must be positive")
+        }
+        if benchThreads == 0 {
+            benchThreads = defaultArgonThreads()
+        }
+
+        m, t, p, err := currentArgon()
+        if err != nil {
+            return err
+        }
+        current := crypto.MeasureArgon2id(crypto.Argon2Params{Memory: m, Time: t, Threads: p})
+        fmt.Printf("Current:     m=%d KiB, t=%d, p=%d  %v\n", m, t, p, current.Round(time.Millisecond))
+
+        fmt.Printf("Calibrating for %v (max %d KiB, %d thread(s))...\n", benchTarget, benchMaxMemory, benchThreads)
+        params, took := crypto.CalibrateArgon2id(benchTarget, benchMaxMemory, benchThreads)
+        fmt.Printf("Recommended: m=%d KiB, t=%d, p=%d  %v\n", params.Memory, params.Time, params.Threads, took.Round(time.Millisecond))
+        fmt.Printf("\n  ecrypto encrypt --argon-m %d --argon-t %d --argon-p %d ...\n", params.Memory, params.Time, params.Threads)
+
+        if !benchSave {
+            fmt.Printf("\nRun again with --save to make these the defaults.\n")
+            return nil
+        }
+        cfg, err := config.Load()
+        if err != nil {
+            return err
+        }
+        cfg.Argon2 = &config.Argon2{Memory: params.Memory, Time: params.Time, Parallelism: params.Threads}
+        path, err := cfg.Save()
+        if err != nil {
+            return err
+        }
+        fmt.Printf("\n✓ Saved to %s\n", path)
+        return nil
+    },
+}
+
+func init() {
+    rootCmd.AddCommand(benchmarkKDFCmd)
+    benchmarkKDFCmd.Flags().DurationVar(&benchTarget, "target", benchTarget, "Time one key derivation should take")
+    benchmarkKDFCmd.Flags().Uint32Var(&benchMaxMemory, "max-memory", benchMaxMemory, "Most memory Argon2 may use (KiB)")
+    benchmarkKDFCmd.Flags().Uint8Var(&benchThreads, "threads", 0, "Argon2 parallelism (default: CPUs, at most 4)")
+    benchmarkKDFCmd.Flags().BoolVar(&benchSave, "save", false, "Save the recommended parameters to the config file")
+}
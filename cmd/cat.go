@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"errors"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+    catInFile   string
+    catPath     string
+    catPass     passFlags
+    catKeyFile  string
+    catIdentity string
+)
+
+var catCmd = &cobra.Command{
+    Use:   "cat",
+    Short: "Stream one file from a .ecrypt container to stdout",
+    Long: `Decrypt a single file from a container and write it to stdout without
+extracting anything else. Use 'ecrypto list' to see the available paths.
+
+Example:
+  ecrypto cat --in backup.ecrypt --path config/app.yaml --pass ... > app.yaml`,
+    RunE: func(cmd *cobra.Command, args []string) error {
+        if catInFile == "" || catPath == "" {
+            return errors.New("--in and --path are required")
+        }
+
+        applyProfileKeys(cmd, &catPass, &catKeyFile, &catIdentity)
+        resolveKey := containerKey(&catPass, catKeyFile, catIdentity)
+        return catContainer(catInFile, catPath, resolveKey, cmd.OutOrStdout())
+    },
+}
+
+func init() {
+    rootCmd.AddCommand(catCmd)
+    catCmd.Flags().StringVar(&catInFile, "in", "", "Input .ecrypt file")
+    catCmd.Flags().StringVar(&catPath, "path", "", "Path of the file inside the container")
+    addPassFlags(catCmd, &catPass)
+    catCmd.Flags().StringVar(&catKeyFile, "key-file", "", "32-byte Base64(URL) key file")
+    catCmd.Flags().StringVar(&catIdentity, "identity", "", "X25519 identity file (recipient containers)")
+}
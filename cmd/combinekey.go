@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+    combineShares  []string
+    combineOutFile string
+)
+
+var combineKeyCmd = &cobra.Command{
+    Use:   "combine-key",
+    Short: "Recombine key shares into a key file",
+    Long: `Recombine M key shares from keygen --shares or split-key into the
+original 32-byte key, in the key file format read by --key-file.
+
+  ecrypto combine-key --key-share dr.key.share1 --key-share dr.key.share3 \
+    --key-share dr.key.share5 --out dr.key
+
+Without --out the key is printed. encrypt and decrypt accept --key-share
+directly, so this is only needed to hand the key to other tools or to
+split it again differently. Corrupted, mismatched, duplicate or too few
+shares are reported instead of producing a wrong key.`,
+    SilenceUsage: true,
+    RunE: func(cmd *cobra.Command, args []string) error {
+        if len(combineShares) == 0 {
+            return errors.New("at least one --key-share is required")
+        }
+        return combineKey(combineShares, combineOutFile)
+    },
+}
+
+// combineKey recombines the share files in paths and writes the key to
+// outFile, or prints it if outFile is empty.
+func combineKey(paths []string, outFile string) error {
+    key, err := combineKeyShares(paths)
+    if err != nil {
+        return err
+    }
+    encoded := base64.RawURLEncoding.EncodeToString(key)
+    if outFile == "" {
+        fmt.Println(encoded)
+        return nil
+    }
+    if err := os.WriteFile(outFile, []byte(encoded), 0o600); err != nil {
+        return err
+    }
+    fmt.Fprintf(os.Stderr, "✓ Key saved to: %s\n", outFile)
+    return nil
+}
+
+func init() {
+    rootCmd.AddCommand(combineKeyCmd)
+    combineKeyCmd.Flags().StringArrayVar(&combineShares, "key-share", nil, "Key share file (repeatable)")
+    combineKeyCmd.Flags().StringVar(&combineOutFile, "out", "", "Output key file (optional)")
+}
@@ -0,0 +1,952 @@
+package cmd
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"ecrypto/archive"
+	"ecrypto/crypto"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// newStreamHeader returns a streaming header in the current format version
+// with a fresh nonce prefix.
+func newStreamHeader(kdf uint8) (*crypto.HeaderV2, error) {
+    h := &crypto.HeaderV2{
+        Magic:     [8]byte{'E', 'C', 'R', 'Y', 'P', 'T', '0', '1'},
+        Version:   crypto.CurrentVersion,
+        ChunkSize: crypto.DefaultChunkSize,
+        KDF:       kdf,
+    }
+    if _, err := rand.Read(h.NoncePrefix[:]); err != nil {
+        return nil, err
+    }
+    return h, nil
+}
+
+// newWrappedHeader returns a v2 header with a random file key and a
+// single stanza produced by wrap.
+func newWrappedHeader(wrap func(fileKey []byte) (crypto.Stanza, error)) (*crypto.HeaderV2, []byte, error) {
+    h, err := newStreamHeader(crypto.KDFWrapped)
+    if err != nil {
+        return nil, nil, err
+    }
+    key, err := crypto.NewFileKey()
+    if err != nil {
+        return nil, nil, err
+    }
+    st, err := wrap(key)
+    if err != nil {
+        return nil, nil, err
+    }
+    h.Stanzas = []crypto.Stanza{st}
+    return h, key, nil
+}
+
+// newPassphraseHeader returns a v2 header whose random file key is wrapped
+// with an Argon2id key derived from pass.
+func newPassphraseHeader(pass string, m, t uint32, p uint8) (*crypto.HeaderV2, []byte, error) {
+    return newWrappedHeader(passphraseStanza(pass, m, t, p))
+}
+
+// newKeyFileHeader returns a v2 header whose random file key is wrapped
+// with the raw key loaded from keyFile.
+func newKeyFileHeader(keyFile string) (*crypto.HeaderV2, []byte, error) {
+    wrap, err := keyFileStanza(keyFile)
+    if err != nil {
+        return nil, nil, err
+    }
+    return newWrappedHeader(wrap)
+}
+
+// newTwoFactorHeader returns a v2 header whose random file key can only be
+// unwrapped with both pass and the key in keyFile.
+func newTwoFactorHeader(pass, keyFile string, m, t uint32, p uint8) (*crypto.HeaderV2, []byte, error) {
+    wrap, err := twoFactorStanza(pass, keyFile, m, t, p)
+    if err != nil {
+        return nil, nil, err
+    }
+    return newWrappedHeader(wrap)
+}
+
+// passphraseStanza returns a wrapper that seals a file key with pass using
+// the given Argon2id parameters.
+func passphraseStanza(pass string, m, t uint32, p uint8) func(fileKey []byte) (crypto.Stanza, error) {
+    return func(fileKey []byte) (crypto.Stanza, error) {
+        return crypto.WrapKeyArgon2id(fileKey, pass, m, t, p)
+    }
+}
+
+// keyFileStanza returns a wrapper that seals a file key with the key in
+// keyFile.
+func keyFileStanza(keyFile string) (func(fileKey []byte) (crypto.Stanza, error), error) {
+    key, err := crypto.ReadKeyFromFile(keyFile)
+    if err != nil {
+        return nil, err
+    }
+    return keyStanza(key), nil
+}
+
+// keyStanza returns a wrapper that seals a file key with key.
+func keyStanza(key []byte) func(fileKey []byte) (crypto.Stanza, error) {
+    return func(fileKey []byte) (crypto.Stanza, error) {
+        return crypto.WrapKeyWithKey(fileKey, key)
+    }
+}
+
+// twoFactorStanza returns a wrapper that seals a file key with pass and the
+// key in keyFile combined, using the given Argon2id parameters.
+func twoFactorStanza(pass, keyFile string, m, t uint32, p uint8) (func(fileKey []byte) (crypto.Stanza, error), error) {
+    key, err := crypto.ReadKeyFromFile(keyFile)
+    if err != nil {
+        return nil, err
+    }
+    return func(fileKey []byte) (crypto.Stanza, error) {
+        return crypto.WrapKeyTwoFactor(fileKey, pass, key, m, t, p)
+    }, nil
+}
+
+// newRecipientsHeader returns a v2 header and a random file key wrapped
+// once per recipient public key.
+func newRecipientsHeader(recipients []string) (*crypto.HeaderV2, []byte, error) {
+    pubs, err := parseRecipients(recipients)
+    if err != nil {
+        return nil, nil, err
+    }
+    h, err := newStreamHeader(crypto.KDFWrapped)
+    if err != nil {
+        return nil, nil, err
+    }
+    key, err := crypto.NewFileKey()
+    if err != nil {
+        return nil, nil, err
+    }
+    for _, pub := range pubs {
+        st, err := crypto.WrapKeyX25519(key, pub)
+        if err != nil {
+            return nil, nil, err
+        }
+        h.Stanzas = append(h.Stanzas, st)
+    }
+    return h, key, nil
+}
+
+// parseSignerKey parses an Ed25519 public key given as text or as a file
+// holding it (comment lines allowed).
+func parseSignerKey(arg string) (ed25519.PublicKey, error) {
+    if pub, err := crypto.ParseEd25519PublicKey(arg); err == nil {
+        return pub, nil
+    }
+    raw, err := os.ReadFile(arg)
+    if err != nil {
+        return nil, fmt.Errorf("invalid signer key %q: not a public key or readable file", arg)
+    }
+    for _, line := range strings.Split(string(raw), "\n") {
+        line = strings.TrimSpace(line)
+        if line == "" || strings.HasPrefix(line, "#") {
+            continue
+        }
+        pub, err := crypto.ParseEd25519PublicKey(line)
+        if err != nil {
+            return nil, fmt.Errorf("%s: %v", arg, err)
+        }
+        return pub, nil
+    }
+    return nil, fmt.Errorf("%s: no public key found", arg)
+}
+
+// addRecoveryStanzas appends a recovery stanza holding fileKey for every
+// recovery public key in recoveryKeys (keys or files, as for recipients).
+func addRecoveryStanzas(h *crypto.HeaderV2, fileKey []byte, recoveryKeys []string) error {
+    pubs, err := parseRecipients(recoveryKeys)
+    if err != nil {
+        return err
+    }
+    for _, pub := range pubs {
+        st, err := crypto.WrapKeyRecovery(fileKey, pub)
+        if err != nil {
+            return err
+        }
+        h.Stanzas = append(h.Stanzas, st)
+    }
+    return nil
+}
+
+// parseRecipients parses recipient arguments. Each argument is either a
+// public key or a file with one public key per line.
+func parseRecipients(args []string) ([][]byte, error) {
+    if len(args) == 0 {
+        return nil, errors.New("at least one recipient is required")
+    }
+    var pubs [][]byte
+    for _, arg := range args {
+        if pub, err := crypto.ParseX25519Recipient(arg); err == nil {
+            pubs = append(pubs, pub)
+            continue
+        }
+        raw, err := os.ReadFile(arg)
+        if err != nil {
+            return nil, fmt.Errorf("invalid recipient %q: not a public key or readable file", arg)
+        }
+        for _, line := range strings.Split(string(raw), "\n") {
+            line = strings.TrimSpace(line)
+            if line == "" || strings.HasPrefix(line, "#") {
+                continue
+            }
+            pub, err := crypto.ParseX25519Recipient(line)
+            if err != nil {
+                return nil, fmt.Errorf("%s: %v", arg, err)
+            }
+            pubs = append(pubs, pub)
+        }
+    }
+    if len(pubs) == 0 {
+        return nil, errors.New("no recipients found")
+    }
+    return pubs, nil
+}
+
+// writeContainer writes the container produced by writeContainerTo into
+// outFile. The output is written to a .tmp file first and renamed into
+// place on success. Cancelling ctx stops the write at the next chunk and
+// removes the .tmp file.
+func writeContainer(ctx context.Context, outFile string, h *crypto.HeaderV2, key []byte, signKey ed25519.PrivateKey, fill func(w io.Writer) error) error {
+    tmp := outFile + ".tmp"
+    f, err := os.Create(tmp)
+    if err != nil {
+        return err
+    }
+
+    err = writeContainerTo(ctx, f, h, key, signKey, fill)
+    if cerr := f.Close(); err == nil {
+        err = cerr
+    }
+    if err != nil {
+        os.Remove(tmp)
+        return err
+    }
+
+    return os.Rename(tmp, outFile)
+}
+
+// writeContainerTo writes the header to out and streams everything fill
+// writes through the chunked AEAD after it. With a signKey the header
+// records the signer and an Ed25519 signature of the whole header and the
+// encrypted payload is appended. Version 3 headers also get a commitment
+// to key. Cancelling ctx stops the write at the next chunk.
+func writeContainerTo(ctx context.Context, out io.Writer, h *crypto.HeaderV2, key []byte, signKey ed25519.PrivateKey, fill func(w io.Writer) error) error {
+    if h.Version >= crypto.VersionV3 {
+        h.CommitKey(key)
+    }
+    if signKey != nil {
+        h.SetExtension(crypto.SignatureExtension(signKey.Public().(ed25519.PublicKey)))
+    }
+
+    if _, err := out.Write(h.Encode()); err != nil {
+        return err
+    }
+    w := out
+    sum := crypto.NewSignatureHash()
+    if signKey != nil {
+        sum.Write(h.Encode())
+        w = io.MultiWriter(out, sum)
+    }
+    sw, err := crypto.NewStreamWriter(w, key, h.AAD(), h.NoncePrefix[:], int(h.ChunkSize))
+    if err != nil {
+        return err
+    }
+    if err := fill(ctxWriter{ctx, sw}); err != nil {
+        return err
+    }
+    if err := sw.Close(); err != nil {
+        return err
+    }
+    if signKey == nil {
+        return nil
+    }
+    sig, err := crypto.SignContainer(signKey, sum.Sum(nil))
+    if err != nil {
+        return err
+    }
+    _, err = out.Write(sig)
+    return err
+}
+
+// ctxWriter fails writes once ctx is done.
+type ctxWriter struct {
+    ctx context.Context
+    w   io.Writer
+}
+
+func (w ctxWriter) Write(p []byte) (int, error) {
+    if err := w.ctx.Err(); err != nil {
+        return 0, err
+    }
+    return w.w.Write(p)
+}
+
+// ctxReaderAt fails reads once ctx is done.
+type ctxReaderAt struct {
+    ctx context.Context
+    r   io.ReaderAt
+}
+
+func (r ctxReaderAt) ReadAt(p []byte, off int64) (int, error) {
+    if err := r.ctx.Err(); err != nil {
+        return 0, err
+    }
+    return r.r.ReadAt(p, off)
+}
+
+// encryptFolder streams a ZIP of the files in inDir selected by opts into
+// a v2 container, signed with signKey if it is not nil.
+func encryptFolder(ctx context.Context, inDir, outFile string, h *crypto.HeaderV2, key []byte, signKey ed25519.PrivateKey, opts archive.ZipOptions) error {
+    return writeContainer(ctx, outFile, h, key, signKey, func(w io.Writer) error {
+        return archive.ZipFolderWithOptions(w, inDir, opts)
+    })
+}
+
+// encryptFile streams a single file into a v2 container, reporting the
+// bytes read to progress if it is not nil.
+func encryptFile(ctx context.Context, filePath, outFile string, h *crypto.HeaderV2, key []byte, progress archive.ProgressFunc) error {
+    return writeContainer(ctx, outFile, h, key, nil, func(w io.Writer) error {
+        f, err := os.Open(filePath)
+        if err != nil {
+            return err
+        }
+        defer f.Close()
+
+        m := archive.NewMeter(progress)
+        m.SetPhase(archive.PhaseEncrypting)
+        if st, err := f.Stat(); err == nil {
+            m.SetTotals(1, st.Size())
+        }
+        m.StartFile(filepath.Base(filePath))
+        if _, err := io.Copy(w, m.Reader(f)); err != nil {
+            return err
+        }
+        m.FinishFile()
+        m.SetPhase(archive.PhaseWriting)
+        return nil
+    })
+}
+
+// errShortHeader is returned when a file ends inside its header.
+var errShortHeader = errors.New("file too small to contain header")
+
+// container is an opened .ecrypt file of any supported version.
+type container struct {
+    file *os.File
+    size int64
+    v1   *crypto.HeaderV1
+    v2   *crypto.HeaderV2
+    sig  []byte // signature trailer of a signed container
+
+    // pinned is set once checkSignature has succeeded; the payload is then
+    // read through it, so that only the bytes that were verified are
+    // decrypted.
+    pinned *pinnedPayload
+}
+
+// openContainer opens a container and parses its header.
+func openContainer(path string) (*container, error) {
+    f, err := os.Open(path)
+    if err != nil {
+        return nil, err
+    }
+    c, err := readContainer(f)
+    if err != nil {
+        f.Close()
+        return nil, err
+    }
+    return c, nil
+}
+
+func readContainer(f *os.File) (*container, error) {
+    st, err := f.Stat()
+    if err != nil {
+        return nil, err
+    }
+
+    c := &container{file: f, size: st.Size()}
+    c.v1, c.v2, err = crypto.DecodeHeader(bufio.NewReader(io.NewSectionReader(f, 0, c.size)))
+    if err != nil {
+        return nil, err
+    }
+    if c.size < int64(c.HeaderSize()) {
+        return nil, errShortHeader
+    }
+    if c.v2 != nil {
+        if _, signed := c.v2.Extension(crypto.ExtSignature); signed {
+            if c.size < int64(c.HeaderSize())+crypto.SignatureSize {
+                return nil, errShortHeader
+            }
+            c.sig = make([]byte, crypto.SignatureSize)
+            if _, err := f.ReadAt(c.sig, c.size-crypto.SignatureSize); err != nil {
+                return nil, err
+            }
+        }
+    }
+    return c, nil
+}
+
+// payloadSize returns the size of the encrypted payload, which sits
+// between the header and the signature trailer, if any.
+func (c *container) payloadSize() int64 {
+    return c.size - int64(c.HeaderSize()) - int64(len(c.sig))
+}
+
+// checkSignature verifies the signature of c. If want is not nil, c must
+// be signed by want. On success the payload is pinned: later reads of it
+// fail with errPayloadChanged if the file no longer holds the bytes that
+// were verified.
+func (c *container) checkSignature(want ed25519.PublicKey) error {
+    if c.v2 == nil || c.sig == nil {
+        return crypto.ErrUnsigned
+    }
+    p := newPinnedPayload(c.file, int64(c.HeaderSize()), c.payloadSize(), int64(c.v2.ChunkSize)+crypto.ChunkOverhead)
+    sum := crypto.NewSignatureHash()
+    sum.Write(c.v2.Encode())
+    if err := p.pin(sum); err != nil {
+        return err
+    }
+    if err := crypto.VerifyContainerSignature(c.v2, want, sum.Sum(nil), c.sig); err != nil {
+        return err
+    }
+    c.pinned = p
+    return nil
+}
+
+// payloadReader returns the reader the payload is decrypted from.
+func (c *container) payloadReader() io.ReaderAt {
+    if c.pinned != nil {
+        return c.pinned
+    }
+    return c.file
+}
+
+// errPayloadChanged is returned when a pinned payload is modified while
+// it is being decrypted.
+var errPayloadChanged = errors.New("container changed after its signature was checked")
+
+// maxPins bounds the number of block digests kept for a pinned payload
+// (32 MiB); larger payloads use blocks of several chunks.
+const maxPins = 1 << 20
+
+// pinnedPayload reads the payload of a container through SHA-256 digests
+// of its blocks, taken while the signature was checked. Blocks are whole
+// encrypted chunks, so each chunk read hashes no more than it reads; the
+// last verified block is kept for chunks sharing it.
+type pinnedPayload struct {
+    r            io.ReaderAt
+    offset, size int64
+    block        int64
+    sums         [][sha256.Size]byte
+
+    mu        sync.Mutex
+    cachedIdx int64
+    cached    []byte
+}
+
+func newPinnedPayload(r io.ReaderAt, offset, size, encChunk int64) *pinnedPayload {
+    chunks := (size + encChunk - 1) / encChunk
+    perBlock := max((chunks+maxPins-1)/maxPins, 1)
+    return &pinnedPayload{r: r, offset: offset, size: size, block: encChunk * perBlock, cachedIdx: -1}
+}
+
+// pin reads the whole payload into sum, recording the block digests.
+func (p *pinnedPayload) pin(sum io.Writer) error {
+    buf := make([]byte, p.block)
+    for off := int64(0); off < p.size; off += p.block {
+        b := buf[:min(p.block, p.size-off)]
+        if _, err := p.r.ReadAt(b, p.offset+off); err != nil && !(errors.Is(err, io.EOF) && off+int64(len(b)) == p.size) {
+            return err
+        }
+        sum.Write(b)
+        p.sums = append(p.sums, sha256.Sum256(b))
+    }
+    return nil
+}
+
+func (p *pinnedPayload) ReadAt(b []byte, off int64) (int, error) {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+
+    off -= p.offset
+    if off < 0 {
+        return 0, errors.New("read before the pinned payload")
+    }
+    n := 0
+    for n < len(b) {
+        if off >= p.size {
+            return n, io.EOF
+        }
+        idx := off / p.block
+        blk, err := p.blockAt(idx)
+        if err != nil {
+            return n, err
+        }
+        c := copy(b[n:], blk[off-idx*p.block:])
+        n += c
+        off += int64(c)
+    }
+    return n, nil
+}
+
+// blockAt returns block idx after checking it against its digest; callers
+// must hold p.mu.
+func (p *pinnedPayload) blockAt(idx int64) ([]byte, error) {
+    if idx == p.cachedIdx {
+        return p.cached, nil
+    }
+    start := idx * p.block
+    if p.cached == nil {
+        p.cached = make([]byte, p.block)
+    }
+    b := p.cached[:min(p.block, p.size-start)]
+    p.cachedIdx = -1
+    if n, err := p.r.ReadAt(b, p.offset+start); n < len(b) {
+        if err == nil || err == io.EOF {
+            return nil, errPayloadChanged
+        }
+        return nil, err
+    }
+    if sha256.Sum256(b) != p.sums[idx] {
+        return nil, errPayloadChanged
+    }
+    p.cached, p.cachedIdx = b, idx
+    return b, nil
+}
+
+// Close closes the underlying file.
+func (c *container) Close() error {
+    return c.file.Close()
+}
+
+// Version returns the container format version.
+func (c *container) Version() uint8 {
+    if c.v2 != nil {
+        return c.v2.Version
+    }
+    return c.v1.Version
+}
+
+// KDF returns the key derivation mode (0=raw key, 1=Argon2id, 2=wrapped).
+func (c *container) KDF() uint8 {
+    if c.v2 != nil {
+        return c.v2.KDF
+    }
+    return c.v1.KDF
+}
+
+// ArgonParams returns the Argon2id memory, time and parallelism settings,
+// taken from the passphrase stanza for wrapped containers.
+func (c *container) ArgonParams() (uint32, uint32, uint8) {
+    for _, st := range c.Stanzas() {
+        if m, t, p, err := crypto.Argon2idStanzaParams(st); err == nil {
+            return m, t, p
+        }
+    }
+    if c.v2 != nil {
+        return c.v2.ArgonM, c.v2.ArgonT, c.v2.ArgonP
+    }
+    return c.v1.ArgonM, c.v1.ArgonT, c.v1.ArgonP
+}
+
+// Stanzas returns the wrapped key stanzas (v2 wrapped containers only).
+func (c *container) Stanzas() []crypto.Stanza {
+    if c.v2 != nil {
+        return c.v2.Stanzas
+    }
+    return nil
+}
+
+// HeaderSize returns the encoded header size.
+func (c *container) HeaderSize() int {
+    if c.v2 != nil {
+        return c.v2.Size()
+    }
+    return crypto.HeaderSize()
+}
+
+// deriveKey derives the container key from a passphrase.
+func (c *container) deriveKey(pass string) []byte {
+    m, t, p := c.ArgonParams()
+    var salt []byte
+    if c.v2 != nil {
+        salt = c.v2.Salt[:]
+    } else {
+        salt = c.v1.Salt[:]
+    }
+    return crypto.DeriveKeyArgon2id(pass, salt, m, t, p)
+}
+
+// plaintext authenticates the container with key and returns a reader
+// over the decrypted payload. v2 payloads are decrypted chunk by chunk on
+// demand; v1 payloads are decrypted in memory as before.
+func (c *container) plaintext(key []byte) (io.ReaderAt, int64, error) {
+    if c.v2 != nil {
+        if err := c.v2.CheckKey(key); err != nil {
+            return nil, 0, err
+        }
+    }
+
+    hs := int64(c.HeaderSize())
+    if c.v2 != nil {
+        // The constructor already opens the last chunk.
+        sr, err := crypto.NewStreamReaderAt(c.payloadReader(), hs, c.payloadSize(), key, c.v2.AAD(), c.v2.NoncePrefix[:], int(c.v2.ChunkSize))
+        if !c.v2.KeyCommitted() { // version 2
+            if err != nil {
+                return nil, 0, err
+            }
+            return sr, sr.Size(), nil
+        }
+        if err != nil {
+            return nil, 0, corruptData(err)
+        }
+        return corruptDataReader{sr}, sr.Size(), nil
+    }
+
+    ct := make([]byte, c.size-hs)
+    if _, err := c.file.ReadAt(ct, hs); err != nil {
+        return nil, 0, err
+    }
+    pt, err := crypto.DecryptAEAD(key, ct, c.v1.Encode(), c.v1.Nonce[:])
+    if err != nil {
+        return nil, 0, err
+    }
+    return bytes.NewReader(pt), int64(len(pt)), nil
+}
+
+// corruptDataReader reports chunk authentication failures as corrupted
+// data. It is used once the key has matched the container's commitment,
+// which rules out a wrong key.
+type corruptDataReader struct {
+    r io.ReaderAt
+}
+
+func (r corruptDataReader) ReadAt(p []byte, off int64) (int, error) {
+    n, err := r.r.ReadAt(p, off)
+    return n, corruptData(err)
+}
+
+// corruptData marks a chunk authentication failure as corrupted data.
+func corruptData(err error) error {
+    if errors.Is(err, crypto.ErrChunkAuth) {
+        return fmt.Errorf("%w: %w", crypto.ErrCorruptData, err)
+    }
+    return err
+}
+
+// passphraseKey returns a key resolver for passphrase-protected containers.
+func passphraseKey(pass string) func(c *container) ([]byte, error) {
+    return func(c *container) ([]byte, error) {
+        switch c.KDF() {
+        case crypto.KDFArgon2id:
+            return c.deriveKey(pass), nil
+        case crypto.KDFWrapped:
+            fileKey, err := crypto.UnwrapPassphrase(c.Stanzas(), pass)
+            if errors.Is(err, crypto.ErrNoPassphraseStanza) && c.stanzaCount(crypto.StanzaTwoFactor) > 0 {
+                return nil, crypto.ErrTwoFactorRequired
+            }
+            return fileKey, err
+        }
+        return nil, fmt.Errorf("container uses %s, not a passphrase", kdfName(c.KDF()))
+    }
+}
+
+// keyFileKey returns a key resolver for raw-key containers.
+func keyFileKey(keyFile string) func(c *container) ([]byte, error) {
+    return func(c *container) ([]byte, error) {
+        key, err := crypto.ReadKeyFromFile(keyFile)
+        if err != nil {
+            return nil, err
+        }
+        return rawKey(key)(c)
+    }
+}
+
+// rawKey returns a key resolver for a key already in memory, such as one
+// combined from key shares. It opens the same containers as keyFileKey.
+func rawKey(key []byte) func(c *container) ([]byte, error) {
+    return func(c *container) ([]byte, error) {
+        switch c.KDF() {
+        case crypto.KDFRawKey:
+            return key, nil
+        case crypto.KDFWrapped:
+            fileKey, err := crypto.UnwrapKeyFile(c.Stanzas(), key)
+            if errors.Is(err, crypto.ErrNoKeyFileStanza) && c.stanzaCount(crypto.StanzaTwoFactor) > 0 {
+                return nil, crypto.ErrTwoFactorRequired
+            }
+            return fileKey, err
+        }
+        return nil, fmt.Errorf("container uses %s, not a key file", kdfName(c.KDF()))
+    }
+}
+
+// twoFactorKey returns a key resolver for wrapped containers given both a
+// passphrase and a key file. Containers without a two-factor stanza are
+// opened with whichever of the two they were wrapped for.
+func twoFactorKey(pass, keyFile string) func(c *container) ([]byte, error) {
+    return func(c *container) ([]byte, error) {
+        if c.stanzaCount(crypto.StanzaTwoFactor) == 0 {
+            if c.stanzaCount(crypto.StanzaKeyFile) > 0 {
+                return keyFileKey(keyFile)(c)
+            }
+            return passphraseKey(pass)(c)
+        }
+        key, err := crypto.ReadKeyFromFile(keyFile)
+        if err != nil {
+            return nil, err
+        }
+        return crypto.UnwrapTwoFactor(c.Stanzas(), pass, key)
+    }
+}
+
+// identityKey returns a key resolver that unwraps the file key of a
+// recipient container with the identities in identityFile.
+func identityKey(identityFile string) func(c *container) ([]byte, error) {
+    return func(c *container) ([]byte, error) {
+        if c.KDF() != crypto.KDFWrapped {
+            return nil, fmt.Errorf("container uses %s, not recipients", kdfName(c.KDF()))
+        }
+        ids, err := crypto.ReadX25519Identities(identityFile)
+        if err != nil {
+            return nil, err
+        }
+        return crypto.UnwrapStanzas(c.Stanzas(), ids)
+    }
+}
+
+// recoveryKey returns a key resolver that unwraps the file key from the
+// recovery stanzas of a container with the identities in identityFile.
+func recoveryKey(identityFile string) func(c *container) ([]byte, error) {
+    return func(c *container) ([]byte, error) {
+        if c.KDF() != crypto.KDFWrapped {
+            return nil, fmt.Errorf("container uses %s and has no recovery stanza", kdfName(c.KDF()))
+        }
+        ids, err := crypto.ReadX25519Identities(identityFile)
+        if err != nil {
+            return nil, err
+        }
+        return crypto.UnwrapRecovery(c.Stanzas(), ids)
+    }
+}
+
+// keyResolver picks the key resolver matching the container's KDF mode
+// and the credentials supplied on the command line.
+func keyResolver(kdf uint8, pass, keyFile, identity string) (func(c *container) ([]byte, error), error) {
+    switch kdf {
+    case crypto.KDFArgon2id:
+        if pass == "" {
+            return nil, errors.New("passphrase required (Argon2id)")
+        }
+        return passphraseKey(pass), nil
+    case crypto.KDFWrapped:
+        switch {
+        case identity != "":
+            return identityKey(identity), nil
+        case keyFile != "" && pass != "":
+            return twoFactorKey(pass, keyFile), nil
+        case keyFile != "":
+            return keyFileKey(keyFile), nil
+        case pass != "":
+            return passphraseKey(pass), nil
+        }
+        return nil, errors.New("passphrase, key file or identity required")
+    default:
+        if keyFile == "" {
+            return nil, errors.New("key file required (raw key mode)")
+        }
+        return keyFileKey(keyFile), nil
+    }
+}
+
+// credentialsKey returns a key resolver that picks the right resolver for
+// the opened container from whichever credentials are set.
+func credentialsKey(pass, keyFile, identity string) func(c *container) ([]byte, error) {
+    return func(c *container) ([]byte, error) {
+        resolveKey, err := keyResolver(c.KDF(), pass, keyFile, identity)
+        if err != nil {
+            return nil, err
+        }
+        return resolveKey(c)
+    }
+}
+
+// needsBothFactors reports whether c can only be opened with a passphrase
+// and a key file together.
+func (c *container) needsBothFactors() bool {
+    return c.stanzaCount(crypto.StanzaTwoFactor) > 0 && c.stanzaCount(crypto.StanzaKeyFile) == 0
+}
+
+// stanzaCount returns how many stanzas of type t the container has.
+func (c *container) stanzaCount(t uint8) int {
+    n := 0
+    for _, st := range c.Stanzas() {
+        if st.Type == t {
+            n++
+        }
+    }
+    return n
+}
+
+// kdfName returns a human-readable name for a KDF mode.
+func kdfName(kdf uint8) string {
+    switch kdf {
+    case crypto.KDFRawKey:
+        return "Raw Key"
+    case crypto.KDFArgon2id:
+        return "Argon2id"
+    case crypto.KDFWrapped:
+        return "Wrapped Key"
+    }
+    return fmt.Sprintf("Unknown (%d)", kdf)
+}
+
+// openPlaintext opens inFile, resolves its key and returns the container
+// together with a reader over the decrypted payload. The caller must close
+// the container.
+func openPlaintext(inFile string, resolveKey func(c *container) ([]byte, error)) (*container, io.ReaderAt, int64, error) {
+    c, err := openContainer(inFile)
+    if err != nil {
+        return nil, nil, 0, err
+    }
+
+    key, err := resolveKey(c)
+    if err != nil {
+        c.Close()
+        return nil, nil, 0, err
+    }
+
+    pt, size, err := c.plaintext(key)
+    if err != nil {
+        c.Close()
+        return nil, nil, 0, err
+    }
+    return c, pt, size, nil
+}
+
+// singleFileName returns the name a single-file container decrypts to:
+// the container name without its .ecrypt extension.
+func singleFileName(inFile string) string {
+    return strings.TrimSuffix(filepath.Base(inFile), ".ecrypt")
+}
+
+// decryptContainer decrypts inFile into outDir. Folder containers are
+// extracted (only the members selected by opts.Filter); anything that is
+// not a ZIP archive is written out as a single file named after the
+// container. Cancelling ctx stops at the next read; the file being
+// written is removed, files already extracted are kept.
+func decryptContainer(ctx context.Context, inFile, outDir string, resolveKey func(c *container) ([]byte, error), opts archive.UnzipOptions) error {
+    c, pt, size, err := openPlaintext(inFile, resolveKey)
+    if err != nil {
+        return err
+    }
+    defer c.Close()
+    if err := ctx.Err(); err != nil {
+        return err
+    }
+    pt = ctxReaderAt{ctx, pt}
+
+    if err := os.MkdirAll(outDir, 0o755); err != nil {
+        return err
+    }
+
+    if opts.OnSkip == nil {
+        opts.OnSkip = func(_ string, err error) {
+            fmt.Fprintf(os.Stderr, "Warning: %v (skipped)\n", err)
+        }
+    }
+
+    // Try to unzip first (for folder encryption)
+    err = archive.UnzipWithOptions(outDir, pt, size, opts)
+    if !errors.Is(err, zip.ErrFormat) {
+        return err
+    }
+
+    // Not a ZIP archive, so it is a single file encryption.
+    originalName := singleFileName(inFile)
+    if !opts.Filter.Match(originalName) {
+        return nil
+    }
+    outputPath := filepath.Join(outDir, originalName)
+    tmp := outputPath + ".tmp"
+    out, err := os.Create(tmp)
+    if err != nil {
+        return fmt.Errorf("failed to write decrypted file: %v", err)
+    }
+    m := archive.NewMeter(opts.Progress)
+    m.SetPhase(archive.PhaseDecrypting)
+    m.SetTotals(1, size)
+    m.StartFile(originalName)
+    _, err = io.Copy(m.Writer(out), io.NewSectionReader(pt, 0, size))
+    if cerr := out.Close(); err == nil {
+        err = cerr
+    }
+    if err != nil {
+        os.Remove(tmp)
+        return err
+    }
+    if err := os.Rename(tmp, outputPath); err != nil {
+        return err
+    }
+    m.FinishFile()
+    return nil
+}
+
+// readManifest lists the members of inFile. Only the chunks holding the ZIP
+// central directory are decrypted. A single-file container is reported as
+// one entry named after the container.
+func readManifest(inFile string, resolveKey func(c *container) ([]byte, error)) (*archive.Manifest, error) {
+    c, pt, size, err := openPlaintext(inFile, resolveKey)
+    if err != nil {
+        return nil, err
+    }
+    defer c.Close()
+
+    m, err := archive.ReadManifest(pt, size)
+    if errors.Is(err, zip.ErrFormat) {
+        m = &archive.Manifest{Files: []archive.FileEntry{{Name: singleFileName(inFile), Size: size}}}
+    } else if err != nil {
+        return nil, err
+    }
+    m.Version = int(c.Version())
+    return m, nil
+}
+
+// catContainer writes the decrypted contents of one member of inFile to w.
+// Only the chunks that hold the member are decrypted. For a single-file
+// container, member must be the name reported by readManifest.
+func catContainer(inFile, member string, resolveKey func(c *container) ([]byte, error), w io.Writer) error {
+    c, pt, size, err := openPlaintext(inFile, resolveKey)
+    if err != nil {
+        return err
+    }
+    defer c.Close()
+
+    rc, err := archive.OpenMember(pt, size, member)
+    if errors.Is(err, zip.ErrFormat) {
+        if member != singleFileName(inFile) {
+            return fmt.Errorf("%w: %s", archive.ErrMemberNotFound, member)
+        }
+        _, err = io.Copy(w, io.NewSectionReader(pt, 0, size))
+        return err
+    } else if err != nil {
+        return err
+    }
+    defer rc.Close()
+
+    _, err = io.Copy(w, rc)
+    return err
+}
@@ -1,9 +1,7 @@
 package cmd
 
 import (
-	"bytes"
 	"ecrypto/archive"
-	"ecrypto/crypto"
 	"errors"
 	"fmt"
 	"os"
@@ -12,78 +10,106 @@ import (
 )
 
 var (
-    decInFile   string
-    decOutDir   string
-    decPass     string
-    decKeyFile  string
+    decInFile    string
+    decOutDir    string
+    decPass      passFlags
+    decKeyFile   string
+    decKeyShares []string
+    decIdentity  string
+    decInclude   []string
+    decExclude   []string
+    decLimits    = archive.DefaultLimits()
+    decOwner     bool
+    decTimes     bool
+    decSigner    string
+    decProgress  bool
 )
 
 var decryptCmd = &cobra.Command{
     Use:   "decrypt",
     Short: "Decrypt a .ecrypt container to a folder",
     Long: `Decrypt a .ecrypt container and extract to a folder.
-Use the same passphrase or key file used during encryption.`,
+Use the same passphrase or key file used during encryption, or --identity
+for containers encrypted to X25519 recipients. --key-share (repeatable)
+recombines a key split with keygen --shares in memory. --require-signer
+refuses containers that are not signed by the given Ed25519 public key;
+the signature is checked before anything is decrypted. The passphrase can
+come from --pass-file, --pass-fd, --pass-env or --pass-command, and is
+prompted for without echo when none is given.
+
+Use --include and --exclude (repeatable) to extract only some files, e.g.
+  ecrypto decrypt --in backup.ecrypt --out restore --pass ... \
+    --include 'docs/**/*.pdf' --exclude '*.tmp'
+A pattern without a slash matches file names at any depth; "**" matches any
+number of directories.
+
+Extraction refuses entries that would escape the output folder (absolute
+paths, ".." or symlinks) and stops at the --max-* limits; 0 disables a limit.
+
+Permissions, empty directories and symlinks are always restored. Use
+--preserve-times and --preserve-owner to also restore modification times
+and uid/gid (the latter usually requires root).
+
+--progress shows the phase, bytes written, throughput and an estimated time
+left on stderr while extracting.`,
     RunE: func(cmd *cobra.Command, args []string) error {
+        applyProfileKeys(cmd, &decPass, &decKeyFile, &decIdentity)
+        if decOutDir == "" && decInFile != "" {
+            decOutDir = DefaultDecryptOutput(decInFile)
+        }
         if decInFile == "" || decOutDir == "" {
             return errors.New("--in and --out are required")
         }
 
-        // Read container
-        fmt.Fprintf(os.Stderr, "Reading container...\n")
-        data, err := os.ReadFile(decInFile)
-        if err != nil {
+        filter := &archive.Filter{Include: decInclude, Exclude: decExclude}
+        if err := filter.Validate(); err != nil {
             return err
         }
 
-        // Parse header
-        h, err := crypto.DecodeHeaderV1(bytes.NewReader(data))
+        // Open container
+        fmt.Fprintf(os.Stderr, "Reading container...\n")
+        info, err := ReadContainerInfo(decInFile)
         if err != nil {
             return err
         }
+        fmt.Fprintf(os.Stderr, "Container version: %d, KDF: %d\n", info.Version, info.KDF)
 
-        headerLen := crypto.HeaderSize()
-        if len(data) < headerLen {
-            return errors.New("file too small to contain header")
-        }
-
-        fmt.Fprintf(os.Stderr, "Container version: %d, KDF: %d\n", h.Version, h.KDF)
-
-        var key []byte
-
-        // Derive or load key
-        if h.KDF == 1 {
-            if decPass == "" {
-                return errors.New("passphrase required (Argon2id)")
-            }
-            key = crypto.DeriveKeyArgon2id(decPass, h.Salt[:], h.ArgonM, h.ArgonT, h.ArgonP)
-            fmt.Fprintf(os.Stderr, "Derived key from passphrase\n")
-        } else {
-            if decKeyFile == "" {
-                return errors.New("key file required (raw key mode)")
+        resolveKey := containerKey(&decPass, decKeyFile, decIdentity)
+        if len(decKeyShares) > 0 {
+            if decKeyFile != "" || decIdentity != "" {
+                return errors.New("--key-share cannot be combined with --key-file or --identity")
             }
-            var err error
-            key, err = crypto.ReadKeyFromFile(decKeyFile)
+            key, err := combineKeyShares(decKeyShares)
             if err != nil {
                 return err
             }
-            fmt.Fprintf(os.Stderr, "Loaded 32-byte key from file\n")
+            resolveKey = rawKey(key)
         }
 
-        // Decrypt
-        fmt.Fprintf(os.Stderr, "Decrypting...\n")
-        aad := data[:headerLen]
-        ct := data[headerLen:]
-        pt, err := crypto.DecryptAEAD(key, ct, aad, h.Nonce[:])
-        if err != nil {
-            return err
+        if decSigner != "" {
+            resolveKey, err = requireSigner(decSigner, resolveKey)
+            if err != nil {
+                return err
+            }
         }
 
-        // Extract
-        fmt.Fprintf(os.Stderr, "Extracting...\n")
-        if err := os.MkdirAll(decOutDir, 0o755); err != nil {
-            return err
+        // Decrypt and extract
+        fmt.Fprintf(os.Stderr, "Decrypting and extracting...\n")
+        opts := archive.UnzipOptions{
+            Filter:       filter,
+            Limits:       &decLimits,
+            RestoreOwner: decOwner,
+            RestoreTimes: decTimes,
+        }
+        var stopProgress func()
+        if decProgress {
+            opts.Progress, stopProgress = startProgress(os.Stderr)
         }
-        if err := archive.UnzipTo(decOutDir, pt); err != nil {
+        err = decryptContainer(cmd.Context(), decInFile, decOutDir, resolveKey, opts)
+        if stopProgress != nil {
+            stopProgress()
+        }
+        if err != nil {
             return err
         }
 
@@ -96,6 +122,18 @@ func init() {
     rootCmd.AddCommand(decryptCmd)
     decryptCmd.Flags().StringVar(&decInFile, "in", "", "Input .ecrypt file")
     decryptCmd.Flags().StringVar(&decOutDir, "out", "", "Output folder")
-    decryptCmd.Flags().StringVar(&decPass, "pass", "", "Passphrase (Argon2id)")
+    addPassFlags(decryptCmd, &decPass)
     decryptCmd.Flags().StringVar(&decKeyFile, "key-file", "", "32-byte Base64(URL) key file")
+    decryptCmd.Flags().StringArrayVar(&decKeyShares, "key-share", nil, "Key share file from keygen --shares or split-key (repeatable)")
+    decryptCmd.Flags().StringVar(&decSigner, "require-signer", "", "Only decrypt if signed by this Ed25519 public key (or file)")
+    decryptCmd.Flags().StringVar(&decIdentity, "identity", "", "X25519 identity file (recipient containers)")
+    decryptCmd.Flags().StringArrayVar(&decInclude, "include", nil, "Only extract files matching this glob (repeatable)")
+    decryptCmd.Flags().StringArrayVar(&decExclude, "exclude", nil, "Skip files matching this glob (repeatable)")
+    decryptCmd.Flags().Int64Var(&decLimits.MaxTotalBytes, "max-size", decLimits.MaxTotalBytes, "Maximum total bytes to extract (0 = unlimited)")
+    decryptCmd.Flags().Int64Var(&decLimits.MaxFileBytes, "max-file-size", decLimits.MaxFileBytes, "Maximum bytes per extracted file (0 = unlimited)")
+    decryptCmd.Flags().IntVar(&decLimits.MaxEntries, "max-entries", decLimits.MaxEntries, "Maximum number of archive entries (0 = unlimited)")
+    decryptCmd.Flags().BoolVar(&decTimes, "preserve-times", false, "Restore file modification times")
+    decryptCmd.Flags().BoolVar(&decOwner, "preserve-owner", false, "Restore file uid/gid (usually requires root)")
+    decryptCmd.Flags().Int64Var(&decLimits.MaxRatio, "max-ratio", decLimits.MaxRatio, "Maximum compression ratio per file (0 = unlimited)")
+    decryptCmd.Flags().BoolVar(&decProgress, "progress", false, "Show byte-level progress with throughput and ETA")
 }
\ No newline at end of file
@@ -1,121 +1,261 @@
 package cmd
 
 import (
-	"crypto/rand"
+	"crypto/ed25519"
 	"ecrypto/archive"
 	"ecrypto/crypto"
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/spf13/cobra"
 )
 
 var (
-    encInDir   string
-    encOutFile string
-    encPass    string
-    encKeyFile string
-    encArgonM  uint32 = 256 * 1024 // 256 MB in KiB
-    encArgonT  uint32 = 3
-    encArgonP  uint8  = 1
+    encInDir      string
+    encOutFile    string
+    encPass       passFlags
+    encKeyFile    string
+    encKeyShares  []string
+    encTwoFactor  bool
+    encRecipients []string
+    encRecovery   []string
+    encSignKey    string
+    encArgonM     uint32 = 256 * 1024 // 256 MB in KiB
+    encArgonT     uint32 = 3
+    encArgonP     uint8  = 1
+    encArgonAuto  bool
+    encArgonGoal  = time.Second
+    encArgonMaxM  uint32 = defaultArgonMaxMemory
+    encInclude    []string
+    encExclude    []string
+    encDryRun     bool
+    encProgress   bool
 )
 
 var encryptCmd = &cobra.Command{
     Use:   "encrypt",
     Short: "Encrypt a folder into a .ecrypt container",
     Long: `Encrypt a folder into a secure .ecrypt container.
-Use --pass for passphrase (Argon2id KDF) or --key-file for a raw 32-byte key.`,
+Use --key-file for a raw 32-byte key or --recipient (repeatable) to encrypt
+to X25519 public keys. Otherwise a passphrase (Argon2id KDF) is used: read
+from --pass-file, --pass-fd, --pass-env or --pass-command, or prompted for
+without echo when none is given.
+
+Giving --key-file together with a passphrase source (or --two-factor, which
+prompts for the passphrase) protects the container with both: the key is
+derived from the Argon2id output and the key file via HKDF, and decrypting
+needs the passphrase and the key file.
+
+--recovery-pubkey (repeatable) adds a copy of the data key wrapped for an
+organization recovery key, so "ecrypto recover" can open the container if
+the passphrase or key is lost.
+
+--sign-key signs the container with an Ed25519 key from keygen --type
+ed25519, so that verify --signer-pubkey and decrypt --require-signer can
+check who created it.
+
+--key-share (repeatable) recombines a key split with keygen --shares or
+split-key in memory and uses it like --key-file.
+
+Argon2id parameters come from --argon-m/t/p, then from the profile, then
+from the config file (see benchmark-kdf --save), then from the built-in
+defaults. A profile can also supply the key file, recipients, passphrase
+source, include/exclude patterns and an output_dir used when --out is
+omitted. --argon-auto
+instead measures this machine and picks parameters that take about
+--argon-target within --argon-max-m KiB of memory.
+
+Files matching a .ecryptignore in the input folder or an --exclude pattern
+(gitignore syntax, repeatable) are skipped. With --include, only matching
+files are encrypted. --dry-run lists what would be encrypted and exits.
+
+--progress shows the phase, bytes processed, throughput and an estimated
+time left on stderr while encrypting.`,
     RunE: func(cmd *cobra.Command, args []string) error {
+        applyEncryptProfile(cmd)
+        if encDryRun {
+            if encInDir == "" {
+                return errors.New("--in is required")
+            }
+            return printDryRun(encInDir, encInclude, encExclude)
+        }
         if encInDir == "" || encOutFile == "" {
             return errors.New("--in and --out are required")
         }
 
-        // Initialize header
-        h := &crypto.HeaderV1{
-            Magic:   [8]byte{'E', 'C', 'R', 'Y', 'P', 'T', '0', '1'},
-            Version: 1,
-        }
-
+        var h *crypto.HeaderV2
         var key []byte
+        var err error
 
         // Derive or load key
-        if encPass != "" {
-            h.KDF = 1
-            if _, err := rand.Read(h.Salt[:]); err != nil {
+        if len(encRecipients) > 0 {
+            if encPass.given() || encKeyFile != "" || len(encKeyShares) > 0 {
+                return errors.New("--recipient cannot be combined with a passphrase or key")
+            }
+            h, key, err = newRecipientsHeader(encRecipients)
+            if err != nil {
                 return err
             }
-            key = crypto.DeriveKeyArgon2id(encPass, h.Salt[:], encArgonM, encArgonT, encArgonP)
-            h.ArgonM, h.ArgonT, h.ArgonP = encArgonM, encArgonT, encArgonP
-            fmt.Fprintf(os.Stderr, "Using Argon2id: m=%d, t=%d, p=%d\n", encArgonM, encArgonT, encArgonP)
-        } else if encKeyFile != "" {
-            h.KDF = 0
-            var err error
-            key, err = crypto.ReadKeyFromFile(encKeyFile)
+            fmt.Fprintf(os.Stderr, "Encrypting to %d recipient(s)\n", len(h.Stanzas))
+        } else if len(encKeyShares) > 0 {
+            if encPass.given() || encKeyFile != "" || encTwoFactor {
+                return errors.New("--key-share cannot be combined with a passphrase or --key-file")
+            }
+            shared, err := combineKeyShares(encKeyShares)
+            if err != nil {
+                return err
+            }
+            h, key, err = newWrappedHeader(keyStanza(shared))
+            if err != nil {
+                return err
+            }
+            fmt.Fprintf(os.Stderr, "Recombined 32-byte key from %d share(s)\n", len(encKeyShares))
+        } else if encTwoFactor && encKeyFile == "" {
+            return errors.New("--two-factor requires --key-file")
+        } else if encKeyFile != "" && !encPass.given() && !encTwoFactor {
+            h, key, err = newKeyFileHeader(encKeyFile)
             if err != nil {
                 return err
             }
             fmt.Fprintf(os.Stderr, "Loaded 32-byte key from file\n")
         } else {
-            return errors.New("provide --pass or --key-file")
+            pass, err := encPass.read(true)
+            if err != nil {
+                return err
+            }
+            if encArgonAuto {
+                err = autoArgon(cmd, encArgonGoal, encArgonMaxM, &encArgonM, &encArgonT, &encArgonP)
+            } else {
+                err = applySavedArgon(cmd, &encArgonM, &encArgonT, &encArgonP)
+            }
+            if err != nil {
+                return err
+            }
+            if encKeyFile != "" {
+                h, key, err = newTwoFactorHeader(pass, encKeyFile, encArgonM, encArgonT, encArgonP)
+            } else {
+                h, key, err = newPassphraseHeader(pass, encArgonM, encArgonT, encArgonP)
+            }
+            if err != nil {
+                return err
+            }
+            fmt.Fprintf(os.Stderr, "Using Argon2id: m=%d, t=%d, p=%d\n", encArgonM, encArgonT, encArgonP)
+            if encKeyFile != "" {
+                fmt.Fprintf(os.Stderr, "Two-factor: passphrase + key file required to decrypt\n")
+            }
         }
 
-        // Generate random nonce
-        if _, err := rand.Read(h.Nonce[:]); err != nil {
-            return err
+        var signKey ed25519.PrivateKey
+        if encSignKey != "" {
+            signKey, err = crypto.ReadEd25519SecretKey(encSignKey)
+            if err != nil {
+                return err
+            }
+            fmt.Fprintf(os.Stderr, "Signing as %s\n", crypto.EncodeEd25519PublicKey(signKey.Public().(ed25519.PublicKey)))
         }
 
-        // Zip folder
-        fmt.Fprintf(os.Stderr, "Compressing folder...\n")
-        zipBytes, err := archive.ZipFolder(encInDir)
-        if err != nil {
-            return err
+        if len(encRecovery) > 0 {
+            if err := addRecoveryStanzas(h, key, encRecovery); err != nil {
+                return err
+            }
+            fmt.Fprintf(os.Stderr, "Added recovery key stanza(s)\n")
         }
-        fmt.Fprintf(os.Stderr, "Compressed size: %d bytes\n", len(zipBytes))
 
-        // Encrypt
-        fmt.Fprintf(os.Stderr, "Encrypting...\n")
-        aad := h.Encode()
-        ct, err := crypto.EncryptAEAD(key, zipBytes, aad, h.Nonce[:])
-        if err != nil {
-            return err
+        // Compress and encrypt in a single streaming pass
+        fmt.Fprintf(os.Stderr, "Compressing and encrypting folder...\n")
+        opts := archive.ZipOptions{Include: encInclude, Exclude: encExclude}
+        var stopProgress func()
+        if encProgress {
+            opts.Progress, stopProgress = startProgress(os.Stderr)
+        }
+        err = encryptFolder(cmd.Context(), encInDir, encOutFile, h, key, signKey, opts)
+        if stopProgress != nil {
+            stopProgress()
         }
-
-        // Write to file (atomic: write to .tmp, then rename)
-        tmp := encOutFile + ".tmp"
-        f, err := os.Create(tmp)
         if err != nil {
             return err
         }
-        defer f.Close()
 
-        if _, err := f.Write(aad); err != nil {
-            return err
-        }
-        if _, err := f.Write(ct); err != nil {
-            return err
-        }
-        if err := f.Close(); err != nil {
-            return err
+        fmt.Fprintf(os.Stderr, "✓ Encrypted to: %s\n", encOutFile)
+        if st, err := os.Stat(encOutFile); err == nil {
+            fmt.Fprintf(os.Stderr, "  Encrypted size: %d bytes\n", st.Size())
         }
+        return nil
+    },
+}
 
-        if err := os.Rename(tmp, encOutFile); err != nil {
-            return err
+// applyEncryptProfile fills unset encrypt options from the active profile.
+// Profile patterns come before command-line ones, so the latter win.
+func applyEncryptProfile(c *cobra.Command) {
+    p := ActiveProfile()
+    if useProfileCredentials(c) {
+        if len(p.Recipients) > 0 {
+            encRecipients = p.Recipients
+        } else {
+            encKeyFile = p.KeyFile
+            encPass.applyProfile(p)
         }
+    }
+    encInclude = append(append([]string{}, p.Include...), encInclude...)
+    encExclude = append(append([]string{}, p.Exclude...), encExclude...)
+    if encOutFile == "" && encInDir != "" {
+        encOutFile = DefaultEncryptOutput(encInDir)
+    }
+}
 
-        fmt.Fprintf(os.Stderr, "✓ Encrypted to: %s\n", encOutFile)
-        fmt.Fprintf(os.Stderr, "  Encrypted size: %d bytes\n", len(aad)+len(ct))
+// printDryRun lists the entries of inDir that encrypt would archive.
+func printDryRun(inDir string, include, exclude []string) error {
+    filter, err := archive.NewPathFilter(inDir, include, exclude)
+    if err != nil {
+        return err
+    }
+
+    var files int
+    var total int64
+    err = archive.WalkFolder(inDir, filter, func(path, rel string, info fs.FileInfo) error {
+        switch {
+        case info.IsDir():
+            fmt.Printf("%12s  %s/\n", "dir", filepath.ToSlash(rel))
+        case info.Mode()&fs.ModeSymlink != 0:
+            fmt.Printf("%12s  %s\n", "link", filepath.ToSlash(rel))
+        default:
+            fmt.Printf("%12d  %s\n", info.Size(), filepath.ToSlash(rel))
+            files++
+            total += info.Size()
+        }
         return nil
-    },
+    })
+    if err != nil {
+        return err
+    }
+
+    fmt.Printf("%d file(s), %d bytes would be encrypted\n", files, total)
+    return nil
 }
 
 func init() {
     rootCmd.AddCommand(encryptCmd)
     encryptCmd.Flags().StringVar(&encInDir, "in", "", "Input folder to encrypt")
     encryptCmd.Flags().StringVar(&encOutFile, "out", "", "Output .ecrypt file")
-    encryptCmd.Flags().StringVar(&encPass, "pass", "", "Passphrase (Argon2id KDF)")
+    addPassFlags(encryptCmd, &encPass)
     encryptCmd.Flags().StringVar(&encKeyFile, "key-file", "", "32-byte Base64(URL) key file")
+    encryptCmd.Flags().StringArrayVar(&encKeyShares, "key-share", nil, "Key share file from keygen --shares or split-key (repeatable)")
+    encryptCmd.Flags().BoolVar(&encTwoFactor, "two-factor", false, "Require both the passphrase and --key-file to decrypt")
+    encryptCmd.Flags().StringArrayVar(&encRecipients, "recipient", nil, "X25519 recipient public key or file (repeatable)")
+    encryptCmd.Flags().StringArrayVar(&encRecovery, "recovery-pubkey", nil, "Organization recovery public key or file (repeatable)")
+    encryptCmd.Flags().StringVar(&encSignKey, "sign-key", "", "Ed25519 signing key file (keygen --type ed25519)")
     encryptCmd.Flags().Uint32Var(&encArgonM, "argon-m", encArgonM, "Argon2 memory (KiB)")
     encryptCmd.Flags().Uint32Var(&encArgonT, "argon-t", encArgonT, "Argon2 iterations")
     encryptCmd.Flags().Uint8Var(&encArgonP, "argon-p", encArgonP, "Argon2 parallelism")
+    encryptCmd.Flags().BoolVar(&encArgonAuto, "argon-auto", false, "Pick Argon2 parameters by measuring this machine")
+    encryptCmd.Flags().DurationVar(&encArgonGoal, "argon-target", encArgonGoal, "Time budget for --argon-auto")
+    encryptCmd.Flags().Uint32Var(&encArgonMaxM, "argon-max-m", encArgonMaxM, "Memory limit for --argon-auto (KiB)")
+    encryptCmd.Flags().StringArrayVar(&encInclude, "include", nil, "Only encrypt files matching this gitignore-style pattern (repeatable)")
+    encryptCmd.Flags().StringArrayVar(&encExclude, "exclude", nil, "Skip files matching this gitignore-style pattern (repeatable)")
+    encryptCmd.Flags().BoolVar(&encDryRun, "dry-run", false, "List the files that would be encrypted and exit")
+    encryptCmd.Flags().BoolVar(&encProgress, "progress", false, "Show byte-level progress with throughput and ETA")
 }
\ No newline at end of file
@@ -1,218 +1,78 @@
 package cmd
 
 import (
-	"bytes"
+	"context"
 	"crypto/rand"
 	"ecrypto/archive"
 	"ecrypto/crypto"
 	"encoding/base64"
 	"fmt"
-	"os"
-	"path/filepath"
-	"strings"
 )
 
-// EncryptWithPassphrase encrypts folder with passphrase
-func EncryptWithPassphrase(inDir, outFile, pass string, progressCallback archive.ProgressCallback) error {
-	h := &crypto.HeaderV1{
-		Magic:   [8]byte{'E', 'C', 'R', 'Y', 'P', 'T', '0', '1'},
-		Version: 1,
-		KDF:     1,
-	}
-
-	if _, err := rand.Read(h.Salt[:]); err != nil {
-		return err
-	}
-
-	key := crypto.DeriveKeyArgon2id(pass, h.Salt[:], encArgonM, encArgonT, encArgonP)
-	h.ArgonM, h.ArgonT, h.ArgonP = encArgonM, encArgonT, encArgonP
-
-	if _, err := rand.Read(h.Nonce[:]); err != nil {
-		return err
-	}
-
-	zipBytes, err := archive.ZipFolderWithProgress(inDir, progressCallback)
-	if err != nil {
-		return err
-	}
-
-	aad := h.Encode()
-	ct, err := crypto.EncryptAEAD(key, zipBytes, aad, h.Nonce[:])
+// EncryptWithPassphrase encrypts folder with passphrase. progress, if not
+// nil, receives byte-level progress. Cancelling ctx stops it and removes
+// the partial output, as for the other Encrypt* and Decrypt* wrappers.
+func EncryptWithPassphrase(ctx context.Context, inDir, outFile, pass string, progress archive.ProgressFunc) error {
+	m, t, p, err := currentArgon()
 	if err != nil {
 		return err
 	}
-
-	tmp := outFile + ".tmp"
-	f, err := os.Create(tmp)
+	h, key, err := newPassphraseHeader(pass, m, t, p)
 	if err != nil {
 		return err
 	}
-	if _, err := f.Write(aad); err != nil {
-		f.Close()
-		return err
-	}
-	if _, err := f.Write(ct); err != nil {
-		f.Close()
-		return err
-	}
-	if err := f.Close(); err != nil {
-		return err
-	}
-
-	return os.Rename(tmp, outFile)
+	return encryptFolder(ctx, inDir, outFile, h, key, nil, profileZipOptions(progress))
 }
 
 // EncryptWithKeyFile encrypts folder with key file
-func EncryptWithKeyFile(inDir, outFile, keyFile string, progressCallback archive.ProgressCallback) error {
-	h := &crypto.HeaderV1{
-		Magic:   [8]byte{'E', 'C', 'R', 'Y', 'P', 'T', '0', '1'},
-		Version: 1,
-		KDF:     0,
-	}
-
-	key, err := crypto.ReadKeyFromFile(keyFile)
-	if err != nil {
-		return err
-	}
-
-	if _, err := rand.Read(h.Nonce[:]); err != nil {
-		return err
-	}
-
-	zipBytes, err := archive.ZipFolderWithProgress(inDir, progressCallback)
-	if err != nil {
-		return err
-	}
-
-	aad := h.Encode()
-	ct, err := crypto.EncryptAEAD(key, zipBytes, aad, h.Nonce[:])
+func EncryptWithKeyFile(ctx context.Context, inDir, outFile, keyFile string, progress archive.ProgressFunc) error {
+	h, key, err := newKeyFileHeader(keyFile)
 	if err != nil {
 		return err
 	}
+	return encryptFolder(ctx, inDir, outFile, h, key, nil, profileZipOptions(progress))
+}
 
-	tmp := outFile + ".tmp"
-	f, err := os.Create(tmp)
+// EncryptWithRecipients encrypts folder to one or more X25519 recipients
+func EncryptWithRecipients(ctx context.Context, inDir, outFile string, recipients []string, progress archive.ProgressFunc) error {
+	h, key, err := newRecipientsHeader(recipients)
 	if err != nil {
 		return err
 	}
-	if _, err := f.Write(aad); err != nil {
-		f.Close()
-		return err
-	}
-	if _, err := f.Write(ct); err != nil {
-		f.Close()
-		return err
-	}
-	if err := f.Close(); err != nil {
-		return err
-	}
-
-	return os.Rename(tmp, outFile)
+	return encryptFolder(ctx, inDir, outFile, h, key, nil, profileZipOptions(progress))
 }
 
 // DecryptWithPassphrase decrypts file with passphrase
-func DecryptWithPassphrase(inFile, outDir, pass string, progressCallback archive.ProgressCallback) error {
-	data, err := os.ReadFile(inFile)
-	if err != nil {
-		return err
-	}
-
-	h, err := crypto.DecodeHeaderV1(bytes.NewReader(data))
-	if err != nil {
-		return err
-	}
-
-	key := crypto.DeriveKeyArgon2id(pass, h.Salt[:], h.ArgonM, h.ArgonT, h.ArgonP)
-
-	headerLen := crypto.HeaderSize()
-	aad := data[:headerLen]
-	ct := data[headerLen:]
-
-	pt, err := crypto.DecryptAEAD(key, ct, aad, h.Nonce[:])
-	if err != nil {
-		return err
-	}
-
-	if err := os.MkdirAll(outDir, 0o755); err != nil {
-		return err
-	}
-
-	// Try to unzip first (for folder encryption)
-	err = archive.UnzipToWithProgress(outDir, pt, progressCallback)
-	if err != nil {
-		// If unzip fails, it's likely a single file encryption
-		// Extract original filename from input file (remove .ecrypt extension)
-		originalName := filepath.Base(inFile)
-		if strings.HasSuffix(originalName, ".ecrypt") {
-			originalName = strings.TrimSuffix(originalName, ".ecrypt")
-		}
-		
-		// Write decrypted data as a single file
-		outputPath := filepath.Join(outDir, originalName)
-		if writeErr := os.WriteFile(outputPath, pt, 0o644); writeErr != nil {
-			return fmt.Errorf("failed to unzip and failed to write as file: %v (original unzip error: %v)", writeErr, err)
-		}
-		
-		if progressCallback != nil {
-			progressCallback(originalName)
-		}
-	}
-	
-	return nil
+func DecryptWithPassphrase(ctx context.Context, inFile, outDir, pass string, progress archive.ProgressFunc) error {
+	return decryptContainer(ctx, inFile, outDir, passphraseKey(pass), archive.UnzipOptions{Progress: progress})
 }
 
 // DecryptWithKeyFile decrypts file with key file
-func DecryptWithKeyFile(inFile, outDir, keyFile string, progressCallback archive.ProgressCallback) error {
-	data, err := os.ReadFile(inFile)
-	if err != nil {
-		return err
-	}
-
-	h, err := crypto.DecodeHeaderV1(bytes.NewReader(data))
-	if err != nil {
-		return err
-	}
-
-	key, err := crypto.ReadKeyFromFile(keyFile)
-	if err != nil {
-		return err
-	}
+func DecryptWithKeyFile(ctx context.Context, inFile, outDir, keyFile string, progress archive.ProgressFunc) error {
+	return decryptContainer(ctx, inFile, outDir, keyFileKey(keyFile), archive.UnzipOptions{Progress: progress})
+}
 
-	headerLen := crypto.HeaderSize()
-	aad := data[:headerLen]
-	ct := data[headerLen:]
+// DecryptWithTwoFactor decrypts a container protected by both a passphrase
+// and a key file
+func DecryptWithTwoFactor(ctx context.Context, inFile, outDir, pass, keyFile string, progress archive.ProgressFunc) error {
+	return decryptContainer(ctx, inFile, outDir, twoFactorKey(pass, keyFile), archive.UnzipOptions{Progress: progress})
+}
 
-	pt, err := crypto.DecryptAEAD(key, ct, aad, h.Nonce[:])
-	if err != nil {
-		return err
-	}
+// DecryptWithIdentity decrypts file with an X25519 identity file
+func DecryptWithIdentity(ctx context.Context, inFile, outDir, identityFile string, progress archive.ProgressFunc) error {
+	return decryptContainer(ctx, inFile, outDir, identityKey(identityFile), archive.UnzipOptions{Progress: progress})
+}
 
-	if err := os.MkdirAll(outDir, 0o755); err != nil {
-		return err
-	}
+// ListContents lists the files in a container without extracting them.
+// Supply whichever of pass, keyFile or identityFile the container needs.
+func ListContents(inFile, pass, keyFile, identityFile string) (*archive.Manifest, error) {
+	return readManifest(inFile, credentialsKey(pass, keyFile, identityFile))
+}
 
-	// Try to unzip first (for folder encryption)
-	err = archive.UnzipToWithProgress(outDir, pt, progressCallback)
-	if err != nil {
-		// If unzip fails, it's likely a single file encryption
-		// Extract original filename from input file (remove .ecrypt extension)
-		originalName := filepath.Base(inFile)
-		if strings.HasSuffix(originalName, ".ecrypt") {
-			originalName = strings.TrimSuffix(originalName, ".ecrypt")
-		}
-		
-		// Write decrypted data as a single file
-		outputPath := filepath.Join(outDir, originalName)
-		if writeErr := os.WriteFile(outputPath, pt, 0o644); writeErr != nil {
-			return fmt.Errorf("failed to unzip and failed to write as file: %v (original unzip error: %v)", writeErr, err)
-		}
-		
-		if progressCallback != nil {
-			progressCallback(originalName)
-		}
-	}
-	
-	return nil
+// VerifyContents authenticates every chunk of a container and checks the
+// archive inside it without writing plaintext. Failures are *VerifyError.
+func VerifyContents(inFile, pass, keyFile, identityFile string) (*VerifyResult, error) {
+	return verifyContainer(inFile, nil, credentialsKey(pass, keyFile, identityFile))
 }
 
 // GenerateKey creates a random 32-byte key
@@ -224,145 +84,154 @@ func GenerateKey() (string, error) {
 	return base64.RawURLEncoding.EncodeToString(key), nil
 }
 
-// InfoPrint prints container info
-func InfoPrint(inFile string) error {
-	data, err := os.ReadFile(inFile)
-	if err != nil {
-		return err
+// ContainerInfo describes a container header without decrypting it.
+type ContainerInfo struct {
+	Magic         string
+	Version       uint8
+	KDF           uint8
+	KDFName       string
+	ArgonM        uint32
+	ArgonT        uint32
+	ArgonP        uint8
+	ChunkSize     uint32
+	Recipients    int
+	HasPassphrase bool
+	HasKeyFile    bool
+	HasTwoFactor  bool
+	Recovery      int
+	Signer        string
+	Size          int64
+	HeaderSize    int
+	EncryptedSize int64
+	Extensions    []crypto.Extension
+}
+
+// ReadContainerInfo reads the header of a container of any supported version.
+func ReadContainerInfo(inFile string) (*ContainerInfo, error) {
+	c, err := openContainer(inFile)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	info := &ContainerInfo{
+		Magic:         "ECRYPT01",
+		Version:       c.Version(),
+		KDF:           c.KDF(),
+		KDFName:       kdfName(c.KDF()),
+		Recipients:    c.stanzaCount(crypto.StanzaX25519),
+		HasPassphrase: c.stanzaCount(crypto.StanzaArgon2id) > 0,
+		HasKeyFile:    c.stanzaCount(crypto.StanzaKeyFile) > 0,
+		HasTwoFactor:  c.stanzaCount(crypto.StanzaTwoFactor) > 0,
+		Recovery:      c.stanzaCount(crypto.StanzaRecovery),
+		Size:          c.size,
+		HeaderSize:    c.HeaderSize(),
+		EncryptedSize: c.payloadSize(),
+	}
+	info.ArgonM, info.ArgonT, info.ArgonP = c.ArgonParams()
+	if c.v2 != nil {
+		info.ChunkSize = c.v2.ChunkSize
+		info.Extensions = c.v2.Extensions
+		if pub, ok := c.v2.Signer(); ok {
+			info.Signer = crypto.EncodeEd25519PublicKey(pub)
+		}
 	}
+	return info, nil
+}
 
-	h, err := crypto.DecodeHeaderV1(bytes.NewReader(data))
+// InfoPrint prints container info
+func InfoPrint(inFile string) error {
+	info, err := ReadContainerInfo(inFile)
 	if err != nil {
 		return err
 	}
 
 	fmt.Printf("Container: %s\n", inFile)
-	fmt.Printf("Magic: %s\n", string(h.Magic[:]))
-	fmt.Printf("Version: %d\n", h.Version)
+	fmt.Printf("Magic: %s\n", info.Magic)
+	fmt.Printf("Version: %d\n", info.Version)
+	fmt.Printf("KDF: %s\n", info.KDFName)
 
-	kdfName := "Raw Key"
-	if h.KDF == 1 {
-		kdfName = "Argon2id"
+	if info.KDF == crypto.KDFArgon2id || info.HasPassphrase || info.HasTwoFactor {
+		if info.HasPassphrase {
+			fmt.Printf("  Passphrase: Argon2id\n")
+		}
+		if info.HasTwoFactor {
+			fmt.Printf("  Two-factor: Argon2id passphrase + key file (HKDF-SHA256)\n")
+		}
+		fmt.Printf("  Memory: %d KiB\n", info.ArgonM)
+		fmt.Printf("  Time: %d iterations\n", info.ArgonT)
+		fmt.Printf("  Parallelism: %d\n", info.ArgonP)
 	}
-	fmt.Printf("KDF: %s\n", kdfName)
-
-	if h.KDF == 1 {
-		fmt.Printf("  Memory: %d KiB\n", h.ArgonM)
-		fmt.Printf("  Time: %d iterations\n", h.ArgonT)
-		fmt.Printf("  Parallelism: %d\n", h.ArgonP)
+	if info.HasKeyFile {
+		fmt.Printf("  Key file: yes\n")
 	}
-
-	fmt.Printf("Total file size: %d bytes\n", len(data))
-	fmt.Printf("Header size: %d bytes\n", crypto.HeaderSize())
-	fmt.Printf("Encrypted data size: %d bytes\n", len(data)-crypto.HeaderSize())
-
-	return nil
-}
-
-// EncryptFileWithPassphrase encrypts a single file with passphrase
-func EncryptFileWithPassphrase(filePath, outFile, pass string, progressCallback archive.ProgressCallback) error {
-	h := &crypto.HeaderV1{
-		Magic:   [8]byte{'E', 'C', 'R', 'Y', 'P', 'T', '0', '1'},
-		Version: 1,
-		KDF:     1,
+	if info.Recipients > 0 {
+		fmt.Printf("  Recipients: %d\n", info.Recipients)
 	}
-
-	if _, err := rand.Read(h.Salt[:]); err != nil {
-		return err
+	if info.Recovery > 0 {
+		fmt.Printf("  Recovery key: yes (%d stanza(s))\n", info.Recovery)
+	} else if info.KDF == crypto.KDFWrapped {
+		fmt.Printf("  Recovery key: no\n")
 	}
-
-	key := crypto.DeriveKeyArgon2id(pass, h.Salt[:], encArgonM, encArgonT, encArgonP)
-	h.ArgonM, h.ArgonT, h.ArgonP = encArgonM, encArgonT, encArgonP
-
-	if _, err := rand.Read(h.Nonce[:]); err != nil {
-		return err
+	if info.Signer != "" {
+		fmt.Printf("Signed by: %s (not verified; use verify --signer-pubkey)\n", info.Signer)
 	}
-
-	// Read file
-	fileData, err := os.ReadFile(filePath)
-	if err != nil {
-		return err
+	if info.ChunkSize > 0 {
+		fmt.Printf("Chunk size: %d bytes\n", info.ChunkSize)
 	}
-
-	if progressCallback != nil {
-		progressCallback(filepath.Base(filePath))
+	for _, ext := range info.Extensions {
+		kind := "optional"
+		if ext.Critical {
+			kind = "critical"
+		}
+		fmt.Printf("Extension: %s, %s, %d bytes\n", crypto.ExtensionName(ext.Type), kind, len(ext.Value))
 	}
 
-	aad := h.Encode()
-	ct, err := crypto.EncryptAEAD(key, fileData, aad, h.Nonce[:])
-	if err != nil {
-		return err
-	}
+	fmt.Printf("Total file size: %d bytes\n", info.Size)
+	fmt.Printf("Header size: %d bytes\n", info.HeaderSize)
+	fmt.Printf("Encrypted data size: %d bytes\n", info.EncryptedSize)
 
-	tmp := outFile + ".tmp"
-	f, err := os.Create(tmp)
-	if err != nil {
-		return err
-	}
-	if _, err := f.Write(aad); err != nil {
-		f.Close()
-		return err
-	}
-	if _, err := f.Write(ct); err != nil {
-		f.Close()
-		return err
-	}
-	if err := f.Close(); err != nil {
-		return err
-	}
-
-	return os.Rename(tmp, outFile)
+	return nil
 }
 
-// EncryptFileWithKeyFile encrypts a single file with key file
-func EncryptFileWithKeyFile(filePath, outFile, keyFile string, progressCallback archive.ProgressCallback) error {
-	h := &crypto.HeaderV1{
-		Magic:   [8]byte{'E', 'C', 'R', 'Y', 'P', 'T', '0', '1'},
-		Version: 1,
-		KDF:     0,
-	}
-
-	key, err := crypto.ReadKeyFromFile(keyFile)
+// EncryptFileWithPassphrase encrypts a single file with passphrase
+func EncryptFileWithPassphrase(ctx context.Context, filePath, outFile, pass string, progress archive.ProgressFunc) error {
+	m, t, p, err := currentArgon()
 	if err != nil {
 		return err
 	}
-
-	if _, err := rand.Read(h.Nonce[:]); err != nil {
+	h, key, err := newPassphraseHeader(pass, m, t, p)
+	if err != nil {
 		return err
 	}
+	return encryptFile(ctx, filePath, outFile, h, key, progress)
+}
 
-	// Read file
-	fileData, err := os.ReadFile(filePath)
+// EncryptFileWithRecipients encrypts a single file to one or more X25519
+// recipients
+func EncryptFileWithRecipients(ctx context.Context, filePath, outFile string, recipients []string, progress archive.ProgressFunc) error {
+	h, key, err := newRecipientsHeader(recipients)
 	if err != nil {
 		return err
 	}
+	return encryptFile(ctx, filePath, outFile, h, key, progress)
+}
 
-	if progressCallback != nil {
-		progressCallback(filepath.Base(filePath))
-	}
-
-	aad := h.Encode()
-	ct, err := crypto.EncryptAEAD(key, fileData, aad, h.Nonce[:])
+// EncryptFileWithKeyFile encrypts a single file with key file
+func EncryptFileWithKeyFile(ctx context.Context, filePath, outFile, keyFile string, progress archive.ProgressFunc) error {
+	h, key, err := newKeyFileHeader(keyFile)
 	if err != nil {
 		return err
 	}
+	return encryptFile(ctx, filePath, outFile, h, key, progress)
+}
 
-	tmp := outFile + ".tmp"
-	f, err := os.Create(tmp)
+// GenerateX25519Identity creates a new X25519 identity and returns the
+// identity and recipient strings
+func GenerateX25519Identity() (identity, recipient string, err error) {
+	id, pub, err := crypto.GenerateX25519()
 	if err != nil {
-		return err
+		return "", "", err
 	}
-	if _, err := f.Write(aad); err != nil {
-		f.Close()
-		return err
-	}
-	if _, err := f.Write(ct); err != nil {
-		f.Close()
-		return err
-	}
-	if err := f.Close(); err != nil {
-		return err
-	}
-
-	return os.Rename(tmp, outFile)
+	return crypto.EncodeX25519Identity(id), crypto.EncodeX25519Recipient(pub), nil
 }
@@ -4,25 +4,70 @@ import (
 	"crypto/rand"
 	"ecrypto/crypto"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/spf13/cobra"
 )
 
-var keygenOutFile string
+var (
+    keygenOutFile string
+    keygenType    string
+    keygenShares  int
+    keygenThresh  int
+)
 
 var keygenCmd = &cobra.Command{
     Use:   "keygen",
     Short: "Generate a random 32-byte encryption key",
     Long: `Generate a random 32-byte key and print it in Base64URL format.
-Optionally save to a file with --out.`,
+Optionally save to a file with --out.
+
+Use --type x25519 to generate a public-key identity instead. The identity
+(private key) is printed or saved with --out, and the matching recipient
+(public key) is printed to stderr for use with encrypt --recipient.
+
+Use --type ed25519 to generate a signing key for encrypt --sign-key. The
+public key printed to stderr is what others pass to verify --signer-pubkey
+or decrypt --require-signer.
+
+Use --shares N --threshold M with --out BASE to split a new symmetric key
+into N share files (BASE.share1 ... BASE.shareN) of which any M recombine
+it. The key itself is neither printed nor saved; pass M share files to
+encrypt or decrypt with --key-share. Each share records the split it
+belongs to and a checksum, so corrupted, mismatched or too few shares are
+reported instead of producing a wrong key. Use split-key to split a key
+file you already have, and combine-key to turn shares back into one.`,
     RunE: func(cmd *cobra.Command, args []string) error {
+        sharing := cmd.Flags().Changed("shares") || cmd.Flags().Changed("threshold")
+        switch keygenType {
+        case "", "symmetric":
+        case "x25519", "ed25519":
+            if sharing {
+                return errors.New("--shares only applies to symmetric keys")
+            }
+            if keygenType == "ed25519" {
+                return keygenEd25519()
+            }
+            return keygenX25519()
+        default:
+            return fmt.Errorf("unknown key type %q (use symmetric, x25519 or ed25519)", keygenType)
+        }
+
         key := make([]byte, crypto.KeySize())
         if _, err := rand.Read(key); err != nil {
             return err
         }
 
+        if sharing {
+            if keygenOutFile == "" {
+                return errors.New("--shares requires --out as the base name for the share files")
+            }
+            return writeKeyShares(key, keygenShares, keygenThresh, keygenOutFile)
+        }
+
         encoded := base64.RawURLEncoding.EncodeToString(key)
         fmt.Println(encoded)
 
@@ -37,7 +82,56 @@ Optionally save to a file with --out.`,
     },
 }
 
+// keygenX25519 generates an X25519 identity file and prints its recipient.
+func keygenX25519() error {
+    identity, recipient, err := GenerateX25519Identity()
+    if err != nil {
+        return err
+    }
+
+    content := fmt.Sprintf("# created: %s\n# public key: %s\n%s\n",
+        time.Now().Format(time.RFC3339), recipient, identity)
+
+    if keygenOutFile == "" {
+        fmt.Print(content)
+    } else {
+        if err := os.WriteFile(keygenOutFile, []byte(content), 0o600); err != nil {
+            return err
+        }
+        fmt.Fprintf(os.Stderr, "✓ Identity saved to: %s\n", keygenOutFile)
+    }
+    fmt.Fprintf(os.Stderr, "Public key: %s\n", recipient)
+    return nil
+}
+
+// keygenEd25519 generates an Ed25519 signing key file and prints its
+// public key.
+func keygenEd25519() error {
+    priv, pub, err := crypto.GenerateEd25519()
+    if err != nil {
+        return err
+    }
+    public := crypto.EncodeEd25519PublicKey(pub)
+
+    content := fmt.Sprintf("# created: %s\n# public key: %s\n%s\n",
+        time.Now().Format(time.RFC3339), public, crypto.EncodeEd25519SecretKey(priv))
+
+    if keygenOutFile == "" {
+        fmt.Print(content)
+    } else {
+        if err := os.WriteFile(keygenOutFile, []byte(content), 0o600); err != nil {
+            return err
+        }
+        fmt.Fprintf(os.Stderr, "✓ Signing key saved to: %s\n", keygenOutFile)
+    }
+    fmt.Fprintf(os.Stderr, "Public key: %s\n", public)
+    return nil
+}
+
 func init() {
     rootCmd.AddCommand(keygenCmd)
     keygenCmd.Flags().StringVar(&keygenOutFile, "out", "", "Output key file (optional)")
-}
\ No newline at end of file
+    keygenCmd.Flags().StringVar(&keygenType, "type", "symmetric", "Key type: symmetric, x25519 or ed25519")
+    keygenCmd.Flags().IntVar(&keygenShares, "shares", 0, "Split the key into this many share files")
+    keygenCmd.Flags().IntVar(&keygenThresh, "threshold", 0, "Number of shares needed to recombine the key")
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"ecrypto/crypto"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// writeKeyShares splits key into n shares, any threshold of which recombine
+// it, and writes share i to base.share<i>.
+func writeKeyShares(key []byte, n, threshold int, base string) error {
+    shares, err := crypto.SplitKey(key, n, threshold)
+    if err != nil {
+        return err
+    }
+    for _, s := range shares {
+        path := fmt.Sprintf("%s.share%d", base, s.Index)
+        content := fmt.Sprintf("# ecrypto key share %d of %d (any %d recombine the key)\n# id: %s\n%s\n",
+            s.Index, s.Total, s.Threshold, s.ID(), s.Encode())
+        if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+            return err
+        }
+        fmt.Fprintf(os.Stderr, "✓ Share %s saved to: %s\n", s.ID(), path)
+    }
+    return nil
+}
+
+// combineKeyShares reads the share files in paths and recombines the key
+// in memory.
+func combineKeyShares(paths []string) ([]byte, error) {
+    shares := make([]crypto.KeyShare, 0, len(paths))
+    for _, path := range paths {
+        s, err := crypto.ReadKeyShareFile(path)
+        if err != nil {
+            return nil, err
+        }
+        fmt.Fprintf(os.Stderr, "Loaded key share %s from %s\n", s.ID(), path)
+        shares = append(shares, s)
+    }
+    key, err := crypto.CombineKeyShares(shares)
+    if err != nil {
+        return nil, err
+    }
+    if len(key) != crypto.KeySize() {
+        return nil, errors.New("combined key must be exactly 32 bytes")
+    }
+    return key, nil
+}
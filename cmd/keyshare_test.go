@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"ecrypto/crypto"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSplitCombineKey(t *testing.T) {
+    dir := t.TempDir()
+    keyFile := writeTestKey(t, dir)
+    if err := splitKey(keyFile, 5, 3, filepath.Join(dir, "dr")); err != nil {
+        t.Fatal(err)
+    }
+    share := func(i string) string { return filepath.Join(dir, "dr.share"+i) }
+
+    out := filepath.Join(dir, "combined.key")
+    if err := combineKey([]string{share("5"), share("1"), share("3")}, out); err != nil {
+        t.Fatal(err)
+    }
+    want, err := crypto.ReadKeyFromFile(keyFile)
+    if err != nil {
+        t.Fatal(err)
+    }
+    got, err := crypto.ReadKeyFromFile(out)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if string(got) != string(want) {
+        t.Error("combined key differs from the key file")
+    }
+
+    os.Remove(out)
+    if err := combineKey([]string{share("1"), share("2")}, out); !errors.Is(err, crypto.ErrNotEnoughShares) {
+        t.Errorf("two shares: error = %v, want ErrNotEnoughShares", err)
+    }
+    if _, err := os.Stat(out); !errors.Is(err, os.ErrNotExist) {
+        t.Error("key file written from too few shares")
+    }
+}
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+    listInFile   string
+    listPass     passFlags
+    listKeyFile  string
+    listIdentity string
+    listJSON     bool
+)
+
+var listCmd = &cobra.Command{
+    Use:   "list",
+    Short: "List the files in a .ecrypt container without extracting",
+    Long: `Decrypt only the ZIP central directory of a container and print the
+path, size and modification time of every file. Nothing is written to disk.`,
+    RunE: func(cmd *cobra.Command, args []string) error {
+        if listInFile == "" {
+            return errors.New("--in is required")
+        }
+
+        applyProfileKeys(cmd, &listPass, &listKeyFile, &listIdentity)
+        resolveKey := containerKey(&listPass, listKeyFile, listIdentity)
+        m, err := readManifest(listInFile, resolveKey)
+        if err != nil {
+            return err
+        }
+
+        if listJSON {
+            enc := json.NewEncoder(os.Stdout)
+            enc.SetIndent("", "  ")
+            return enc.Encode(m)
+        }
+
+        fmt.Printf("%12s  %-16s  %s\n", "SIZE", "MODIFIED", "PATH")
+        for _, f := range m.Files {
+            mtime := "-"
+            if f.Mtime != 0 {
+                mtime = time.Unix(f.Mtime, 0).Format("2006-01-02 15:04")
+            }
+            fmt.Printf("%12d  %-16s  %s\n", f.Size, mtime, f.Name)
+        }
+        fmt.Printf("%d file(s), %d bytes\n", len(m.Files), m.TotalSize())
+        return nil
+    },
+}
+
+func init() {
+    rootCmd.AddCommand(listCmd)
+    listCmd.Flags().StringVar(&listInFile, "in", "", "Input .ecrypt file")
+    addPassFlags(listCmd, &listPass)
+    listCmd.Flags().StringVar(&listKeyFile, "key-file", "", "32-byte Base64(URL) key file")
+    listCmd.Flags().StringVar(&listIdentity, "identity", "", "X25519 identity file (recipient containers)")
+    listCmd.Flags().BoolVar(&listJSON, "json", false, "Print the listing as JSON")
+}
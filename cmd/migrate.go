@@ -0,0 +1,276 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"ecrypto/crypto"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+    migInFile   string
+    migOutFile  string
+    migDir      string
+    migReplace  bool
+    migPass     passFlags
+    migKeyFile  string
+    migIdentity string
+)
+
+var migrateCmd = &cobra.Command{
+    Use:   "migrate",
+    Short: "Upgrade containers to the current format",
+    Long: `Re-encrypt older .ecrypt containers into the current format.
+
+The payload is decrypted with the existing credentials and streamed into a
+new container that is unlocked the same way: a passphrase container keeps
+its passphrase and Argon2 settings, a key file container its key file, and
+a wrapped-key container all of its passphrase, key file and recipient
+stanzas. The new container is decrypted again and compared with the
+original before it is put in place.
+
+  ecrypto migrate --in old.ecrypt --out new.ecrypt --pass-env PASS
+  ecrypto migrate --in old.ecrypt --replace --key-file backup.key
+  ecrypto migrate --dir /backups --replace --key-file backup.key
+
+With --dir every .ecrypt file below the folder is migrated, either in place
+(--replace) or into the same relative path under --out. Containers already
+in the current format are skipped.`,
+    SilenceUsage: true,
+    RunE: func(cmd *cobra.Command, args []string) error {
+        applyProfileKeys(cmd, &migPass, &migKeyFile, &migIdentity)
+        if (migInFile == "") == (migDir == "") {
+            return errors.New("provide exactly one of --in or --dir")
+        }
+        if (migOutFile == "") == !migReplace {
+            return errors.New("provide exactly one of --out or --replace")
+        }
+
+        creds := &migrateCreds{pf: &migPass, keyFile: migKeyFile, identity: migIdentity}
+        if migInFile != "" {
+            out := migOutFile
+            if migReplace {
+                out = migInFile
+            }
+            migrated, err := migrateContainer(migInFile, out, creds)
+            if err != nil {
+                return err
+            }
+            if !migrated {
+                fmt.Fprintf(os.Stderr, "%s is already in the current format\n", migInFile)
+            }
+            return nil
+        }
+        return migrateDir(migDir, migOutFile, creds)
+    },
+}
+
+// migrateCreds are the credentials used to open every container being
+// migrated. The passphrase is read at most once, when first needed.
+type migrateCreds struct {
+    pf       *passFlags
+    keyFile  string
+    identity string
+    pass     string
+}
+
+// resolver returns the key resolver for c.
+func (mc *migrateCreds) resolver(c *container) (func(c *container) ([]byte, error), error) {
+    if mc.pass == "" {
+        pass, err := mc.pf.forContainer(c, mc.keyFile, mc.identity)
+        if err != nil {
+            return nil, err
+        }
+        mc.pass = pass
+    }
+    return keyResolver(c.KDF(), mc.pass, mc.keyFile, mc.identity)
+}
+
+// migrateDir migrates every .ecrypt file below dir, in place or into the
+// same relative path below outDir. It carries on after failures and
+// reports how many containers failed.
+func migrateDir(dir, outDir string, creds *migrateCreds) error {
+    var migrated, skipped, failed int
+    err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+        if err != nil {
+            return err
+        }
+        if d.IsDir() || !strings.HasSuffix(d.Name(), ".ecrypt") {
+            return nil
+        }
+
+        out := path
+        if outDir != "" {
+            rel, err := filepath.Rel(dir, path)
+            if err != nil {
+                return err
+            }
+            out = filepath.Join(outDir, rel)
+            if err := os.MkdirAll(filepath.Dir(out), 0o755); err != nil {
+                return err
+            }
+        }
+
+        ok, err := migrateContainer(path, out, creds)
+        switch {
+        case err != nil:
+            fmt.Fprintf(os.Stderr, "✗ %s: %v\n", path, err)
+            failed++
+        case ok:
+            migrated++
+        default:
+            skipped++
+        }
+        return nil
+    })
+    if err != nil {
+        return err
+    }
+
+    fmt.Fprintf(os.Stderr, "%d migrated, %d already current, %d failed\n", migrated, skipped, failed)
+    if failed > 0 {
+        return fmt.Errorf("%d container(s) could not be migrated", failed)
+    }
+    return nil
+}
+
+// migrateContainer re-encrypts inFile into the current format at outFile,
+// which may be inFile itself. It reports false without writing anything if
+// inFile is already current.
+func migrateContainer(inFile, outFile string, creds *migrateCreds) (bool, error) {
+    c, err := openContainer(inFile)
+    if err != nil {
+        return false, err
+    }
+    defer c.Close()
+
+    if c.Version() >= crypto.CurrentVersion {
+        return false, nil
+    }
+    if c.sig != nil {
+        // Rewriting the payload would drop the signature.
+        return false, errors.New("container is signed; decrypt and encrypt it again with --sign-key to upgrade it")
+    }
+    fmt.Fprintf(os.Stderr, "Migrating %s (v%d → v%d)...\n", inFile, c.Version(), crypto.CurrentVersion)
+
+    resolveKey, err := creds.resolver(c)
+    if err != nil {
+        return false, err
+    }
+    key, err := resolveKey(c)
+    if err != nil {
+        return false, err
+    }
+    pt, size, err := c.plaintext(key)
+    if err != nil {
+        return false, err
+    }
+
+    h, fileKey, err := migratedHeader(c, key, creds.pass)
+    if err != nil {
+        return false, err
+    }
+
+    // Write next to the destination, check it, then move it into place.
+    staging := outFile + ".migrating"
+    sum := sha256.New()
+    err = writeContainer(context.Background(), staging, h, fileKey, nil, func(w io.Writer) error {
+        _, err := io.Copy(w, io.TeeReader(io.NewSectionReader(pt, 0, size), sum))
+        return err
+    })
+    if err != nil {
+        return false, err
+    }
+    if err := checkMigrated(staging, creds, sum.Sum(nil)); err != nil {
+        os.Remove(staging)
+        return false, fmt.Errorf("verifying migrated container: %w", err)
+    }
+
+    if st, err := c.file.Stat(); err == nil {
+        os.Chmod(staging, st.Mode().Perm())
+    }
+    // Release the source before replacing it (required on Windows).
+    c.Close()
+    if err := os.Rename(staging, outFile); err != nil {
+        os.Remove(staging)
+        return false, err
+    }
+    fmt.Fprintf(os.Stderr, "✓ Migrated: %s\n", outFile)
+    return true, nil
+}
+
+// migratedHeader returns a current-format header that unlocks the same way
+// as c, and the file key to encrypt the payload with. key is c's key and
+// pass the passphrase used to open it, if any.
+func migratedHeader(c *container, key []byte, pass string) (*crypto.HeaderV2, []byte, error) {
+    switch c.KDF() {
+    case crypto.KDFWrapped:
+        // Keep the file key so every existing stanza stays valid.
+        h, err := newStreamHeader(crypto.KDFWrapped)
+        if err != nil {
+            return nil, nil, err
+        }
+        h.Stanzas = c.Stanzas()
+        return h, key, nil
+    case crypto.KDFArgon2id:
+        m, t, p := c.ArgonParams()
+        return newWrappedHeader(func(fileKey []byte) (crypto.Stanza, error) {
+            return crypto.WrapKeyArgon2id(fileKey, pass, m, t, p)
+        })
+    default:
+        return newWrappedHeader(func(fileKey []byte) (crypto.Stanza, error) {
+            return crypto.WrapKeyWithKey(fileKey, key)
+        })
+    }
+}
+
+// checkMigrated opens a migrated container with the same credentials,
+// decrypts all of it and compares the plaintext with want (a SHA-256).
+func checkMigrated(path string, creds *migrateCreds, want []byte) error {
+    c, err := openContainer(path)
+    if err != nil {
+        return err
+    }
+    defer c.Close()
+
+    resolveKey, err := creds.resolver(c)
+    if err != nil {
+        return err
+    }
+    key, err := resolveKey(c)
+    if err != nil {
+        return err
+    }
+    pt, size, err := c.plaintext(key)
+    if err != nil {
+        return err
+    }
+    sum := sha256.New()
+    if _, err := io.Copy(sum, io.NewSectionReader(pt, 0, size)); err != nil {
+        return err
+    }
+    if !bytes.Equal(sum.Sum(nil), want) {
+        return errors.New("plaintext does not match the original")
+    }
+    return nil
+}
+
+func init() {
+    rootCmd.AddCommand(migrateCmd)
+    migrateCmd.Flags().StringVar(&migInFile, "in", "", "Container to migrate")
+    migrateCmd.Flags().StringVar(&migOutFile, "out", "", "Output file (with --in) or folder (with --dir)")
+    migrateCmd.Flags().StringVar(&migDir, "dir", "", "Migrate every .ecrypt file below this folder")
+    migrateCmd.Flags().BoolVar(&migReplace, "replace", false, "Replace the originals once the output is verified")
+    addPassFlags(migrateCmd, &migPass)
+    migrateCmd.Flags().StringVar(&migKeyFile, "key-file", "", "32-byte Base64(URL) key file")
+    migrateCmd.Flags().StringVar(&migIdentity, "identity", "", "X25519 identity file (recipient containers)")
+}
@@ -0,0 +1,236 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/rand"
+	"ecrypto/crypto"
+	"encoding/base64"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Small Argon2id parameters keep the passphrase cases fast.
+const (
+    testArgonM = 8 * 1024
+    testArgonT = 1
+    testArgonP = 1
+)
+
+// legacyContainer describes a container in an older format.
+type legacyContainer struct {
+    version uint8
+    kdf     uint8
+}
+
+// writeLegacy writes plain into path as c describes, unlocked by pass or
+// the key in keyFile. Unlike writeContainer it never adds a key
+// commitment, as version 2 has none.
+func writeLegacy(t *testing.T, path string, c legacyContainer, pass, keyFile string, plain []byte) {
+    t.Helper()
+    h, err := newStreamHeader(c.kdf)
+    if err != nil {
+        t.Fatal(err)
+    }
+    h.Version = c.version
+    h.ChunkSize = crypto.MinChunkSize
+
+    var key []byte
+    switch c.kdf {
+    case crypto.KDFArgon2id:
+        rand.Read(h.Salt[:])
+        h.ArgonM, h.ArgonT, h.ArgonP = testArgonM, testArgonT, testArgonP
+        key = crypto.DeriveKeyArgon2id(pass, h.Salt[:], testArgonM, testArgonT, testArgonP)
+    case crypto.KDFRawKey:
+        if key, err = crypto.ReadKeyFromFile(keyFile); err != nil {
+            t.Fatal(err)
+        }
+    case crypto.KDFWrapped:
+        if key, err = crypto.NewFileKey(); err != nil {
+            t.Fatal(err)
+        }
+        fileKey, err := crypto.ReadKeyFromFile(keyFile)
+        if err != nil {
+            t.Fatal(err)
+        }
+        st, err := crypto.WrapKeyWithKey(key, fileKey)
+        if err != nil {
+            t.Fatal(err)
+        }
+        h.Stanzas = []crypto.Stanza{st}
+    }
+
+    var buf bytes.Buffer
+    buf.Write(h.Encode())
+    sw, err := crypto.NewStreamWriter(&buf, key, h.AAD(), h.NoncePrefix[:], int(h.ChunkSize))
+    if err != nil {
+        t.Fatal(err)
+    }
+    sw.Write(plain)
+    if err := sw.Close(); err != nil {
+        t.Fatal(err)
+    }
+    if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+        t.Fatal(err)
+    }
+}
+
+func writeTestKey(t *testing.T, dir string) string {
+    t.Helper()
+    key := make([]byte, 32)
+    rand.Read(key)
+    path := filepath.Join(dir, "test.key")
+    if err := os.WriteFile(path, []byte(base64.RawURLEncoding.EncodeToString(key)), 0o600); err != nil {
+        t.Fatal(err)
+    }
+    return path
+}
+
+func testPayload() []byte {
+    plain := make([]byte, 3*crypto.MinChunkSize+5)
+    rand.Read(plain)
+    return plain
+}
+
+// readMigrated opens a migrated container with creds and returns its
+// plaintext, checking that it is in the current format.
+func readMigrated(t *testing.T, path string, creds *migrateCreds) []byte {
+    t.Helper()
+    c, err := openContainer(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer c.Close()
+    if c.Version() != crypto.CurrentVersion || !c.v2.KeyCommitted() {
+        t.Fatalf("migrated container is version %d, committed %v", c.Version(), c.v2.KeyCommitted())
+    }
+    resolveKey, err := creds.resolver(c)
+    if err != nil {
+        t.Fatal(err)
+    }
+    key, err := resolveKey(c)
+    if err != nil {
+        t.Fatal(err)
+    }
+    pt, size, err := c.plaintext(key)
+    if err != nil {
+        t.Fatal(err)
+    }
+    got, err := io.ReadAll(io.NewSectionReader(pt, 0, size))
+    if err != nil {
+        t.Fatal(err)
+    }
+    return got
+}
+
+func TestMigrateContainer(t *testing.T) {
+    tests := []struct {
+        name string
+        c    legacyContainer
+        pass bool // unlocked by a passphrase rather than a key file
+    }{
+        {"v2 passphrase", legacyContainer{crypto.VersionV2, crypto.KDFArgon2id}, true},
+        {"v2 raw key", legacyContainer{crypto.VersionV2, crypto.KDFRawKey}, false},
+        {"v2 wrapped key", legacyContainer{crypto.VersionV2, crypto.KDFWrapped}, false},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            dir := t.TempDir()
+            keyFile := writeTestKey(t, dir)
+            creds := &migrateCreds{pf: &passFlags{fd: -1}, keyFile: keyFile}
+            if tt.pass {
+                creds = &migrateCreds{pf: &passFlags{fd: -1, pass: "correct horse"}}
+            }
+
+            in, out := filepath.Join(dir, "in.ecrypt"), filepath.Join(dir, "out.ecrypt")
+            plain := testPayload()
+            writeLegacy(t, in, tt.c, creds.pf.pass, keyFile, plain)
+
+            migrated, err := migrateContainer(in, out, creds)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if !migrated {
+                t.Fatal("container was not migrated")
+            }
+            if !bytes.Equal(readMigrated(t, out, creds), plain) {
+                t.Error("migrated plaintext differs")
+            }
+
+            // Migrating again is a no-op.
+            if migrated, err := migrateContainer(out, out, creds); err != nil || migrated {
+                t.Errorf("second migration: migrated %v, err = %v", migrated, err)
+            }
+        })
+    }
+}
+
+func TestMigrateContainerFails(t *testing.T) {
+    dir := t.TempDir()
+    keyFile := writeTestKey(t, dir)
+    creds := &migrateCreds{pf: &passFlags{fd: -1}, keyFile: keyFile}
+
+    tests := []struct {
+        name  string
+        write func(t *testing.T, path string)
+    }{
+        {"wrong key", func(t *testing.T, path string) {
+            writeLegacy(t, path, legacyContainer{crypto.VersionV2, crypto.KDFRawKey}, "", writeTestKey(t, t.TempDir()), testPayload())
+        }},
+        {"tampered", func(t *testing.T, path string) {
+            writeLegacy(t, path, legacyContainer{crypto.VersionV2, crypto.KDFRawKey}, "", keyFile, testPayload())
+            data, err := os.ReadFile(path)
+            if err != nil {
+                t.Fatal(err)
+            }
+            data[len(data)-crypto.MinChunkSize] ^= 1
+            if err := os.WriteFile(path, data, 0o600); err != nil {
+                t.Fatal(err)
+            }
+        }},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            dir := t.TempDir()
+            in, out := filepath.Join(dir, "in.ecrypt"), filepath.Join(dir, "out.ecrypt")
+            tt.write(t, in)
+            if _, err := migrateContainer(in, out, creds); !errors.Is(err, crypto.ErrChunkAuth) {
+                t.Fatalf("error = %v, want ErrChunkAuth", err)
+            }
+            for _, path := range []string{out, out + ".migrating", out + ".migrating.tmp"} {
+                if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+                    t.Errorf("%s left behind", filepath.Base(path))
+                }
+            }
+        })
+    }
+}
+
+func TestMigrateDirReplace(t *testing.T) {
+    dir := t.TempDir()
+    keyFile := writeTestKey(t, t.TempDir())
+    creds := &migrateCreds{pf: &passFlags{fd: -1}, keyFile: keyFile}
+
+    plain := map[string][]byte{"a.ecrypt": testPayload(), "sub/b.ecrypt": testPayload()}
+    for name, p := range plain {
+        path := filepath.Join(dir, name)
+        if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+            t.Fatal(err)
+        }
+        writeLegacy(t, path, legacyContainer{crypto.VersionV2, crypto.KDFWrapped}, "", keyFile, p)
+    }
+    if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not a container"), 0o644); err != nil {
+        t.Fatal(err)
+    }
+
+    if err := migrateDir(dir, "", creds); err != nil {
+        t.Fatal(err)
+    }
+    for name, p := range plain {
+        if !bytes.Equal(readMigrated(t, filepath.Join(dir, name), creds), p) {
+            t.Errorf("%s: migrated plaintext differs", name)
+        }
+    }
+}
@@ -0,0 +1,225 @@
+package cmd
+
+import (
+	"bufio"
+	"ecrypto/crypto"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// passFlags are the ways a command accepts a passphrase. --pass stays for
+// compatibility but leaks into shell history and ps output; the other
+// sources do not.
+type passFlags struct {
+    pass    string
+    file    string
+    fd      int
+    env     string
+    command string
+    prefix  string // of the flag names, such as "old-" for --old-pass-file
+    what    string // what prompts call the passphrase; "passphrase" if empty
+}
+
+// addPassFlags registers --pass, --pass-file, --pass-fd, --pass-env and
+// --pass-command on c.
+func addPassFlags(c *cobra.Command, pf *passFlags) {
+    addPrefixedPassFlags(c, pf, "", "passphrase")
+}
+
+// addPrefixedPassFlags registers the flags of addPassFlags with names
+// starting with prefix, for commands that take more than one passphrase.
+// what names the passphrase in help text and prompts.
+func addPrefixedPassFlags(c *cobra.Command, pf *passFlags, prefix, what string) {
+    pf.fd = -1
+    pf.prefix = prefix
+    pf.what = what
+    c.Flags().StringVar(&pf.pass, prefix+"pass", "", capitalize(what)+" (Argon2id); visible in shell history, prefer the options below")
+    c.Flags().StringVar(&pf.file, prefix+"pass-file", "", "Read the "+what+" from the first line of a file")
+    c.Flags().IntVar(&pf.fd, prefix+"pass-fd", -1, "Read the "+what+" from an open file descriptor")
+    c.Flags().StringVar(&pf.env, prefix+"pass-env", "", "Read the "+what+" from an environment variable")
+    c.Flags().StringVar(&pf.command, prefix+"pass-command", "", "Run a command and read the "+what+" from its output")
+}
+
+// flag returns the command-line form of the flag called name, such as
+// --old-pass-file for "pass-file".
+func (pf *passFlags) flag(name string) string {
+    return "--" + pf.prefix + name
+}
+
+// capitalize upper-cases the first letter of s.
+func capitalize(s string) string {
+    if s == "" {
+        return s
+    }
+    return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// given reports whether any passphrase source was set.
+func (pf *passFlags) given() bool {
+    return pf.pass != "" || pf.file != "" || pf.fd >= 0 || pf.env != "" || pf.command != ""
+}
+
+// read returns the passphrase from whichever source was set. If none was,
+// it prompts on the terminal without echo, asking twice when confirm is set.
+func (pf *passFlags) read(confirm bool) (string, error) {
+    set := 0
+    for _, ok := range []bool{pf.pass != "", pf.file != "", pf.fd >= 0, pf.env != "", pf.command != ""} {
+        if ok {
+            set++
+        }
+    }
+    if set > 1 {
+        return "", fmt.Errorf("use only one of %s, %s, %s, %s or %s",
+            pf.flag("pass"), pf.flag("pass-file"), pf.flag("pass-fd"), pf.flag("pass-env"), pf.flag("pass-command"))
+    }
+
+    var pass string
+    var err error
+    switch {
+    case pf.pass != "":
+        pass = pf.pass
+    case pf.file != "":
+        pass, err = readPassFile(pf.file)
+    case pf.fd >= 0:
+        pass, err = readPassFD(pf.fd)
+    case pf.env != "":
+        var ok bool
+        if pass, ok = os.LookupEnv(pf.env); !ok {
+            return "", fmt.Errorf("environment variable %s is not set", pf.env)
+        }
+    case pf.command != "":
+        pass, err = readPassCommand(pf.command, pf.flag("pass-command"))
+    default:
+        return pf.prompt(confirm)
+    }
+    if err != nil {
+        return "", err
+    }
+    if pass == "" {
+        return "", errors.New("passphrase is empty")
+    }
+    return pass, nil
+}
+
+// firstLine returns r's first line without the line ending.
+func firstLine(r io.Reader) (string, error) {
+    line, err := bufio.NewReader(r).ReadString('\n')
+    if err != nil && err != io.EOF {
+        return "", err
+    }
+    return strings.TrimRight(line, "\r\n"), nil
+}
+
+func readPassFile(path string) (string, error) {
+    f, err := os.Open(path)
+    if err != nil {
+        return "", err
+    }
+    defer f.Close()
+    return firstLine(f)
+}
+
+func readPassFD(fd int) (string, error) {
+    f := os.NewFile(uintptr(fd), fmt.Sprintf("fd%d", fd))
+    if f == nil {
+        return "", fmt.Errorf("invalid file descriptor %d", fd)
+    }
+    defer f.Close()
+    pass, err := firstLine(f)
+    if err != nil {
+        return "", fmt.Errorf("reading passphrase from fd %d: %v", fd, err)
+    }
+    return pass, nil
+}
+
+// readPassCommand runs command, given as flag, through the system shell
+// and returns the first line it prints. The helper's stdin and stderr are
+// the terminal's, so it can prompt for its own unlock.
+func readPassCommand(command, flag string) (string, error) {
+    var c *exec.Cmd
+    if runtime.GOOS == "windows" {
+        c = exec.Command("cmd", "/C", command)
+    } else {
+        c = exec.Command("sh", "-c", command)
+    }
+    c.Stdin = os.Stdin
+    c.Stderr = os.Stderr
+    out, err := c.Output()
+    if err != nil {
+        return "", fmt.Errorf("%s failed: %v", flag, err)
+    }
+    return firstLine(strings.NewReader(string(out)))
+}
+
+// prompt reads the passphrase from the terminal without echo.
+func (pf *passFlags) prompt(confirm bool) (string, error) {
+    what := pf.what
+    if what == "" {
+        what = "passphrase"
+    }
+    fd := int(os.Stdin.Fd())
+    if !term.IsTerminal(fd) {
+        return "", fmt.Errorf("no %s given: use %s, %s, %s or %s when not running in a terminal",
+            what, pf.flag("pass-file"), pf.flag("pass-fd"), pf.flag("pass-env"), pf.flag("pass-command"))
+    }
+
+    fmt.Fprintf(os.Stderr, "%s: ", capitalize(what))
+    pass, err := term.ReadPassword(fd)
+    fmt.Fprintln(os.Stderr)
+    if err != nil {
+        return "", err
+    }
+    if len(pass) == 0 {
+        return "", fmt.Errorf("%s is empty", what)
+    }
+
+    if confirm {
+        fmt.Fprintf(os.Stderr, "Confirm %s: ", what)
+        again, err := term.ReadPassword(fd)
+        fmt.Fprintln(os.Stderr)
+        if err != nil {
+            return "", err
+        }
+        if string(again) != string(pass) {
+            return "", errors.New("passphrases do not match")
+        }
+    }
+    return string(pass), nil
+}
+
+// forContainer returns the passphrase needed to open c, or "" when the key
+// file or identity given is enough.
+func (pf *passFlags) forContainer(c *container, keyFile, identity string) (string, error) {
+    kdf := c.KDF()
+    needed := kdf == crypto.KDFArgon2id ||
+        (kdf == crypto.KDFWrapped && identity == "" && (keyFile == "" || c.needsBothFactors()))
+    if !needed {
+        return "", nil
+    }
+    return pf.read(false)
+}
+
+// containerKey returns a key resolver for the credentials given. The
+// passphrase is only read (or prompted for) once the opened container shows
+// that one is needed.
+func containerKey(pf *passFlags, keyFile, identity string) func(c *container) ([]byte, error) {
+    return func(c *container) ([]byte, error) {
+        pass, err := pf.forContainer(c, keyFile, identity)
+        if err != nil {
+            return nil, err
+        }
+        resolveKey, err := keyResolver(c.KDF(), pass, keyFile, identity)
+        if err != nil {
+            return nil, err
+        }
+        return resolveKey(c)
+    }
+}
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"ecrypto/archive"
+	"ecrypto/config"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// profileName is set by the global --profile flag.
+var profileName string
+
+// activeProfile and savedArgon hold the selected profile and the [argon2]
+// section of the config file. They are filled by SetProfile.
+var (
+    activeProfile = &config.Profile{}
+    savedArgon    *config.Argon2
+    profileLoaded bool
+)
+
+// SetProfile loads the config file and selects the named profile. An empty
+// name falls back to $ECRYPTO_PROFILE and then default_profile. The CLI
+// calls it before every command; the interactive menu and GUI server call it
+// at startup.
+func SetProfile(name string) error {
+    cfg, err := config.Load()
+    if err != nil {
+        return err
+    }
+    p, err := cfg.Profile(name)
+    if err != nil {
+        return err
+    }
+    activeProfile, savedArgon, profileLoaded = p, cfg.Argon2, true
+    return nil
+}
+
+// ActiveProfile returns the profile selected by SetProfile. It is never nil;
+// without a profile all its fields are empty.
+func ActiveProfile() *config.Profile {
+    return activeProfile
+}
+
+// loadProfile selects the default profile if SetProfile was not called.
+func loadProfile() error {
+    if profileLoaded {
+        return nil
+    }
+    return SetProfile("")
+}
+
+// credentialFlags supply a key or passphrase on the command line.
+var credentialFlags = []string{"pass", "pass-file", "pass-fd", "pass-env", "pass-command", "key-file", "key-share", "identity", "recipient"}
+
+// useProfileCredentials reports whether the profile's key file, identity
+// and passphrase source apply to c: only when none were given as flags.
+func useProfileCredentials(c *cobra.Command) bool {
+    for _, name := range credentialFlags {
+        if f := c.Flags().Lookup(name); f != nil && f.Changed {
+            return false
+        }
+    }
+    return true
+}
+
+// applyProfile fills a passphrase source from the profile.
+func (pf *passFlags) applyProfile(p *config.Profile) {
+    pf.file, pf.env, pf.command = p.PassFile, p.PassEnv, p.PassCommand
+}
+
+// applyProfileKeys fills the credentials of a command that opens containers
+// from the active profile, unless c was given any.
+func applyProfileKeys(c *cobra.Command, pf *passFlags, keyFile, identity *string) {
+    if !useProfileCredentials(c) {
+        return
+    }
+    pf.applyProfile(activeProfile)
+    *keyFile, *identity = activeProfile.KeyFile, activeProfile.Identity
+}
+
+// profileZipOptions returns the archive options for a folder encrypted by
+// the interactive wrappers: the active profile's include/exclude patterns.
+func profileZipOptions(progress archive.ProgressFunc) archive.ZipOptions {
+    return archive.ZipOptions{
+        Include:  activeProfile.Include,
+        Exclude:  activeProfile.Exclude,
+        Progress: progress,
+    }
+}
+
+// DefaultEncryptOutput returns the profile's output path for encrypting
+// inPath, or "" if the profile has no output_dir.
+func DefaultEncryptOutput(inPath string) string {
+    return activeProfile.OutputPath(filepath.Base(filepath.Clean(inPath)) + ".ecrypt")
+}
+
+// DefaultDecryptOutput returns the profile's output folder for decrypting
+// inFile, or "" if the profile has no output_dir.
+func DefaultDecryptOutput(inFile string) string {
+    return activeProfile.OutputPath(strings.TrimSuffix(filepath.Base(inFile), ".ecrypt"))
+}
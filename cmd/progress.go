@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"ecrypto/archive"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// progressRefresh is how often the --progress line is redrawn.
+const progressRefresh = 200 * time.Millisecond
+
+// progressPrinter draws a single, continually updated progress line for
+// the --progress flag of encrypt and decrypt.
+type progressPrinter struct {
+    w     io.Writer
+    start time.Time
+    mu    sync.Mutex
+    p     archive.Progress
+    width int // length of the last line drawn
+    stop  chan struct{}
+    done  chan struct{}
+}
+
+// startProgress starts redrawing a progress line on w and returns the
+// ProgressFunc feeding it and a function that draws the final line and
+// stops.
+func startProgress(w io.Writer) (archive.ProgressFunc, func()) {
+    pp := &progressPrinter{w: w, start: time.Now(), stop: make(chan struct{}), done: make(chan struct{})}
+    go pp.loop()
+    return pp.update, pp.finish
+}
+
+func (pp *progressPrinter) update(p archive.Progress) {
+    pp.mu.Lock()
+    pp.p = p
+    pp.mu.Unlock()
+}
+
+func (pp *progressPrinter) loop() {
+    defer close(pp.done)
+    ticker := time.NewTicker(progressRefresh)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-pp.stop:
+            return
+        case <-ticker.C:
+            pp.draw()
+        }
+    }
+}
+
+func (pp *progressPrinter) finish() {
+    close(pp.stop)
+    <-pp.done
+    pp.draw()
+    fmt.Fprintln(pp.w)
+}
+
+func (pp *progressPrinter) draw() {
+    pp.mu.Lock()
+    p := pp.p
+    pp.mu.Unlock()
+    line := progressLine(p, time.Since(pp.start))
+    pad := max(pp.width-len(line), 0)
+    pp.width = len(line)
+    fmt.Fprintf(pp.w, "\r%s%s", line, strings.Repeat(" ", pad))
+}
+
+// progressLine formats p as e.g.
+// "compressing  42% 1.20 GB / 2.85 GB  85.3 MB/s  ETA 00:21  3/10 files  docs/a.pdf".
+func progressLine(p archive.Progress, elapsed time.Duration) string {
+    phase := string(p.Phase)
+    if phase == "" {
+        phase = "starting"
+    }
+    line := fmt.Sprintf("%-11s %3d%% %s", phase, p.Percent(), formatBytes(p.BytesDone))
+    if p.BytesTotal > 0 {
+        line += " / " + formatBytes(p.BytesTotal)
+    }
+    line += fmt.Sprintf("  %s/s", formatBytes(int64(p.Rate(elapsed))))
+    if eta, ok := p.ETA(elapsed); ok {
+        line += "  ETA " + formatDuration(eta)
+    }
+    if p.FilesTotal > 0 {
+        line += fmt.Sprintf("  %d/%d files", p.FilesDone, p.FilesTotal)
+    }
+    if p.File != "" {
+        name := p.File
+        if len(name) > 40 {
+            name = "..." + name[len(name)-37:]
+        }
+        line += "  " + name
+    }
+    return line
+}
+
+// formatBytes returns a human-readable byte size.
+func formatBytes(n int64) string {
+    units := []string{"B", "KB", "MB", "GB", "TB"}
+    size := float64(n)
+    i := 0
+    for size >= 1024 && i < len(units)-1 {
+        size /= 1024
+        i++
+    }
+    if i == 0 {
+        return fmt.Sprintf("%d B", n)
+    }
+    return fmt.Sprintf("%.2f %s", size, units[i])
+}
+
+// formatDuration formats d as mm:ss, or h:mm:ss from an hour up.
+func formatDuration(d time.Duration) string {
+    s := int(d.Round(time.Second).Seconds())
+    if s >= 3600 {
+        return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+    }
+    return fmt.Sprintf("%02d:%02d", s/60, s%60)
+}
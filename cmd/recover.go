@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"ecrypto/archive"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+    recInFile   string
+    recOutDir   string
+    recIdentity string
+    recLimits   = archive.DefaultLimits()
+)
+
+var recoverCmd = &cobra.Command{
+    Use:   "recover",
+    Short: "Decrypt a container with the organization recovery key",
+    Long: `Decrypt a .ecrypt container using the organization recovery key instead of
+the owner's passphrase or key file.
+
+Only containers created with encrypt --recovery-pubkey can be recovered;
+"ecrypto info" shows whether a container has a recovery stanza. --identity
+is the X25519 identity file whose public key was given to --recovery-pubkey.
+
+  ecrypto recover --in lost.ecrypt --out restored --identity org.key
+
+Extraction applies the same safety checks and default limits as decrypt.`,
+    SilenceUsage: true,
+    RunE: func(cmd *cobra.Command, args []string) error {
+        if recOutDir == "" && recInFile != "" {
+            recOutDir = DefaultDecryptOutput(recInFile)
+        }
+        if recInFile == "" || recOutDir == "" {
+            return errors.New("--in and --out are required")
+        }
+        if recIdentity == "" {
+            return errors.New("--identity is required")
+        }
+
+        fmt.Fprintf(os.Stderr, "Recovering with %s...\n", recIdentity)
+        if err := decryptContainer(cmd.Context(), recInFile, recOutDir, recoveryKey(recIdentity), archive.UnzipOptions{
+            Limits: &recLimits,
+        }); err != nil {
+            return err
+        }
+
+        fmt.Fprintf(os.Stderr, "✓ Recovered to: %s\n", recOutDir)
+        return nil
+    },
+}
+
+func init() {
+    rootCmd.AddCommand(recoverCmd)
+    recoverCmd.Flags().StringVar(&recInFile, "in", "", "Input .ecrypt file")
+    recoverCmd.Flags().StringVar(&recOutDir, "out", "", "Output folder")
+    recoverCmd.Flags().StringVar(&recIdentity, "identity", "", "Organization recovery identity file (X25519)")
+}
@@ -0,0 +1,255 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"ecrypto/crypto"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+    rekeyInFile      string
+    rekeyOutFile     string
+    rekeyOldPass     passFlags
+    rekeyOldKeyFile  string
+    rekeyOldIdentity string
+    rekeyNewPass     passFlags
+    rekeyNewKeyFile  string
+    rekeySignKey     string
+    rekeyArgonM      uint32 = 256 * 1024 // 256 MB in KiB
+    rekeyArgonT      uint32 = 3
+    rekeyArgonP      uint8  = 1
+)
+
+var rekeyCmd = &cobra.Command{
+    Use:   "rekey",
+    Short: "Change the passphrase or key file of a container without re-encrypting it",
+    Long: `Replace the passphrase or key file that protects a .ecrypt container.
+Only the wrapped file key in the header is rewritten; the encrypted payload is
+left untouched, so rekeying is fast even for very large containers.
+
+Unlock with the current passphrase, --old-key-file or --old-identity and
+protect with a new passphrase, --new-key-file or both (switching between
+modes is allowed; both together require the passphrase and the key file to
+decrypt). Give both the current passphrase and --old-key-file to unlock a
+two-factor container. Recipient stanzas are kept. Without --out the
+container is updated in place.
+
+The current passphrase comes from --old-pass-file, --old-pass-fd,
+--old-pass-env or --old-pass-command and the new one from the matching
+--new-pass-* flags. Either is prompted for without echo when it is needed
+and none is given; a new passphrase is needed unless only --new-key-file
+is given.
+
+The signature of a signed container covers its key stanzas, so rekeying
+it needs the signer's key: pass the file given to encrypt --sign-key as
+--sign-key and the container is signed again. Anyone else must decrypt
+and encrypt it again.`,
+    RunE: func(cmd *cobra.Command, args []string) error {
+        if rekeyInFile == "" {
+            return errors.New("--in is required")
+        }
+
+        // The new passphrase is read once the container is unlocked, so
+        // that the current one is asked for first.
+        var wrap func(fileKey []byte) (crypto.Stanza, error)
+        var err error
+        if rekeyNewPass.given() || rekeyNewKeyFile == "" {
+            if err := applySavedArgon(cmd, &rekeyArgonM, &rekeyArgonT, &rekeyArgonP); err != nil {
+                return err
+            }
+            wrap = func(fileKey []byte) (crypto.Stanza, error) {
+                pass, err := rekeyNewPass.read(true)
+                if err != nil {
+                    return crypto.Stanza{}, err
+                }
+                wrapPass := passphraseStanza(pass, rekeyArgonM, rekeyArgonT, rekeyArgonP)
+                if rekeyNewKeyFile != "" {
+                    if wrapPass, err = twoFactorStanza(pass, rekeyNewKeyFile, rekeyArgonM, rekeyArgonT, rekeyArgonP); err != nil {
+                        return crypto.Stanza{}, err
+                    }
+                }
+                return wrapPass(fileKey)
+            }
+        } else if wrap, err = keyFileStanza(rekeyNewKeyFile); err != nil {
+            return err
+        }
+
+        var signKey ed25519.PrivateKey
+        if rekeySignKey != "" {
+            if signKey, err = crypto.ReadEd25519SecretKey(rekeySignKey); err != nil {
+                return err
+            }
+        }
+
+        resolveKey := containerKey(&rekeyOldPass, rekeyOldKeyFile, rekeyOldIdentity)
+        if err := RekeyContainer(rekeyInFile, rekeyOutFile, resolveKey, wrap, signKey); err != nil {
+            return err
+        }
+
+        out := rekeyOutFile
+        if out == "" {
+            out = rekeyInFile
+        }
+        fmt.Fprintf(os.Stderr, "✓ Rekeyed: %s\n", out)
+        return nil
+    },
+}
+
+// RekeyContainer unlocks inFile with resolveKey and replaces its
+// passphrase, key file and two-factor stanzas with the stanza produced by
+// wrap. The payload is copied verbatim. A signed container is signed again
+// with signKey, which must be the key that signed it. If outFile is empty the
+// container is updated in place: when the header size is unchanged only
+// the header and signature bytes are overwritten, otherwise the container
+// is rewritten via a .tmp file.
+func RekeyContainer(inFile, outFile string, resolveKey func(c *container) ([]byte, error), wrap func(fileKey []byte) (crypto.Stanza, error), signKey ed25519.PrivateKey) error {
+    c, err := openContainer(inFile)
+    if err != nil {
+        return err
+    }
+    defer c.Close()
+
+    if c.v2 == nil || c.KDF() != crypto.KDFWrapped {
+        return errors.New("container does not use key wrapping (created by an older version); decrypt and re-encrypt it once to enable rekeying")
+    }
+    if c.sig != nil {
+        signer, _ := c.v2.Signer()
+        if signKey == nil {
+            return errors.New("container is signed and rekeying breaks the signature; pass the signer's key with --sign-key")
+        }
+        if !bytes.Equal(signer, signKey.Public().(ed25519.PublicKey)) {
+            return errors.New("--sign-key is not the key that signed the container")
+        }
+        // Only a payload that still matches the signature is signed again.
+        if err := c.checkSignature(signer); err != nil {
+            return err
+        }
+    }
+
+    fileKey, err := resolveKey(c)
+    if err != nil {
+        return err
+    }
+    // Make sure the key really opens the payload before touching anything.
+    if _, _, err := c.plaintext(fileKey); err != nil {
+        return err
+    }
+
+    st, err := wrap(fileKey)
+    if err != nil {
+        return err
+    }
+
+    newHeader := *c.v2
+    newHeader.Stanzas = []crypto.Stanza{st}
+    for _, old := range c.v2.Stanzas {
+        switch old.Type {
+        case crypto.StanzaArgon2id, crypto.StanzaKeyFile, crypto.StanzaTwoFactor:
+            // replaced by st
+        default:
+            newHeader.Stanzas = append(newHeader.Stanzas, old)
+        }
+    }
+
+    var sig []byte
+    if c.sig != nil {
+        if sig, err = resign(c, &newHeader, signKey); err != nil {
+            return err
+        }
+    }
+
+    if outFile == "" || outFile == inFile {
+        if newHeader.Size() == c.v2.Size() {
+            return rewriteHeaderInPlace(c, &newHeader, sig)
+        }
+        outFile = inFile
+    }
+    return copyWithHeader(c, &newHeader, sig, outFile)
+}
+
+// resign returns the signature of c's payload under the new header h. The
+// payload is read through the digests pinned by checkSignature.
+func resign(c *container, h *crypto.HeaderV2, signKey ed25519.PrivateKey) ([]byte, error) {
+    hs := int64(c.HeaderSize())
+    sum := crypto.NewSignatureHash()
+    sum.Write(h.Encode())
+    if _, err := io.Copy(sum, io.NewSectionReader(c.payloadReader(), hs, c.payloadSize())); err != nil {
+        return nil, err
+    }
+    return crypto.SignContainer(signKey, sum.Sum(nil))
+}
+
+// rewriteHeaderInPlace overwrites the header of an opened container with a
+// header of identical size, and its signature with sig if it is not nil.
+func rewriteHeaderInPlace(c *container, h *crypto.HeaderV2, sig []byte) error {
+    f, err := os.OpenFile(c.file.Name(), os.O_WRONLY, 0)
+    if err != nil {
+        return err
+    }
+    if _, err := f.WriteAt(h.Encode(), 0); err != nil {
+        f.Close()
+        return err
+    }
+    if sig != nil {
+        if _, err := f.WriteAt(sig, c.size-int64(len(sig))); err != nil {
+            f.Close()
+            return err
+        }
+    }
+    if err := f.Sync(); err != nil {
+        f.Close()
+        return err
+    }
+    return f.Close()
+}
+
+// copyWithHeader writes h followed by the unchanged payload of c and, for a
+// signed container, sig to outFile via a .tmp file.
+func copyWithHeader(c *container, h *crypto.HeaderV2, sig []byte, outFile string) error {
+    tmp := outFile + ".tmp"
+    f, err := os.Create(tmp)
+    if err != nil {
+        return err
+    }
+
+    hs := int64(c.HeaderSize())
+    _, err = f.Write(h.Encode())
+    if err == nil {
+        _, err = io.Copy(f, io.NewSectionReader(c.payloadReader(), hs, c.payloadSize()))
+    }
+    if err == nil && sig != nil {
+        _, err = f.Write(sig)
+    }
+    if cerr := f.Close(); err == nil {
+        err = cerr
+    }
+    if err != nil {
+        os.Remove(tmp)
+        return err
+    }
+
+    // Release the source before replacing it (required on Windows).
+    c.Close()
+    return os.Rename(tmp, outFile)
+}
+
+func init() {
+    rootCmd.AddCommand(rekeyCmd)
+    rekeyCmd.Flags().StringVar(&rekeyInFile, "in", "", "Input .ecrypt file")
+    rekeyCmd.Flags().StringVar(&rekeyOutFile, "out", "", "Output .ecrypt file (default: update in place)")
+    addPrefixedPassFlags(rekeyCmd, &rekeyOldPass, "old-", "current passphrase")
+    rekeyCmd.Flags().StringVar(&rekeyOldKeyFile, "old-key-file", "", "Current key file")
+    rekeyCmd.Flags().StringVar(&rekeyOldIdentity, "old-identity", "", "X25519 identity file able to unlock the container")
+    addPrefixedPassFlags(rekeyCmd, &rekeyNewPass, "new-", "new passphrase")
+    rekeyCmd.Flags().StringVar(&rekeyNewKeyFile, "new-key-file", "", "New 32-byte Base64(URL) key file")
+    rekeyCmd.Flags().StringVar(&rekeySignKey, "sign-key", "", "Ed25519 key that signed the container, to sign it again")
+    rekeyCmd.Flags().Uint32Var(&rekeyArgonM, "argon-m", rekeyArgonM, "Argon2 memory (KiB) for the new passphrase")
+    rekeyCmd.Flags().Uint32Var(&rekeyArgonT, "argon-t", rekeyArgonT, "Argon2 iterations for the new passphrase")
+    rekeyCmd.Flags().Uint8Var(&rekeyArgonP, "argon-p", rekeyArgonP, "Argon2 parallelism for the new passphrase")
+}
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"ecrypto/crypto"
+	"io"
+	"path/filepath"
+	"testing"
+)
+
+// wrapFor returns a wrapper that seals file keys with the key in keyFile.
+func wrapFor(t *testing.T, keyFile string) func(fileKey []byte) (crypto.Stanza, error) {
+    t.Helper()
+    wrap, err := keyFileStanza(keyFile)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return wrap
+}
+
+func TestSignatureCoversStanzas(t *testing.T) {
+    dir := t.TempDir()
+    keyFile := writeTestKey(t, dir)
+    signKey, _, err := crypto.GenerateEd25519()
+    if err != nil {
+        t.Fatal(err)
+    }
+    plain := testPayload()
+    signed := filepath.Join(dir, "signed.ecrypt")
+    h, fileKey, err := newWrappedHeader(wrapFor(t, keyFile))
+    if err != nil {
+        t.Fatal(err)
+    }
+    h.ChunkSize = crypto.MinChunkSize
+    err = writeContainer(context.Background(), signed, h, fileKey, signKey, func(w io.Writer) error {
+        _, err := w.Write(plain)
+        return err
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    // A stanza added by someone else, keeping the old signature.
+    c, err := openContainer(signed)
+    if err != nil {
+        t.Fatal(err)
+    }
+    added := *c.v2
+    otherKey := writeTestKey(t, t.TempDir())
+    st, err := wrapFor(t, otherKey)(fileKey)
+    if err != nil {
+        t.Fatal(err)
+    }
+    added.Stanzas = append(added.Stanzas, st)
+    tampered := filepath.Join(dir, "tampered.ecrypt")
+    if err := copyWithHeader(c, &added, c.sig, tampered); err != nil {
+        t.Fatal(err)
+    }
+    c, err = openContainer(tampered)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := c.checkSignature(nil); err == nil {
+        t.Error("signature accepted after adding a stanza")
+    }
+    c.Close()
+
+    newKey := writeTestKey(t, t.TempDir())
+    rekeyed := filepath.Join(dir, "rekeyed.ecrypt")
+    eveKey, _, err := crypto.GenerateEd25519()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := RekeyContainer(signed, rekeyed, keyFileKey(keyFile), wrapFor(t, newKey), nil); err == nil {
+        t.Error("rekeyed a signed container without its signing key")
+    }
+    if err := RekeyContainer(signed, rekeyed, keyFileKey(keyFile), wrapFor(t, newKey), eveKey); err == nil {
+        t.Error("rekeyed a signed container with another signing key")
+    }
+    if err := RekeyContainer(signed, rekeyed, keyFileKey(keyFile), wrapFor(t, newKey), signKey); err != nil {
+        t.Fatal(err)
+    }
+
+    c, err = openContainer(rekeyed)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer c.Close()
+    if err := c.checkSignature(signKey.Public().(ed25519.PublicKey)); err != nil {
+        t.Fatalf("rekeyed container: %v", err)
+    }
+    resolveKey, err := keyResolver(c.KDF(), "", newKey, "")
+    if err != nil {
+        t.Fatal(err)
+    }
+    key, err := resolveKey(c)
+    if err != nil {
+        t.Fatal(err)
+    }
+    pt, size, err := c.plaintext(key)
+    if err != nil {
+        t.Fatal(err)
+    }
+    got, err := io.ReadAll(io.NewSectionReader(pt, 0, size))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !bytes.Equal(got, plain) {
+        t.Error("rekeyed plaintext differs")
+    }
+}
@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"errors"
+
 	"github.com/spf13/cobra"
 )
 
@@ -8,11 +10,35 @@ var rootCmd = &cobra.Command{
 	Use:   "ecrypto",
 	Short: "Encrypt and decrypt folders into secure .ecrypt containers",
     Long: `ecrypto encrypts entire folders into a single encrypted container using XChaCha20-Poly1305.
-Decrypt with a passphrase or raw key. Filenames and metadata are protected.`,
+Decrypt with a passphrase or raw key. Filenames and metadata are protected.
+
+Defaults for key files, Argon2 parameters, exclude patterns and output
+folders can be kept in named profiles in ~/.config/ecrypto/config.toml and
+selected with --profile.`,
+    PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+        if err := SetProfile(profileName); err != nil {
+            cmd.SilenceUsage = true
+            return err
+        }
+        return nil
+    },
 }
 
 func Execute() error {
 	return rootCmd.Execute()
 }
 
-func init() {}
\ No newline at end of file
+// ExitCode returns the process exit code for an error returned by Execute.
+// Errors that carry their own code (such as verification failures) use it;
+// everything else exits with 1.
+func ExitCode(err error) int {
+    var coder interface{ ExitCode() int }
+    if errors.As(err, &coder) {
+        return coder.ExitCode()
+    }
+    return 1
+}
+
+func init() {
+    rootCmd.PersistentFlags().StringVar(&profileName, "profile", "", "Config profile to use (default: $ECRYPTO_PROFILE or default_profile)")
+}
\ No newline at end of file
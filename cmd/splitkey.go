@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"ecrypto/crypto"
+	"errors"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+    splitKeyFile   string
+    splitOutBase   string
+    splitShares    int
+    splitThreshold int
+)
+
+var splitKeyCmd = &cobra.Command{
+    Use:   "split-key",
+    Short: "Split an existing key file into M-of-N key shares",
+    Long: `Split an existing 32-byte key file into N share files of which any M
+recombine it, for keys that already protect containers.
+
+  ecrypto split-key --key-file dr.key --shares 5 --threshold 3
+  ecrypto split-key --key-file dr.key --shares 5 --threshold 3 --out /media/usb/dr
+
+The shares are written to BASE.share1 ... BASE.shareN, where BASE is --out
+or the key file path. Pass M of them to encrypt or decrypt with
+--key-share, or turn them back into a key file with combine-key. The key
+file itself is left in place; delete it once the shares are handed out if
+no single person should hold the key.`,
+    SilenceUsage: true,
+    RunE: func(cmd *cobra.Command, args []string) error {
+        if splitKeyFile == "" {
+            return errors.New("--key-file is required")
+        }
+        base := splitOutBase
+        if base == "" {
+            base = splitKeyFile
+        }
+        return splitKey(splitKeyFile, splitShares, splitThreshold, base)
+    },
+}
+
+// splitKey splits the key in keyFile into share files named after base.
+func splitKey(keyFile string, n, threshold int, base string) error {
+    key, err := crypto.ReadKeyFromFile(keyFile)
+    if err != nil {
+        return err
+    }
+    return writeKeyShares(key, n, threshold, base)
+}
+
+func init() {
+    rootCmd.AddCommand(splitKeyCmd)
+    splitKeyCmd.Flags().StringVar(&splitKeyFile, "key-file", "", "32-byte Base64(URL) key file to split")
+    splitKeyCmd.Flags().StringVar(&splitOutBase, "out", "", "Base name of the share files (default: the key file path)")
+    splitKeyCmd.Flags().IntVar(&splitShares, "shares", 0, "Number of share files to write")
+    splitKeyCmd.Flags().IntVar(&splitThreshold, "threshold", 0, "Number of shares needed to recombine the key")
+}
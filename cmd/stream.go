@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"archive/zip"
+	"context"
+	"ecrypto/archive"
+	"ecrypto/crypto"
+	"errors"
+	"io"
+	"os"
+)
+
+// Credentials are the secrets for EncryptStream and OpenStream: a
+// passphrase, a raw 32-byte key, or both for a two-factor container.
+type Credentials struct {
+    Passphrase string
+    Key        []byte
+}
+
+// header returns a v2 header and a random file key wrapped for cr.
+func (cr Credentials) header() (*crypto.HeaderV2, []byte, error) {
+    if cr.Key != nil && cr.Passphrase == "" {
+        return newWrappedHeader(keyStanza(cr.Key))
+    }
+    if cr.Passphrase == "" {
+        return nil, nil, errors.New("passphrase or key required")
+    }
+    m, t, p, err := currentArgon()
+    if err != nil {
+        return nil, nil, err
+    }
+    if cr.Key != nil {
+        return newWrappedHeader(func(fileKey []byte) (crypto.Stanza, error) {
+            return crypto.WrapKeyTwoFactor(fileKey, cr.Passphrase, cr.Key, m, t, p)
+        })
+    }
+    return newPassphraseHeader(cr.Passphrase, m, t, p)
+}
+
+// resolver returns a key resolver for cr. Given both secrets, containers
+// without a two-factor stanza are opened with whichever one they need, as
+// with twoFactorKey.
+func (cr Credentials) resolver() func(c *container) ([]byte, error) {
+    return func(c *container) ([]byte, error) {
+        switch {
+        case cr.Passphrase != "" && cr.Key != nil && c.stanzaCount(crypto.StanzaTwoFactor) > 0:
+            return crypto.UnwrapTwoFactor(c.Stanzas(), cr.Passphrase, cr.Key)
+        case cr.Key != nil && (cr.Passphrase == "" || c.KDF() == crypto.KDFRawKey || c.stanzaCount(crypto.StanzaKeyFile) > 0):
+            return rawKey(cr.Key)(c)
+        case cr.Passphrase != "":
+            return passphraseKey(cr.Passphrase)(c)
+        }
+        return nil, errors.New("passphrase or key required")
+    }
+}
+
+// EncryptStream writes a container holding everything fill writes to w,
+// without a temporary file. If it fails or ctx is cancelled, w is left
+// with a truncated container that will not decrypt.
+func EncryptStream(ctx context.Context, w io.Writer, cr Credentials, fill func(w io.Writer) error) error {
+    h, key, err := cr.header()
+    if err != nil {
+        return err
+    }
+    return writeContainerTo(ctx, w, h, key, nil, fill)
+}
+
+// Plaintext is a container authenticated by OpenStream, ready to be
+// streamed out.
+type Plaintext struct {
+    r      io.ReaderAt
+    size   int64
+    folder bool
+}
+
+// OpenStream reads the header of the container in f and resolves its key
+// with cr. Nothing is decrypted yet. f must stay open until the plaintext
+// has been streamed; the caller closes it.
+func OpenStream(f *os.File, cr Credentials) (*Plaintext, error) {
+    c, err := readContainer(f)
+    if err != nil {
+        return nil, err
+    }
+    key, err := cr.resolver()(c)
+    if err != nil {
+        return nil, err
+    }
+    r, size, err := c.plaintext(key)
+    if err != nil {
+        return nil, err
+    }
+
+    // As in decryptContainer, anything that is not a ZIP archive is a
+    // single file.
+    _, err = zip.NewReader(r, size)
+    if err != nil && !errors.Is(err, zip.ErrFormat) {
+        return nil, err
+    }
+    return &Plaintext{r: r, size: size, folder: err == nil}, nil
+}
+
+// Folder reports whether the container holds a folder, which Stream
+// writes as a tar archive.
+func (p *Plaintext) Folder() bool {
+    return p.folder
+}
+
+// Size returns the size of a single file's plaintext.
+func (p *Plaintext) Size() int64 {
+    return p.size
+}
+
+// Stream decrypts the container to w: a single file as is, a folder as a
+// tar archive. progress, if not nil, receives byte-level progress.
+// Cancelling ctx stops it at the next read.
+func (p *Plaintext) Stream(ctx context.Context, w io.Writer, progress archive.ProgressFunc) error {
+    r := ctxReaderAt{ctx, p.r}
+    if p.folder {
+        return archive.ZipToTar(w, r, p.size, progress)
+    }
+
+    m := archive.NewMeter(progress)
+    m.SetPhase(archive.PhaseDecrypting)
+    m.SetTotals(1, p.size)
+    if _, err := io.Copy(m.Writer(w), io.NewSectionReader(r, 0, p.size)); err != nil {
+        return err
+    }
+    m.FinishFile()
+    return nil
+}
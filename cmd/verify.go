@@ -0,0 +1,344 @@
+package cmd
+
+import (
+	"archive/zip"
+	"crypto/ed25519"
+	"ecrypto/archive"
+	"ecrypto/crypto"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+    verifyInFile   string
+    verifyPass     passFlags
+    verifyKeyFile  string
+    verifyIdentity string
+    verifySigner   string
+)
+
+var verifyCmd = &cobra.Command{
+    Use:   "verify",
+    Short: "Check that a .ecrypt container is intact and decryptable",
+    Long: `Authenticate every chunk of a container with the supplied key and check
+the structure of the archive inside, without writing any plaintext to disk.
+
+On failure the exit code tells why:
+  2  wrong key or passphrase
+  3  container truncated
+  4  corrupted header
+  5  corrupted data (a chunk failed authentication)
+  6  bad archive inside the container
+  7  missing, invalid or unexpected signature
+
+Signed containers always have their signature checked. --signer-pubkey
+also requires the container to be signed by that Ed25519 public key. The
+signature covers the whole header, key stanzas included, so a recipient
+or passphrase added to a signed container by anyone but the signer makes
+it fail.`,
+    SilenceUsage: true,
+    RunE: func(cmd *cobra.Command, args []string) error {
+        if verifyInFile == "" {
+            return errors.New("--in is required")
+        }
+
+        var signer ed25519.PublicKey
+        if verifySigner != "" {
+            var err error
+            if signer, err = parseSignerKey(verifySigner); err != nil {
+                return err
+            }
+        }
+
+        applyProfileKeys(cmd, &verifyPass, &verifyKeyFile, &verifyIdentity)
+        resolveKey := containerKey(&verifyPass, verifyKeyFile, verifyIdentity)
+        res, err := verifyContainer(verifyInFile, signer, resolveKey)
+        if err != nil {
+            return err
+        }
+
+        fmt.Printf("✓ %s is intact\n", verifyInFile)
+        if res.Signer != "" {
+            fmt.Printf("  Signed by: %s\n", res.Signer)
+        }
+        if res.Chunks > 0 {
+            fmt.Printf("  Chunks authenticated: %d\n", res.Chunks)
+        }
+        fmt.Printf("  Plaintext size: %d bytes\n", res.PlaintextSize)
+        if res.SingleFile {
+            fmt.Printf("  Contents: single file\n")
+        } else {
+            fmt.Printf("  Archive entries: %d\n", res.Entries)
+        }
+        return nil
+    },
+}
+
+// Reasons reported by VerifyError.
+const (
+    VerifyWrongKey      = "wrong key"
+    VerifyTruncated     = "truncated"
+    VerifyCorruptHeader = "corrupted header"
+    VerifyCorruptData   = "corrupted data"
+    VerifyBadArchive    = "bad archive"
+    VerifyBadSignature  = "bad signature"
+)
+
+// VerifyError is returned when a container fails verification. Reason is
+// one of the Verify* constants.
+type VerifyError struct {
+    Reason string
+    Err    error
+}
+
+func (e *VerifyError) Error() string {
+    return fmt.Sprintf("verification failed (%s): %v", e.Reason, e.Err)
+}
+
+func (e *VerifyError) Unwrap() error {
+    return e.Err
+}
+
+// ExitCode returns the process exit code for the failure reason.
+func (e *VerifyError) ExitCode() int {
+    switch e.Reason {
+    case VerifyWrongKey:
+        return 2
+    case VerifyTruncated:
+        return 3
+    case VerifyCorruptHeader:
+        return 4
+    case VerifyCorruptData:
+        return 5
+    case VerifyBadArchive:
+        return 6
+    case VerifyBadSignature:
+        return 7
+    }
+    return 1
+}
+
+// VerifyResult summarizes a successful verification.
+type VerifyResult struct {
+    Version       uint8  `json:"version"`
+    Chunks        int64  `json:"chunks"`
+    PlaintextSize int64  `json:"plaintextSize"`
+    Entries       int    `json:"entries"`
+    SingleFile    bool   `json:"singleFile"`
+    Signer        string `json:"signer,omitempty"`
+}
+
+// verifyContainer authenticates every chunk of inFile and checks the
+// archive inside it in a single decrypting pass, discarding the
+// plaintext. The signature of a signed container is checked first; with a
+// non-nil signer the container must be signed by that key.
+func verifyContainer(inFile string, signer ed25519.PublicKey, resolveKey func(c *container) ([]byte, error)) (*VerifyResult, error) {
+    c, err := openContainer(inFile)
+    if err != nil {
+        var pathErr *fs.PathError
+        if errors.As(err, &pathErr) || errors.Is(err, crypto.ErrUnknownCriticalExtension) {
+            return nil, err
+        }
+        if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, errShortHeader) {
+            return nil, &VerifyError{Reason: VerifyTruncated, Err: err}
+        }
+        return nil, &VerifyError{Reason: VerifyCorruptHeader, Err: err}
+    }
+    defer c.Close()
+
+    res := &VerifyResult{Version: c.Version()}
+    if signer != nil || c.sig != nil {
+        if err := c.checkSignature(signer); err != nil {
+            return nil, &VerifyError{Reason: VerifyBadSignature, Err: err}
+        }
+        pub, _ := c.v2.Signer()
+        res.Signer = crypto.EncodeEd25519PublicKey(pub)
+    }
+
+    key, err := resolveKey(c)
+    if err != nil {
+        if isWrongKey(err) {
+            return nil, &VerifyError{Reason: VerifyWrongKey, Err: err}
+        }
+        return nil, err
+    }
+
+    if c.v2 == nil {
+        pt, size, err := c.plaintext(key)
+        if err != nil {
+            // Version 1 has a single tag, so a wrong key and damaged data look alike.
+            return nil, &VerifyError{Reason: VerifyWrongKey, Err: err}
+        }
+        res.PlaintextSize = size
+        if err := checkArchive(res, pt, size); err != nil {
+            return nil, err
+        }
+        return res, nil
+    }
+
+    if err := c.v2.CheckKey(key); errors.Is(err, crypto.ErrMissingCommitment) {
+        return nil, &VerifyError{Reason: VerifyCorruptHeader, Err: err}
+    } else if err != nil {
+        return nil, &VerifyError{Reason: VerifyWrongKey, Err: err}
+    }
+
+    // The archive is checked on the decrypting reader, and the chunks it
+    // did not touch are authenticated afterwards, so every chunk is
+    // decrypted once.
+    hs := int64(c.HeaderSize())
+    chunkSize := int64(c.v2.ChunkSize)
+    enc := newChunkTracker(c.payloadReader(), hs, c.payloadSize(), chunkSize+crypto.ChunkOverhead)
+    sr, err := crypto.NewStreamReaderAt(enc, hs, c.payloadSize(), key, c.v2.AAD(), c.v2.NoncePrefix[:], int(chunkSize))
+    if err != nil {
+        // The last chunk is authenticated first. A committed key is known
+        // to be right. Otherwise, without a wrapped key there is nothing
+        // else to check the key against, so a failing chunk most likely
+        // means a wrong key.
+        switch {
+        case errors.Is(err, crypto.ErrChunkAuth) && c.KDF() != crypto.KDFWrapped && !c.v2.KeyCommitted():
+            return nil, &VerifyError{Reason: VerifyWrongKey, Err: err}
+        case errors.Is(err, crypto.ErrChunkAuth), errors.Is(err, crypto.ErrStreamTruncated):
+            return nil, chunkError(err, enc.chunks-1)
+        }
+        return nil, &VerifyError{Reason: VerifyCorruptHeader, Err: err}
+    }
+    pt := &stickyReaderAt{r: sr}
+    archiveErr := checkArchive(res, pt, sr.Size())
+    if pt.err != nil {
+        return nil, chunkError(pt.err, pt.off/chunkSize)
+    }
+    var b [1]byte
+    for idx, seen := range enc.seen {
+        if seen {
+            continue
+        }
+        if _, err := sr.ReadAt(b[:], int64(idx)*chunkSize); err != nil && !errors.Is(err, io.EOF) {
+            return nil, chunkError(err, int64(idx))
+        }
+    }
+    if archiveErr != nil {
+        return nil, archiveErr
+    }
+    res.Chunks = sr.Chunks()
+    res.PlaintextSize = sr.Size()
+    return res, nil
+}
+
+// checkArchive checks the archive in pt and records what it holds in res.
+// Anything that is not a ZIP archive is a single file.
+func checkArchive(res *VerifyResult, pt io.ReaderAt, size int64) error {
+    entries, err := archive.Verify(pt, size)
+    switch {
+    case errors.Is(err, zip.ErrFormat):
+        res.SingleFile = true
+    case err != nil:
+        return &VerifyError{Reason: VerifyBadArchive, Err: err}
+    default:
+        res.Entries = entries
+    }
+    return nil
+}
+
+// chunkError turns an error decrypting chunk idx into a VerifyError.
+func chunkError(err error, idx int64) error {
+    switch {
+    case errors.Is(err, crypto.ErrStreamTruncated):
+        return &VerifyError{Reason: VerifyTruncated, Err: err}
+    case errors.Is(err, crypto.ErrChunkAuth):
+        return &VerifyError{Reason: VerifyCorruptData, Err: fmt.Errorf("chunk %d: %w", idx, err)}
+    }
+    return err
+}
+
+// chunkTracker records which encrypted chunks of a payload are read.
+type chunkTracker struct {
+    r             io.ReaderAt
+    offset, chunk int64
+    chunks        int64
+    seen          []bool
+}
+
+func newChunkTracker(r io.ReaderAt, offset, size, encChunk int64) *chunkTracker {
+    chunks := max((size+encChunk-1)/encChunk, 1)
+    return &chunkTracker{r: r, offset: offset, chunk: encChunk, chunks: chunks, seen: make([]bool, chunks)}
+}
+
+func (t *chunkTracker) ReadAt(p []byte, off int64) (int, error) {
+    if len(p) > 0 {
+        for idx := (off - t.offset) / t.chunk; idx <= (off-t.offset+int64(len(p))-1)/t.chunk && idx < t.chunks; idx++ {
+            if idx >= 0 {
+                t.seen[idx] = true
+            }
+        }
+    }
+    return t.r.ReadAt(p, off)
+}
+
+// stickyReaderAt keeps the first error other than io.EOF returned by r,
+// and the offset it was returned for, since archive errors do not wrap it.
+type stickyReaderAt struct {
+    r   io.ReaderAt
+    err error
+    off int64
+}
+
+func (s *stickyReaderAt) ReadAt(p []byte, off int64) (int, error) {
+    n, err := s.r.ReadAt(p, off)
+    if err != nil && !errors.Is(err, io.EOF) && s.err == nil {
+        s.err, s.off = err, off+int64(n)
+    }
+    return n, err
+}
+
+// requireSigner wraps resolveKey so that a container is refused unless it
+// carries a valid signature by the Ed25519 public key in signerArg (a key
+// or a file holding one). The signature is checked on the container being
+// decrypted, before its key is resolved, and pins its payload: if the file
+// changes afterwards, decryption fails instead of releasing unsigned data.
+func requireSigner(signerArg string, resolveKey func(c *container) ([]byte, error)) (func(c *container) ([]byte, error), error) {
+    want, err := parseSignerKey(signerArg)
+    if err != nil {
+        return nil, err
+    }
+    return func(c *container) ([]byte, error) {
+        if err := c.checkSignature(want); err != nil {
+            return nil, err
+        }
+        fmt.Fprintf(os.Stderr, "✓ Signed by %s\n", crypto.EncodeEd25519PublicKey(want))
+        return resolveKey(c)
+    }, nil
+}
+
+// isWrongKey reports whether err means the supplied credentials do not
+// open the container.
+func isWrongKey(err error) bool {
+    for _, target := range []error{
+        crypto.ErrWrongPassphrase,
+        crypto.ErrWrongKeyFile,
+        crypto.ErrNoMatchingIdentity,
+        crypto.ErrNoPassphraseStanza,
+        crypto.ErrNoKeyFileStanza,
+        crypto.ErrWrongTwoFactor,
+        crypto.ErrTwoFactorRequired,
+        crypto.ErrWrongKey,
+    } {
+        if errors.Is(err, target) {
+            return true
+        }
+    }
+    return false
+}
+
+func init() {
+    rootCmd.AddCommand(verifyCmd)
+    verifyCmd.Flags().StringVar(&verifyInFile, "in", "", "Input .ecrypt file")
+    addPassFlags(verifyCmd, &verifyPass)
+    verifyCmd.Flags().StringVar(&verifySigner, "signer-pubkey", "", "Require a signature by this Ed25519 public key (or file)")
+    verifyCmd.Flags().StringVar(&verifyKeyFile, "key-file", "", "32-byte Base64(URL) key file")
+    verifyCmd.Flags().StringVar(&verifyIdentity, "identity", "", "X25519 identity file (recipient containers)")
+}
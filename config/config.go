@@ -0,0 +1,201 @@
+// Package config reads and writes the user's ecrypto settings file.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// EnvPath overrides the location of the config file.
+const EnvPath = "ECRYPTO_CONFIG"
+
+// EnvProfile selects a profile when --profile is not given.
+const EnvProfile = "ECRYPTO_PROFILE"
+
+// Config is the contents of config.toml.
+type Config struct {
+	// DefaultProfile is used when no profile is selected explicitly.
+	DefaultProfile string              `toml:"default_profile,omitempty"`
+	Argon2         *Argon2             `toml:"argon2,omitempty"`
+	Profiles       map[string]*Profile `toml:"profile,omitempty"`
+}
+
+// Argon2 holds Argon2id parameters for new passphrases, usually written by
+// "ecrypto benchmark-kdf --save". Memory is in KiB.
+type Argon2 struct {
+	Memory      uint32 `toml:"memory"`
+	Time        uint32 `toml:"time"`
+	Parallelism uint8  `toml:"parallelism"`
+}
+
+// Profile is a named set of defaults, written as [profile.<name>]. Zero
+// fields are unset. Paths may start with "~/".
+type Profile struct {
+	KeyFile     string   `toml:"key_file,omitempty" json:"keyFile,omitempty"`
+	Identity    string   `toml:"identity,omitempty" json:"identity,omitempty"`
+	Recipients  []string `toml:"recipients,omitempty" json:"recipients,omitempty"`
+	PassFile    string   `toml:"pass_file,omitempty" json:"passFile,omitempty"`
+	PassEnv     string   `toml:"pass_env,omitempty" json:"passEnv,omitempty"`
+	PassCommand string   `toml:"pass_command,omitempty" json:"passCommand,omitempty"`
+	ArgonM      uint32   `toml:"argon_m,omitzero" json:"argonM,omitempty"`
+	ArgonT      uint32   `toml:"argon_t,omitzero" json:"argonT,omitempty"`
+	ArgonP      uint8    `toml:"argon_p,omitzero" json:"argonP,omitempty"`
+	Include     []string `toml:"include,omitempty" json:"include,omitempty"`
+	Exclude     []string `toml:"exclude,omitempty" json:"exclude,omitempty"`
+	OutputDir   string   `toml:"output_dir,omitempty" json:"outputDir,omitempty"`
+	// MaskPassphrase makes the interactive menu echo an asterisk per
+	// character typed at passphrase prompts.
+	MaskPassphrase bool `toml:"mask_passphrase,omitempty" json:"maskPassphrase,omitempty"`
+}
+
+// Profile returns the named profile with "~/" expanded in its paths. An
+// empty name selects $ECRYPTO_PROFILE, then default_profile; if neither is
+// set an empty profile is returned.
+func (c *Config) Profile(name string) (*Profile, error) {
+	if name == "" {
+		name = os.Getenv(EnvProfile)
+	}
+	if name == "" {
+		name = c.DefaultProfile
+	}
+	if name == "" {
+		return &Profile{}, nil
+	}
+	p, ok := c.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("profile %q not found in config file", name)
+	}
+
+	out := *p
+	out.KeyFile = expandHome(out.KeyFile)
+	out.Identity = expandHome(out.Identity)
+	out.PassFile = expandHome(out.PassFile)
+	out.OutputDir = expandHome(out.OutputDir)
+	out.Recipients = make([]string, len(p.Recipients))
+	for i, r := range p.Recipients {
+		out.Recipients[i] = expandHome(r)
+	}
+	return &out, nil
+}
+
+// OutputPath returns where a result named name goes when no output was
+// given: inside OutputDir, or "" if the profile has none.
+func (p *Profile) OutputPath(name string) string {
+	if p == nil || p.OutputDir == "" {
+		return ""
+	}
+	return filepath.Join(p.OutputDir, name)
+}
+
+// expandHome replaces a leading "~/" with the user's home directory.
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
+
+// Path returns the config file location: $ECRYPTO_CONFIG if set, otherwise
+// ecrypto/config.toml under $XDG_CONFIG_HOME or ~/.config.
+func Path() (string, error) {
+	if p := os.Getenv(EnvPath); p != "" {
+		return p, nil
+	}
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "ecrypto", "config.toml"), nil
+}
+
+// Load reads the config file. A missing file gives an empty Config.
+func Load() (*Config, error) {
+	path, err := Path()
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{}
+	if _, err := toml.DecodeFile(path, cfg); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return cfg, nil
+		}
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Save writes the config file, creating its directory if needed, and
+// returns the path written.
+func (c *Config) Save() (string, error) {
+	path, err := Path()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return "", err
+	}
+
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return "", err
+	}
+	if err := toml.NewEncoder(f).Encode(c); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return path, nil
+}
+
+func (c *Config) validate() error {
+	if a := c.Argon2; a != nil {
+		if a.Time < 1 || a.Parallelism < 1 || a.Memory < 8*uint32(a.Parallelism) {
+			return errors.New("[argon2] needs time >= 1, parallelism >= 1 and memory >= 8 KiB per thread")
+		}
+	}
+	for name, p := range c.Profiles {
+		sources := 0
+		for _, s := range []string{p.PassFile, p.PassEnv, p.PassCommand} {
+			if s != "" {
+				sources++
+			}
+		}
+		if sources > 1 {
+			return fmt.Errorf("profile %q: use only one of pass_file, pass_env or pass_command", name)
+		}
+		if p.ArgonM != 0 && p.ArgonM < 8*uint32(max(p.ArgonP, 1)) {
+			return fmt.Errorf("profile %q: argon_m must be at least 8 KiB per thread", name)
+		}
+	}
+	if c.DefaultProfile != "" {
+		if _, ok := c.Profiles[c.DefaultProfile]; !ok {
+			return fmt.Errorf("default_profile %q is not defined", c.DefaultProfile)
+		}
+	}
+	return nil
+}
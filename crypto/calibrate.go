@@ -0,0 +1,74 @@
+// crypto/calibrate.go
+package crypto
+
+import (
+    "time"
+)
+
+// Argon2Params are Argon2id cost parameters. Memory is in KiB.
+type Argon2Params struct {
+    Memory  uint32
+    Time    uint32
+    Threads uint8
+}
+
+// MinArgon2Memory is the smallest memory cost calibration will pick
+// (19 MiB, the OWASP minimum for Argon2id).
+const MinArgon2Memory = 19 * 1024
+
+// MeasureArgon2id returns how long one key derivation with p takes on this
+// machine.
+func MeasureArgon2id(p Argon2Params) time.Duration {
+    var salt [16]byte
+    start := time.Now()
+    DeriveKeyArgon2id("ecrypto benchmark", salt[:], p.Memory, p.Time, p.Threads)
+    return time.Since(start)
+}
+
+// CalibrateArgon2id picks Argon2id parameters whose derivation takes about
+// target on this machine without using more than maxMemory KiB. Memory is
+// preferred over iterations: it starts at maxMemory with one pass, lowers
+// memory only while a single pass is too slow, and then adds passes to use
+// up the rest of the budget. It returns the parameters and their measured time.
+func CalibrateArgon2id(target time.Duration, maxMemory uint32, threads uint8) (Argon2Params, time.Duration) {
+    if threads == 0 {
+        threads = 1
+    }
+    if maxMemory < MinArgon2Memory {
+        maxMemory = MinArgon2Memory
+    }
+
+    p := Argon2Params{Memory: maxMemory, Time: 1, Threads: threads}
+    d := MeasureArgon2id(p)
+
+    // Cost is roughly linear in memory, so scale it towards the target. A
+    // few rounds absorb measurement noise from the first large allocation.
+    for i := 0; i < 4 && d > 0; i++ {
+        m := uint64(p.Memory) * uint64(target) / uint64(d)
+        m &^= 1023 // whole MiB
+        if m < MinArgon2Memory {
+            m = MinArgon2Memory
+        }
+        if m > uint64(maxMemory) {
+            m = uint64(maxMemory)
+        }
+        if m == uint64(p.Memory) || (d <= target && m < uint64(p.Memory)+uint64(p.Memory)/10) {
+            break
+        }
+        p.Memory = uint32(m)
+        d = MeasureArgon2id(p)
+    }
+
+    // Spend the rest of the budget on passes, which also cost linearly.
+    if d > 0 && d < target {
+        if t := uint32(target / d); t > 1 {
+            p.Time = t
+            d = MeasureArgon2id(p)
+            for d > target+target/10 && p.Time > 1 {
+                d = d * time.Duration(p.Time-1) / time.Duration(p.Time)
+                p.Time--
+            }
+        }
+    }
+    return p, d
+}
@@ -0,0 +1,102 @@
+// crypto/commit_test.go
+package crypto
+
+import (
+    "bytes"
+    "errors"
+    "testing"
+)
+
+func TestCheckKey(t *testing.T) {
+    key := testKey(t)
+    wrong := append([]byte(nil), key...)
+    wrong[31] ^= 1
+
+    committed := func() *HeaderV2 {
+        h := testHeaderV2(VersionV3)
+        h.CommitKey(key)
+        return h
+    }
+    tests := []struct {
+        name   string
+        header func() *HeaderV2
+        key    []byte
+        want   error
+    }{
+        {"right key", committed, key, nil},
+        {"wrong key", committed, wrong, ErrWrongKey},
+        {"other nonce prefix", func() *HeaderV2 {
+            h := committed()
+            h.NoncePrefix[0] ^= 1
+            return h
+        }, key, ErrWrongKey},
+        {"short commitment", func() *HeaderV2 {
+            h := committed()
+            ext, _ := h.Extension(ExtKeyCommitment)
+            ext.Value = ext.Value[:16]
+            h.SetExtension(ext)
+            return h
+        }, key, ErrWrongKey},
+        {"version 3 without commitment", func() *HeaderV2 { return testHeaderV2(VersionV3) }, key, ErrMissingCommitment},
+        {"version 2", func() *HeaderV2 { return testHeaderV2(VersionV2) }, wrong, nil},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            // Decode the header as a reader would.
+            h, err := DecodeHeaderV2(bytes.NewReader(tt.header().Encode()))
+            if err != nil {
+                t.Fatal(err)
+            }
+            if err := h.CheckKey(tt.key); !errors.Is(err, tt.want) {
+                t.Errorf("error = %v, want %v", err, tt.want)
+            }
+        })
+    }
+}
+
+func TestKeyCommitmentCritical(t *testing.T) {
+    h := testHeaderV2(VersionV3)
+    if h.KeyCommitted() {
+        t.Fatal("KeyCommitted before CommitKey")
+    }
+    h.CommitKey(testKey(t))
+    ext, ok := h.Extension(ExtKeyCommitment)
+    if !ok || !h.KeyCommitted() {
+        t.Fatal("no commitment after CommitKey")
+    }
+    if !ext.Critical {
+        t.Error("key commitment is not critical")
+    }
+}
+
+// A commitment cannot be stripped or swapped without failing the payload,
+// since it is part of the AAD.
+func TestKeyCommitmentAuthenticated(t *testing.T) {
+    key := testKey(t)
+    h := testHeaderV2(VersionV3)
+    h.CommitKey(key)
+
+    s := newTestStream(t)
+    s.key, s.aad = key, h.AAD()
+    copy(s.prefix, h.NoncePrefix[:])
+    enc := s.seal(t, []byte("payload"))
+
+    other := testKey(t)
+    for name, modify := range map[string]func(h *HeaderV2){
+        "stripped": func(h *HeaderV2) { h.Extensions = nil },
+        "swapped":  func(h *HeaderV2) { h.CommitKey(other) },
+    } {
+        t.Run(name, func(t *testing.T) {
+            tampered, err := DecodeHeaderV2(bytes.NewReader(h.Encode()))
+            if err != nil {
+                t.Fatal(err)
+            }
+            modify(tampered)
+            s := s
+            s.aad = tampered.AAD()
+            if _, err := s.open(t, enc); !errors.Is(err, ErrChunkAuth) {
+                t.Errorf("error = %v, want ErrChunkAuth", err)
+            }
+        })
+    }
+}
@@ -4,6 +4,7 @@ package crypto
 import (
     "encoding/base64"
     "errors"
+    "fmt"
     "os"
     "strings"
 
@@ -11,6 +12,20 @@ import (
     "golang.org/x/crypto/chacha20poly1305"
 )
 
+// MaxArgon2Memory is the largest Argon2id memory cost accepted (4 GiB in
+// KiB). Header parameters are not authenticated until the key has been
+// derived, so they are bounded before any memory is allocated.
+const MaxArgon2Memory = 4 << 20
+
+// CheckArgon2idParams rejects Argon2id parameters that would make the
+// derivation panic (t or p of zero) or allocate more than MaxArgon2Memory.
+func CheckArgon2idParams(m, t uint32, p uint8) error {
+    if t < 1 || p < 1 || m < 1 || m > MaxArgon2Memory {
+        return fmt.Errorf("invalid Argon2id parameters: m=%d KiB, t=%d, p=%d", m, t, p)
+    }
+    return nil
+}
+
 // DeriveKeyArgon2id derives a 32-byte key from a passphrase using Argon2id.
 func DeriveKeyArgon2id(pass string, salt []byte, m uint32, t uint32, p uint8) []byte {
     return argon2.IDKey(
@@ -29,7 +44,12 @@ func ReadKeyFromFile(path string) ([]byte, error) {
     if err != nil {
         return nil, err
     }
-    s := strings.TrimSpace(string(raw))
+    return ParseKey(string(raw))
+}
+
+// ParseKey decodes a Base64(URL)-encoded 32-byte key, as stored in key files.
+func ParseKey(s string) ([]byte, error) {
+    s = strings.TrimSpace(s)
 
     // Try Base64URL first, then standard Base64.
     key, err := base64.RawURLEncoding.DecodeString(s)
@@ -0,0 +1,131 @@
+// crypto/extension.go
+package crypto
+
+import (
+    "bytes"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "io"
+)
+
+// Extension is one type-length-value record in the extension area of a
+// version 3 header. The whole area is part of the AAD of every payload
+// chunk, so extensions cannot be added, removed or altered without
+// breaking decryption.
+type Extension struct {
+    Type     uint16
+    Critical bool // readers that do not know Type must refuse the container
+    Value    []byte
+}
+
+// extFlagCritical marks a critical extension in the record flags byte.
+const extFlagCritical = 0x01
+
+// maxExtensionArea bounds the size of the extension area.
+const maxExtensionArea = 1 << 20
+
+// knownExtensions maps the extension types this version understands to
+// their names.
+var knownExtensions = map[uint16]string{}
+
+// ExtensionName returns a readable name for an extension type.
+func ExtensionName(t uint16) string {
+    if name, ok := knownExtensions[t]; ok {
+        return name
+    }
+    return fmt.Sprintf("unknown (%d)", t)
+}
+
+// ErrUnknownCriticalExtension is returned when a header carries a critical
+// extension this version does not understand.
+var ErrUnknownCriticalExtension = errors.New("container requires an unsupported header extension")
+
+// Extension returns the first extension of type t, if any.
+func (h *HeaderV2) Extension(t uint16) (Extension, bool) {
+    for _, ext := range h.Extensions {
+        if ext.Type == t {
+            return ext, true
+        }
+    }
+    return Extension{}, false
+}
+
+// SetExtension replaces the extensions of type t with ext.
+func (h *HeaderV2) SetExtension(ext Extension) {
+    kept := h.Extensions[:0]
+    for _, e := range h.Extensions {
+        if e.Type != ext.Type {
+            kept = append(kept, e)
+        }
+    }
+    h.Extensions = append(kept, ext)
+}
+
+// encodeExtensions serializes the extension area: a uint32 length followed
+// by records of type(2) | flags(1) | length(2) | value.
+func encodeExtensions(exts []Extension) []byte {
+    var area bytes.Buffer
+    for _, ext := range exts {
+        var flags uint8
+        if ext.Critical {
+            flags |= extFlagCritical
+        }
+        _ = binary.Write(&area, binary.LittleEndian, ext.Type)
+        _ = binary.Write(&area, binary.LittleEndian, flags)
+        _ = binary.Write(&area, binary.LittleEndian, uint16(len(ext.Value)))
+        area.Write(ext.Value)
+    }
+    out := binary.LittleEndian.AppendUint32(nil, uint32(area.Len()))
+    return append(out, area.Bytes()...)
+}
+
+// extensionsSize returns the encoded size of the extension area.
+func extensionsSize(exts []Extension) int {
+    size := 4
+    for _, ext := range exts {
+        size += 2 + 1 + 2 + len(ext.Value)
+    }
+    return size
+}
+
+// decodeExtensions reads an extension area. Unknown optional extensions
+// are kept so that rewriting the header preserves them; unknown critical
+// ones are an error.
+func decodeExtensions(r io.Reader) ([]Extension, error) {
+    var areaLen uint32
+    if err := binary.Read(r, binary.LittleEndian, &areaLen); err != nil {
+        return nil, err
+    }
+    if areaLen > maxExtensionArea {
+        return nil, errors.New("header extension area too large")
+    }
+    area := make([]byte, areaLen)
+    if _, err := io.ReadFull(r, area); err != nil {
+        return nil, err
+    }
+
+    var exts []Extension
+    for len(area) > 0 {
+        if len(area) < 5 {
+            return nil, errors.New("truncated header extension")
+        }
+        ext := Extension{
+            Type:     binary.LittleEndian.Uint16(area[0:2]),
+            Critical: area[2]&extFlagCritical != 0,
+        }
+        n := int(binary.LittleEndian.Uint16(area[3:5]))
+        area = area[5:]
+        if len(area) < n {
+            return nil, errors.New("truncated header extension")
+        }
+        ext.Value = append([]byte(nil), area[:n]...)
+        area = area[n:]
+
+        if _, known := knownExtensions[ext.Type]; ext.Critical && !known {
+            return nil, fmt.Errorf("%w (type %d)", ErrUnknownCriticalExtension, ext.Type)
+        }
+        exts = append(exts, ext)
+    }
+    return exts, nil
+}
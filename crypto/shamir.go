@@ -0,0 +1,258 @@
+// crypto/shamir.go
+package crypto
+
+import (
+    "bytes"
+    "crypto/hmac"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/base64"
+    "errors"
+    "fmt"
+    "os"
+    "strings"
+)
+
+// KeySharePrefix starts the text form of a key share.
+const KeySharePrefix = "ECRYPTO-SHARE-"
+
+// keyShareVersion is the first byte of an encoded key share.
+const keyShareVersion = 2
+
+// keyCheckInfo separates the key checksum from other hashes of the key.
+const keyCheckInfo = "ecrypto key share check"
+
+// shareCheckSize is the size of the key check shared along with the key.
+const shareCheckSize = 16
+
+// Key share errors.
+var (
+    ErrShareChecksum    = errors.New("key share is corrupted (checksum mismatch)")
+    ErrShareMismatch    = errors.New("key shares come from different splits")
+    ErrDuplicateShare   = errors.New("the same key share was given twice")
+    ErrNotEnoughShares  = errors.New("not enough key shares")
+    ErrShareKeyMismatch = errors.New("combined key does not match the key checksum (wrong or tampered share)")
+)
+
+// KeyShare is one share of a key split with SplitKey. Any Threshold of the
+// Total shares of a split recombine to the key; fewer reveal nothing.
+type KeyShare struct {
+    SetID     [4]byte // random per split, so shares of different splits are not mixed
+    Threshold uint8
+    Total     uint8
+    Index     uint8  // x coordinate, 1..Total
+    Value     []byte // share of the key followed by its check (see SplitKey)
+}
+
+// SplitKey splits key into n shares of which any threshold recombine it,
+// using Shamir's secret sharing over GF(2^8). An HMAC of the key, keyed by
+// the key itself, is shared along with it, so the recombined key can be
+// checked while fewer shares than the threshold reveal nothing about
+// either.
+func SplitKey(key []byte, n, threshold int) ([]KeyShare, error) {
+    if threshold < 2 || threshold > n || n > 255 {
+        return nil, fmt.Errorf("invalid sharing %d of %d: need 2 <= threshold <= shares <= 255", threshold, n)
+    }
+    var setID [4]byte
+    if _, err := rand.Read(setID[:]); err != nil {
+        return nil, err
+    }
+
+    secret := append(append([]byte(nil), key...), shareCheck(key, setID)...)
+    shares := make([]KeyShare, n)
+    for i := range shares {
+        shares[i] = KeyShare{
+            SetID:     setID,
+            Threshold: uint8(threshold),
+            Total:     uint8(n),
+            Index:     uint8(i + 1),
+            Value:     make([]byte, len(secret)),
+        }
+    }
+
+    // One random polynomial of degree threshold-1 per secret byte, with the
+    // byte as its constant term.
+    coeffs := make([]byte, threshold)
+    for b, v := range secret {
+        if _, err := rand.Read(coeffs[1:]); err != nil {
+            return nil, err
+        }
+        coeffs[0] = v
+        for i := range shares {
+            shares[i].Value[b] = gfEval(coeffs, shares[i].Index)
+        }
+    }
+    return shares, nil
+}
+
+// CombineKeyShares recovers the key from at least Threshold shares of one
+// split and checks it against the key check recombined with it.
+func CombineKeyShares(shares []KeyShare) ([]byte, error) {
+    if len(shares) == 0 {
+        return nil, ErrNotEnoughShares
+    }
+    first := shares[0]
+    seen := make(map[uint8]bool, len(shares))
+    for _, s := range shares {
+        if s.SetID != first.SetID || s.Threshold != first.Threshold || s.Total != first.Total || len(s.Value) != len(first.Value) {
+            return nil, ErrShareMismatch
+        }
+        if seen[s.Index] {
+            return nil, fmt.Errorf("%w (share %d)", ErrDuplicateShare, s.Index)
+        }
+        seen[s.Index] = true
+    }
+    if len(shares) < int(first.Threshold) {
+        return nil, fmt.Errorf("%w: need %d of %d, got %d", ErrNotEnoughShares, first.Threshold, first.Total, len(shares))
+    }
+
+    // Lagrange interpolation at x = 0.
+    secret := make([]byte, len(first.Value))
+    for i, si := range shares {
+        basis := byte(1)
+        for j, sj := range shares {
+            if i != j {
+                basis = gfMul(basis, gfDiv(sj.Index, sj.Index^si.Index))
+            }
+        }
+        for b := range secret {
+            secret[b] ^= gfMul(si.Value[b], basis)
+        }
+    }
+
+    key, check := secret[:len(secret)-shareCheckSize], secret[len(secret)-shareCheckSize:]
+    if !hmac.Equal(shareCheck(key, first.SetID), check) {
+        return nil, ErrShareKeyMismatch
+    }
+    return key, nil
+}
+
+// Encode returns the text form of the share: KeySharePrefix followed by
+// Base64URL of version | set ID | threshold | total | index | value |
+// checksum, where checksum covers everything before it.
+func (s KeyShare) Encode() string {
+    var body bytes.Buffer
+    body.WriteByte(keyShareVersion)
+    body.Write(s.SetID[:])
+    body.WriteByte(s.Threshold)
+    body.WriteByte(s.Total)
+    body.WriteByte(s.Index)
+    body.Write(s.Value)
+    sum := sha256.Sum256(body.Bytes())
+    body.Write(sum[:4])
+    return KeySharePrefix + base64.RawURLEncoding.EncodeToString(body.Bytes())
+}
+
+// ID returns a short identifier for the share, e.g. "3f2a9c01-2/5".
+func (s KeyShare) ID() string {
+    return fmt.Sprintf("%x-%d/%d", s.SetID, s.Index, s.Total)
+}
+
+// ParseKeyShare parses a key share in text form.
+func ParseKeyShare(text string) (KeyShare, error) {
+    text = strings.TrimSpace(text)
+    if !strings.HasPrefix(text, KeySharePrefix) {
+        return KeyShare{}, errors.New("invalid key share: expected " + KeySharePrefix + " prefix")
+    }
+    body, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(text, KeySharePrefix))
+    if err != nil {
+        return KeyShare{}, err
+    }
+    if len(body) < 1+4+3+1+4+4 {
+        return KeyShare{}, errors.New("invalid key share: too short")
+    }
+    payload, sum := body[:len(body)-4], body[len(body)-4:]
+    want := sha256.Sum256(payload)
+    if !bytes.Equal(sum, want[:4]) {
+        return KeyShare{}, ErrShareChecksum
+    }
+
+    if payload[0] != keyShareVersion {
+        return KeyShare{}, fmt.Errorf("unsupported key share version %d", payload[0])
+    }
+    s := KeyShare{Threshold: payload[5], Total: payload[6], Index: payload[7]}
+    copy(s.SetID[:], payload[1:5])
+    if len(payload[8:]) <= shareCheckSize {
+        return KeyShare{}, errors.New("invalid key share: too short")
+    }
+    s.Value = append([]byte(nil), payload[8:]...)
+    if s.Index == 0 || s.Index > s.Total || s.Threshold < 2 || s.Threshold > s.Total {
+        return KeyShare{}, errors.New("invalid key share: bad index or threshold")
+    }
+    return s, nil
+}
+
+// ReadKeyShareFile reads a key share file. Lines starting with # are
+// comments.
+func ReadKeyShareFile(path string) (KeyShare, error) {
+    raw, err := os.ReadFile(path)
+    if err != nil {
+        return KeyShare{}, err
+    }
+    for _, line := range strings.Split(string(raw), "\n") {
+        line = strings.TrimSpace(line)
+        if line == "" || strings.HasPrefix(line, "#") {
+            continue
+        }
+        s, err := ParseKeyShare(line)
+        if err != nil {
+            return KeyShare{}, fmt.Errorf("%s: %w", path, err)
+        }
+        return s, nil
+    }
+    return KeyShare{}, errors.New("no key share found in " + path)
+}
+
+// shareCheck returns the key check shared along with key: HMAC-SHA256
+// keyed by key over a fixed label and the split's set ID, truncated to
+// shareCheckSize bytes.
+func shareCheck(key []byte, setID [4]byte) []byte {
+    mac := hmac.New(sha256.New, key)
+    mac.Write([]byte(keyCheckInfo))
+    mac.Write(setID[:])
+    return mac.Sum(nil)[:shareCheckSize]
+}
+
+// GF(2^8) arithmetic with the AES polynomial x^8 + x^4 + x^3 + x + 1.
+var gfExp, gfLog = gfTables()
+
+func gfTables() (exp [510]byte, log [256]byte) {
+    x := byte(1)
+    for i := 0; i < 255; i++ {
+        exp[i] = x
+        exp[i+255] = x
+        log[x] = byte(i)
+        // Multiply by the generator 3.
+        hi := x & 0x80
+        x2 := x << 1
+        if hi != 0 {
+            x2 ^= 0x1b
+        }
+        x ^= x2
+    }
+    return exp, log
+}
+
+func gfMul(a, b byte) byte {
+    if a == 0 || b == 0 {
+        return 0
+    }
+    return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+func gfDiv(a, b byte) byte {
+    if a == 0 {
+        return 0
+    }
+    return gfExp[int(gfLog[a])+255-int(gfLog[b])]
+}
+
+// gfEval evaluates the polynomial with the given coefficients (constant
+// term first) at x.
+func gfEval(coeffs []byte, x byte) byte {
+    var y byte
+    for i := len(coeffs) - 1; i >= 0; i-- {
+        y = gfMul(y, x) ^ coeffs[i]
+    }
+    return y
+}
@@ -0,0 +1,180 @@
+// crypto/shamir_test.go
+package crypto
+
+import (
+    "bytes"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/base64"
+    "errors"
+    "fmt"
+    "reflect"
+    "testing"
+)
+
+func testKey(t *testing.T) []byte {
+    t.Helper()
+    key := make([]byte, 32)
+    rand.Read(key)
+    return key
+}
+
+// subsets returns every subset of shares, as bit masks over their indices.
+func subsets(n int) []int {
+    masks := make([]int, 0, 1<<n)
+    for m := 1; m < 1<<n; m++ {
+        masks = append(masks, m)
+    }
+    return masks
+}
+
+func pick(shares []KeyShare, mask int) []KeyShare {
+    var out []KeyShare
+    for i, s := range shares {
+        if mask&(1<<i) != 0 {
+            out = append(out, s)
+        }
+    }
+    return out
+}
+
+func TestCombineKeySharesSubsets(t *testing.T) {
+    for _, tt := range []struct{ n, k int }{{2, 2}, {3, 2}, {3, 3}, {5, 3}, {6, 4}} {
+        t.Run(fmt.Sprintf("%d of %d", tt.k, tt.n), func(t *testing.T) {
+            key := testKey(t)
+            shares, err := SplitKey(key, tt.n, tt.k)
+            if err != nil {
+                t.Fatal(err)
+            }
+            for _, mask := range subsets(tt.n) {
+                sub := pick(shares, mask)
+                got, err := CombineKeyShares(sub)
+                if len(sub) < tt.k {
+                    if !errors.Is(err, ErrNotEnoughShares) {
+                        t.Errorf("%d shares: error = %v, want ErrNotEnoughShares", len(sub), err)
+                    }
+                    continue
+                }
+                if err != nil {
+                    t.Fatalf("shares %b: %v", mask, err)
+                }
+                if !bytes.Equal(got, key) {
+                    t.Fatalf("shares %b: wrong key", mask)
+                }
+            }
+        })
+    }
+}
+
+func TestSplitKeyInvalid(t *testing.T) {
+    for _, tt := range []struct{ n, k int }{{1, 1}, {3, 1}, {2, 3}, {256, 2}} {
+        if _, err := SplitKey(testKey(t), tt.n, tt.k); err == nil {
+            t.Errorf("SplitKey(%d of %d) succeeded", tt.k, tt.n)
+        }
+    }
+}
+
+func TestCombineKeySharesErrors(t *testing.T) {
+    key := testKey(t)
+    shares, err := SplitKey(key, 4, 3)
+    if err != nil {
+        t.Fatal(err)
+    }
+    other, err := SplitKey(key, 4, 3)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    corrupt := func(s KeyShare, b int) KeyShare {
+        s.Value = append([]byte(nil), s.Value...)
+        s.Value[b] ^= 0x40
+        return s
+    }
+    tests := []struct {
+        name   string
+        shares []KeyShare
+        want   error
+    }{
+        {"none", nil, ErrNotEnoughShares},
+        {"too few", shares[:2], ErrNotEnoughShares},
+        {"duplicate", []KeyShare{shares[0], shares[1], shares[0]}, ErrDuplicateShare},
+        {"different splits", []KeyShare{shares[0], shares[1], other[2]}, ErrShareMismatch},
+        {"corrupted key byte", []KeyShare{shares[0], corrupt(shares[1], 0), shares[2]}, ErrShareKeyMismatch},
+        {"corrupted check byte", []KeyShare{shares[0], shares[1], corrupt(shares[2], len(key)+3)}, ErrShareKeyMismatch},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if _, err := CombineKeyShares(tt.shares); !errors.Is(err, tt.want) {
+                t.Errorf("error = %v, want %v", err, tt.want)
+            }
+        })
+    }
+}
+
+func TestKeyShareEncodeParse(t *testing.T) {
+    key := testKey(t)
+    shares, err := SplitKey(key, 3, 2)
+    if err != nil {
+        t.Fatal(err)
+    }
+    var parsed []KeyShare
+    for _, s := range shares {
+        p, err := ParseKeyShare(" " + s.Encode() + "\n")
+        if err != nil {
+            t.Fatal(err)
+        }
+        if !reflect.DeepEqual(p, s) {
+            t.Fatalf("parsed %+v, want %+v", p, s)
+        }
+        parsed = append(parsed, p)
+    }
+    got, err := CombineKeyShares(parsed[1:])
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !bytes.Equal(got, key) {
+        t.Error("wrong key")
+    }
+}
+
+func TestParseKeyShareInvalid(t *testing.T) {
+    shares, err := SplitKey(testKey(t), 3, 2)
+    if err != nil {
+        t.Fatal(err)
+    }
+    enc := shares[0].Encode()
+    body, err := base64.RawURLEncoding.DecodeString(enc[len(KeySharePrefix):])
+    if err != nil {
+        t.Fatal(err)
+    }
+    encode := func(body []byte) string {
+        sum := sha256.Sum256(body[:len(body)-4])
+        copy(body[len(body)-4:], sum[:4])
+        return KeySharePrefix + base64.RawURLEncoding.EncodeToString(body)
+    }
+    flipped := KeySharePrefix + base64.RawURLEncoding.EncodeToString(append([]byte{body[0] ^ 1}, body[1:]...))
+    v1 := encode(append([]byte{1}, body[1:]...))
+
+    tests := []struct {
+        name string
+        text string
+        want error
+    }{
+        {"prefix", "SHARE-" + enc[len(KeySharePrefix):], nil},
+        {"base64", enc + "!", nil},
+        {"too short", KeySharePrefix + "AAAA", nil},
+        {"checksum", flipped, ErrShareChecksum},
+        {"version 1", v1, nil},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            _, err := ParseKeyShare(tt.text)
+            if err == nil {
+                t.Fatal("parsed an invalid share")
+            }
+            if tt.want != nil && !errors.Is(err, tt.want) {
+                t.Errorf("error = %v, want %v", err, tt.want)
+            }
+        })
+    }
+}
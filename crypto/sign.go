@@ -0,0 +1,157 @@
+// crypto/sign.go
+package crypto
+
+import (
+    "bytes"
+    "crypto"
+    "crypto/ed25519"
+    "crypto/rand"
+    "crypto/sha512"
+    "encoding/base64"
+    "errors"
+    "hash"
+    "os"
+    "strings"
+)
+
+// ExtSignature marks a signed container. Its value is the signer's Ed25519
+// public key, and an Ed25519 signature of SignatureSize bytes follows the
+// last payload chunk. It is critical because readers that do not know it
+// would take the signature for payload.
+const ExtSignature uint16 = 1
+
+// SignatureSize is the size of the signature trailer of a signed container.
+const SignatureSize = ed25519.SignatureSize
+
+// Text prefixes for encoded Ed25519 keys.
+const (
+    Ed25519PublicKeyPrefix = "ed25519:"
+    Ed25519SecretKeyPrefix = "ED25519-SECRET:"
+)
+
+// signatureContext separates container signatures from other Ed25519ph uses.
+const signatureContext = "ecrypto container signature v1"
+
+// Signature errors.
+var (
+    ErrUnsigned       = errors.New("container is not signed")
+    ErrBadSignature   = errors.New("container signature is invalid")
+    ErrSignerMismatch = errors.New("container is signed by a different key")
+)
+
+func init() {
+    knownExtensions[ExtSignature] = "ed25519-signature"
+}
+
+// GenerateEd25519 returns a new Ed25519 signing key and its public key.
+func GenerateEd25519() (ed25519.PrivateKey, ed25519.PublicKey, error) {
+    pub, priv, err := ed25519.GenerateKey(rand.Reader)
+    return priv, pub, err
+}
+
+// EncodeEd25519PublicKey returns the text form of a public key.
+func EncodeEd25519PublicKey(pub ed25519.PublicKey) string {
+    return Ed25519PublicKeyPrefix + base64.RawURLEncoding.EncodeToString(pub)
+}
+
+// EncodeEd25519SecretKey returns the text form of a signing key (its seed).
+func EncodeEd25519SecretKey(priv ed25519.PrivateKey) string {
+    return Ed25519SecretKeyPrefix + base64.RawURLEncoding.EncodeToString(priv.Seed())
+}
+
+// ParseEd25519PublicKey parses a public key in text form.
+func ParseEd25519PublicKey(s string) (ed25519.PublicKey, error) {
+    s = strings.TrimSpace(s)
+    if !strings.HasPrefix(s, Ed25519PublicKeyPrefix) {
+        return nil, errors.New("invalid public key: expected " + Ed25519PublicKeyPrefix + " prefix")
+    }
+    key, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(s, Ed25519PublicKeyPrefix))
+    if err != nil {
+        return nil, err
+    }
+    if len(key) != ed25519.PublicKeySize {
+        return nil, errors.New("invalid Ed25519 public key length")
+    }
+    return ed25519.PublicKey(key), nil
+}
+
+// ParseEd25519SecretKey parses a signing key in text form.
+func ParseEd25519SecretKey(s string) (ed25519.PrivateKey, error) {
+    s = strings.TrimSpace(s)
+    if !strings.HasPrefix(s, Ed25519SecretKeyPrefix) {
+        return nil, errors.New("invalid signing key: expected " + Ed25519SecretKeyPrefix + " prefix")
+    }
+    seed, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(s, Ed25519SecretKeyPrefix))
+    if err != nil {
+        return nil, err
+    }
+    if len(seed) != ed25519.SeedSize {
+        return nil, errors.New("invalid Ed25519 signing key length")
+    }
+    return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// ReadEd25519SecretKey reads a signing key file written by keygen. Lines
+// starting with # are comments.
+func ReadEd25519SecretKey(path string) (ed25519.PrivateKey, error) {
+    raw, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    for _, line := range strings.Split(string(raw), "\n") {
+        line = strings.TrimSpace(line)
+        if line == "" || strings.HasPrefix(line, "#") {
+            continue
+        }
+        return ParseEd25519SecretKey(line)
+    }
+    return nil, errors.New("no signing key found in " + path)
+}
+
+// NewSignatureHash returns the hash a container signature covers. The
+// caller writes the whole encoded header, including the extension area
+// that holds the signer's key and every key stanza, followed by the
+// encrypted payload. Adding, removing or replacing a stanza, for example
+// another recipient, therefore breaks the signature.
+func NewSignatureHash() hash.Hash {
+    return sha512.New()
+}
+
+// SignContainer signs a digest from NewSignatureHash with Ed25519ph.
+func SignContainer(priv ed25519.PrivateKey, digest []byte) ([]byte, error) {
+    return priv.Sign(nil, digest, &ed25519.Options{Hash: crypto.SHA512, Context: signatureContext})
+}
+
+// SignatureExtension returns the header extension recording the signer.
+func SignatureExtension(pub ed25519.PublicKey) Extension {
+    return Extension{Type: ExtSignature, Critical: true, Value: append([]byte(nil), pub...)}
+}
+
+// Signer returns the public key recorded in a signed header.
+func (h *HeaderV2) Signer() (ed25519.PublicKey, bool) {
+    ext, ok := h.Extension(ExtSignature)
+    if !ok || len(ext.Value) != ed25519.PublicKeySize {
+        return nil, false
+    }
+    return ed25519.PublicKey(ext.Value), true
+}
+
+// VerifyContainerSignature checks sig over digest against the signer
+// recorded in h. If want is non-nil the signer must also be want.
+func VerifyContainerSignature(h *HeaderV2, want ed25519.PublicKey, digest, sig []byte) error {
+    if _, ok := h.Extension(ExtSignature); !ok {
+        return ErrUnsigned
+    }
+    signer, ok := h.Signer()
+    if !ok {
+        return ErrBadSignature
+    }
+    if want != nil && !bytes.Equal(signer, want) {
+        return ErrSignerMismatch
+    }
+    opts := &ed25519.Options{Hash: crypto.SHA512, Context: signatureContext}
+    if err := ed25519.VerifyWithOptions(signer, digest, sig, opts); err != nil {
+        return ErrBadSignature
+    }
+    return nil
+}
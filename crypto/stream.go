@@ -0,0 +1,368 @@
+// crypto/stream.go
+package crypto
+
+import (
+    "bufio"
+    "crypto/cipher"
+    "encoding/binary"
+    "errors"
+    "io"
+    "sync"
+
+    "golang.org/x/crypto/chacha20poly1305"
+)
+
+// Chunk size limits for the streaming (v2) format.
+const (
+    DefaultChunkSize = 64 * 1024
+    MinChunkSize     = 1024
+    MaxChunkSize     = 16 * 1024 * 1024
+)
+
+// NoncePrefixSize is the size of the random per-container nonce prefix.
+// Each chunk nonce is prefix(16) || counter(7, big-endian) || last flag(1).
+const NoncePrefixSize = 16
+
+// ChunkOverhead is the number of bytes encryption adds to each chunk.
+const ChunkOverhead = chacha20poly1305.Overhead
+
+const maxChunkCounter = 1<<56 - 1
+
+var (
+    // ErrStreamTruncated is returned when the payload ends before its final chunk.
+    ErrStreamTruncated = errors.New("container truncated: final chunk missing")
+    // ErrChunkAuth is returned when a chunk fails authentication.
+    ErrChunkAuth = errors.New("decryption failed: authentication tag mismatch or wrong key")
+)
+
+func newStreamAEAD(key, noncePrefix []byte, chunkSize int) (cipher.AEAD, error) {
+    if len(key) != chacha20poly1305.KeySize {
+        return nil, errors.New("key must be 32 bytes")
+    }
+    if len(noncePrefix) != NoncePrefixSize {
+        return nil, errors.New("nonce prefix must be 16 bytes")
+    }
+    if chunkSize < MinChunkSize || chunkSize > MaxChunkSize {
+        return nil, errors.New("invalid chunk size")
+    }
+    return chacha20poly1305.NewX(key)
+}
+
+// streamNonce builds the XChaCha20 nonce for chunk number counter.
+func streamNonce(dst *[chacha20poly1305.NonceSizeX]byte, prefix []byte, counter uint64, last bool) {
+    copy(dst[:NoncePrefixSize], prefix)
+    var ctr [8]byte
+    binary.BigEndian.PutUint64(ctr[:], counter)
+    copy(dst[NoncePrefixSize:NoncePrefixSize+7], ctr[1:])
+    dst[chacha20poly1305.NonceSizeX-1] = 0
+    if last {
+        dst[chacha20poly1305.NonceSizeX-1] = 1
+    }
+}
+
+// StreamWriter encrypts data written to it as a sequence of fixed-size
+// XChaCha20-Poly1305 chunks. Close must be called to seal the final chunk.
+type StreamWriter struct {
+    w         io.Writer
+    aead      cipher.AEAD
+    aad       []byte
+    prefix    []byte
+    chunkSize int
+    counter   uint64
+    buf       []byte
+    out       []byte
+    nonce     [chacha20poly1305.NonceSizeX]byte
+    closed    bool
+}
+
+// NewStreamWriter returns a StreamWriter that writes encrypted chunks to w.
+// aad is authenticated with every chunk.
+func NewStreamWriter(w io.Writer, key, aad, noncePrefix []byte, chunkSize int) (*StreamWriter, error) {
+    aead, err := newStreamAEAD(key, noncePrefix, chunkSize)
+    if err != nil {
+        return nil, err
+    }
+    return &StreamWriter{
+        w:         w,
+        aead:      aead,
+        aad:       append([]byte(nil), aad...),
+        prefix:    append([]byte(nil), noncePrefix...),
+        chunkSize: chunkSize,
+        buf:       make([]byte, 0, chunkSize),
+        out:       make([]byte, 0, chunkSize+aead.Overhead()),
+    }, nil
+}
+
+// Write buffers p and emits every chunk that is known not to be the last.
+func (s *StreamWriter) Write(p []byte) (int, error) {
+    if s.closed {
+        return 0, errors.New("write to closed stream")
+    }
+    written := 0
+    for len(p) > 0 {
+        // A full buffer is only flushed once more data arrives, so the
+        // final chunk may itself be full.
+        if len(s.buf) == s.chunkSize {
+            if err := s.flush(false); err != nil {
+                return written, err
+            }
+        }
+        n := copy(s.buf[len(s.buf):s.chunkSize], p)
+        s.buf = s.buf[:len(s.buf)+n]
+        p = p[n:]
+        written += n
+    }
+    return written, nil
+}
+
+// Close seals the final chunk. It does not close the underlying writer.
+func (s *StreamWriter) Close() error {
+    if s.closed {
+        return nil
+    }
+    s.closed = true
+    return s.flush(true)
+}
+
+func (s *StreamWriter) flush(last bool) error {
+    if s.counter > maxChunkCounter {
+        return errors.New("stream too large: chunk counter overflow")
+    }
+    streamNonce(&s.nonce, s.prefix, s.counter, last)
+    s.out = s.aead.Seal(s.out[:0], s.nonce[:], s.buf, s.aad)
+    if _, err := s.w.Write(s.out); err != nil {
+        return err
+    }
+    s.counter++
+    s.buf = s.buf[:0]
+    return nil
+}
+
+// StreamReader decrypts a chunked stream produced by StreamWriter.
+// It returns ErrStreamTruncated if the final chunk is missing and
+// ErrChunkAuth if any chunk was modified, reordered or the key is wrong.
+type StreamReader struct {
+    r         *bufio.Reader
+    aead      cipher.AEAD
+    aad       []byte
+    prefix    []byte
+    counter   uint64
+    enc       []byte
+    plain     []byte
+    pending   []byte
+    nonce     [chacha20poly1305.NonceSizeX]byte
+    done      bool
+    err       error
+}
+
+// NewStreamReader returns a StreamReader reading encrypted chunks from r.
+func NewStreamReader(r io.Reader, key, aad, noncePrefix []byte, chunkSize int) (*StreamReader, error) {
+    aead, err := newStreamAEAD(key, noncePrefix, chunkSize)
+    if err != nil {
+        return nil, err
+    }
+    return &StreamReader{
+        r:      bufio.NewReaderSize(r, chunkSize+aead.Overhead()),
+        aead:   aead,
+        aad:    append([]byte(nil), aad...),
+        prefix: append([]byte(nil), noncePrefix...),
+        enc:    make([]byte, chunkSize+aead.Overhead()),
+        plain:  make([]byte, 0, chunkSize),
+    }, nil
+}
+
+// Read implements io.Reader.
+func (s *StreamReader) Read(p []byte) (int, error) {
+    for len(s.pending) == 0 {
+        if s.err != nil {
+            return 0, s.err
+        }
+        if s.done {
+            return 0, io.EOF
+        }
+        s.err = s.readChunk()
+    }
+    n := copy(p, s.pending)
+    s.pending = s.pending[n:]
+    return n, nil
+}
+
+// Chunks returns the number of chunks authenticated so far. After an
+// error it is the index of the chunk that failed.
+func (s *StreamReader) Chunks() uint64 {
+    return s.counter
+}
+
+func (s *StreamReader) readChunk() error {
+    n, err := io.ReadFull(s.r, s.enc)
+    last := false
+    switch {
+    case err == io.EOF || err == io.ErrUnexpectedEOF:
+        last = true
+    case err != nil:
+        return err
+    default:
+        // A full chunk is the last one only if nothing follows it.
+        if _, perr := s.r.Peek(1); perr == io.EOF {
+            last = true
+        } else if perr != nil {
+            return perr
+        }
+    }
+    if n < s.aead.Overhead() {
+        return ErrStreamTruncated
+    }
+    pt, err := openChunk(s.aead, s.plain[:0], &s.nonce, s.prefix, s.counter, s.enc[:n], s.aad, last)
+    if err != nil {
+        return err
+    }
+    s.plain = pt
+    s.pending = pt
+    s.counter++
+    s.done = last
+    return nil
+}
+
+// openChunk decrypts one chunk. When a chunk expected to be final only
+// authenticates as a non-final chunk, the stream was cut at a chunk boundary.
+func openChunk(aead cipher.AEAD, dst []byte, nonce *[chacha20poly1305.NonceSizeX]byte, prefix []byte, counter uint64, enc, aad []byte, last bool) ([]byte, error) {
+    if counter > maxChunkCounter {
+        return nil, errors.New("stream too large: chunk counter overflow")
+    }
+    streamNonce(nonce, prefix, counter, last)
+    pt, err := aead.Open(dst, nonce[:], enc, aad)
+    if err == nil {
+        return pt, nil
+    }
+    if last {
+        streamNonce(nonce, prefix, counter, false)
+        if _, err := aead.Open(dst, nonce[:], enc, aad); err == nil {
+            return nil, ErrStreamTruncated
+        }
+    }
+    return nil, ErrChunkAuth
+}
+
+// StreamReaderAt provides random access to the plaintext of a chunked
+// stream stored in an io.ReaderAt. Only the chunks covering a read are
+// decrypted, so memory use is bounded by the chunk size. The final chunk
+// is authenticated up front, which detects truncation and wrong keys
+// before any plaintext is returned.
+type StreamReaderAt struct {
+    r         io.ReaderAt
+    offset    int64
+    aead      cipher.AEAD
+    aad       []byte
+    prefix    []byte
+    chunkSize int64
+    chunks    int64
+    lastEnc   int64
+    size      int64
+
+    mu        sync.Mutex
+    cachedIdx int64
+    cached    []byte
+    enc       []byte
+    nonce     [chacha20poly1305.NonceSizeX]byte
+}
+
+// NewStreamReaderAt returns a StreamReaderAt over the length encrypted
+// bytes of r starting at offset.
+func NewStreamReaderAt(r io.ReaderAt, offset, length int64, key, aad, noncePrefix []byte, chunkSize int) (*StreamReaderAt, error) {
+    aead, err := newStreamAEAD(key, noncePrefix, chunkSize)
+    if err != nil {
+        return nil, err
+    }
+    overhead := int64(aead.Overhead())
+    encChunk := int64(chunkSize) + overhead
+    if length < overhead {
+        return nil, ErrStreamTruncated
+    }
+    chunks := (length + encChunk - 1) / encChunk
+    lastEnc := length - (chunks-1)*encChunk
+    if lastEnc < overhead {
+        return nil, ErrStreamTruncated
+    }
+    s := &StreamReaderAt{
+        r:         r,
+        offset:    offset,
+        aead:      aead,
+        aad:       append([]byte(nil), aad...),
+        prefix:    append([]byte(nil), noncePrefix...),
+        chunkSize: int64(chunkSize),
+        chunks:    chunks,
+        lastEnc:   lastEnc,
+        size:      (chunks-1)*int64(chunkSize) + lastEnc - overhead,
+        cachedIdx: -1,
+        cached:    make([]byte, 0, chunkSize),
+        enc:       make([]byte, encChunk),
+    }
+    if _, err := s.chunk(chunks - 1); err != nil {
+        return nil, err
+    }
+    return s, nil
+}
+
+// Size returns the plaintext size.
+func (s *StreamReaderAt) Size() int64 {
+    return s.size
+}
+
+// Chunks returns the number of encrypted chunks in the stream.
+func (s *StreamReaderAt) Chunks() int64 {
+    return s.chunks
+}
+
+// ReadAt implements io.ReaderAt.
+func (s *StreamReaderAt) ReadAt(p []byte, off int64) (int, error) {
+    if off < 0 {
+        return 0, errors.New("negative offset")
+    }
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    n := 0
+    for n < len(p) {
+        if off >= s.size {
+            return n, io.EOF
+        }
+        idx := off / s.chunkSize
+        pt, err := s.chunk(idx)
+        if err != nil {
+            return n, err
+        }
+        c := copy(p[n:], pt[off-idx*s.chunkSize:])
+        n += c
+        off += int64(c)
+    }
+    return n, nil
+}
+
+// chunk returns the plaintext of chunk idx; callers must hold s.mu
+// (or be the constructor).
+func (s *StreamReaderAt) chunk(idx int64) ([]byte, error) {
+    if idx == s.cachedIdx {
+        return s.cached, nil
+    }
+    encChunk := s.chunkSize + int64(s.aead.Overhead())
+    encLen := encChunk
+    last := idx == s.chunks-1
+    if last {
+        encLen = s.lastEnc
+    }
+    enc := s.enc[:encLen]
+    if n, err := s.r.ReadAt(enc, s.offset+idx*encChunk); n < len(enc) {
+        if err == nil || err == io.EOF {
+            return nil, ErrStreamTruncated
+        }
+        return nil, err
+    }
+    s.cachedIdx = -1
+    pt, err := openChunk(s.aead, s.cached[:0], &s.nonce, s.prefix, uint64(idx), enc, s.aad, last)
+    if err != nil {
+        return nil, err
+    }
+    s.cached = pt
+    s.cachedIdx = idx
+    return pt, nil
+}
@@ -0,0 +1,184 @@
+// crypto/stream_test.go
+package crypto
+
+import (
+    "bytes"
+    "crypto/rand"
+    "errors"
+    "io"
+    "testing"
+)
+
+const testChunkSize = MinChunkSize
+
+// testStream holds the inputs of one encrypted stream.
+type testStream struct {
+    key, aad, prefix []byte
+}
+
+func newTestStream(t *testing.T) testStream {
+    t.Helper()
+    s := testStream{key: make([]byte, 32), aad: []byte("header"), prefix: make([]byte, NoncePrefixSize)}
+    rand.Read(s.key)
+    rand.Read(s.prefix)
+    return s
+}
+
+func (s testStream) seal(t *testing.T, plain []byte) []byte {
+    t.Helper()
+    var buf bytes.Buffer
+    w, err := NewStreamWriter(&buf, s.key, s.aad, s.prefix, testChunkSize)
+    if err != nil {
+        t.Fatal(err)
+    }
+    // Uneven writes exercise the chunk buffering.
+    for p := plain; len(p) > 0; {
+        n := min(len(p), 700)
+        if _, err := w.Write(p[:n]); err != nil {
+            t.Fatal(err)
+        }
+        p = p[n:]
+    }
+    if err := w.Close(); err != nil {
+        t.Fatal(err)
+    }
+    return buf.Bytes()
+}
+
+// open decrypts enc with both StreamReader and StreamReaderAt and checks
+// that they agree.
+func (s testStream) open(t *testing.T, enc []byte) ([]byte, error) {
+    t.Helper()
+    sr, err := NewStreamReader(bytes.NewReader(enc), s.key, s.aad, s.prefix, testChunkSize)
+    if err != nil {
+        t.Fatal(err)
+    }
+    seq, seqErr := io.ReadAll(sr)
+
+    var at []byte
+    sra, atErr := NewStreamReaderAt(bytes.NewReader(enc), 0, int64(len(enc)), s.key, s.aad, s.prefix, testChunkSize)
+    if atErr == nil {
+        at, atErr = io.ReadAll(io.NewSectionReader(sra, 0, sra.Size()))
+    }
+
+    if !errors.Is(atErr, seqErr) && !errors.Is(seqErr, atErr) {
+        t.Fatalf("StreamReader error %v, StreamReaderAt error %v", seqErr, atErr)
+    }
+    if seqErr == nil && !bytes.Equal(seq, at) {
+        t.Fatal("StreamReader and StreamReaderAt disagree")
+    }
+    return seq, seqErr
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+    for _, size := range []int{0, 1, testChunkSize - 1, testChunkSize, testChunkSize + 1, 3 * testChunkSize, 3*testChunkSize + 5} {
+        s := newTestStream(t)
+        plain := make([]byte, size)
+        rand.Read(plain)
+
+        enc := s.seal(t, plain)
+        chunks := max((size+testChunkSize-1)/testChunkSize, 1)
+        if want := size + chunks*ChunkOverhead; len(enc) != want {
+            t.Errorf("size %d: encrypted %d bytes, want %d", size, len(enc), want)
+        }
+        got, err := s.open(t, enc)
+        if err != nil {
+            t.Fatalf("size %d: %v", size, err)
+        }
+        if !bytes.Equal(got, plain) {
+            t.Fatalf("size %d: plaintext mismatch", size)
+        }
+    }
+}
+
+func TestStreamTamper(t *testing.T) {
+    const encChunk = testChunkSize + ChunkOverhead
+    tests := []struct {
+        name   string
+        modify func(s *testStream, enc []byte) []byte
+        want   error
+    }{
+        {"bit flip", func(_ *testStream, enc []byte) []byte {
+            enc[encChunk+10] ^= 1
+            return enc
+        }, ErrChunkAuth},
+        {"chunks swapped", func(_ *testStream, enc []byte) []byte {
+            out := append([]byte(nil), enc[encChunk:2*encChunk]...)
+            out = append(out, enc[:encChunk]...)
+            return append(out, enc[2*encChunk:]...)
+        }, ErrChunkAuth},
+        {"final chunk dropped", func(_ *testStream, enc []byte) []byte {
+            return enc[:3*encChunk]
+        }, ErrStreamTruncated},
+        {"cut inside a chunk", func(_ *testStream, enc []byte) []byte {
+            return enc[:2*encChunk+100]
+        }, ErrChunkAuth},
+        {"cut inside a tag", func(_ *testStream, enc []byte) []byte {
+            return enc[:3*encChunk+ChunkOverhead-1]
+        }, ErrStreamTruncated},
+        {"data appended", func(_ *testStream, enc []byte) []byte {
+            return append(enc, make([]byte, 40)...)
+        }, ErrChunkAuth},
+        {"final chunk duplicated", func(_ *testStream, enc []byte) []byte {
+            return append(enc, enc[3*encChunk:]...)
+        }, ErrChunkAuth},
+        {"header changed", func(s *testStream, enc []byte) []byte {
+            s.aad = []byte("HEADER")
+            return enc
+        }, ErrChunkAuth},
+        {"nonce prefix changed", func(s *testStream, enc []byte) []byte {
+            s.prefix[0] ^= 1
+            return enc
+        }, ErrChunkAuth},
+        {"wrong key", func(s *testStream, enc []byte) []byte {
+            s.key[0] ^= 1
+            return enc
+        }, ErrChunkAuth},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            s := newTestStream(t)
+            plain := make([]byte, 3*testChunkSize+5)
+            rand.Read(plain)
+            enc := tt.modify(&s, s.seal(t, plain))
+            if _, err := s.open(t, enc); !errors.Is(err, tt.want) {
+                t.Errorf("error = %v, want %v", err, tt.want)
+            }
+        })
+    }
+}
+
+func TestStreamReaderAtRandomAccess(t *testing.T) {
+    s := newTestStream(t)
+    plain := make([]byte, 5*testChunkSize+17)
+    rand.Read(plain)
+    enc := s.seal(t, plain)
+
+    // The payload sits after a header in the file.
+    file := append(make([]byte, 33), enc...)
+    sr, err := NewStreamReaderAt(bytes.NewReader(file), 33, int64(len(enc)), s.key, s.aad, s.prefix, testChunkSize)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if sr.Size() != int64(len(plain)) || sr.Chunks() != 6 {
+        t.Fatalf("size %d, chunks %d; want %d, 6", sr.Size(), sr.Chunks(), len(plain))
+    }
+
+    tests := []struct {
+        off, n int
+    }{
+        {0, 10}, {testChunkSize - 3, 6}, {2 * testChunkSize, testChunkSize}, {len(plain) - 4, 4}, {17, 3 * testChunkSize},
+    }
+    for _, tt := range tests {
+        buf := make([]byte, tt.n)
+        if _, err := sr.ReadAt(buf, int64(tt.off)); err != nil && !errors.Is(err, io.EOF) {
+            t.Fatalf("ReadAt(%d, %d): %v", tt.off, tt.n, err)
+        }
+        if !bytes.Equal(buf, plain[tt.off:tt.off+tt.n]) {
+            t.Errorf("ReadAt(%d, %d): wrong plaintext", tt.off, tt.n)
+        }
+    }
+    if n, err := sr.ReadAt(make([]byte, 8), int64(len(plain))-2); n != 2 || err != io.EOF {
+        t.Errorf("read past the end: n = %d, err = %v; want 2, EOF", n, err)
+    }
+}
@@ -5,9 +5,17 @@ import (
     "bytes"
     "encoding/binary"
     "errors"
+    "fmt"
     "io"
 )
 
+// Key derivation modes stored in the header KDF field.
+const (
+    KDFRawKey     uint8 = 0 // key read from a key file
+    KDFArgon2id   uint8 = 1 // key derived from a passphrase
+    KDFWrapped    uint8 = 2 // random file key wrapped in header stanzas
+)
+
 // HeaderV1 is the .ecrypt container header (v1 format).
 type HeaderV1 struct {
     Magic   [8]byte // "ECRYPT01"
@@ -46,8 +54,8 @@ func DecodeHeaderV1(r io.Reader) (*HeaderV1, error) {
     if err := binary.Read(r, binary.LittleEndian, &h.Version); err != nil {
         return nil, err
     }
-    if h.Version != 1 {
-        return nil, errors.New("unsupported container version")
+    if h.Version != VersionV1 {
+        return nil, ErrUnsupportedVersion
     }
     if err := binary.Read(r, binary.LittleEndian, &h.KDF); err != nil {
         return nil, err
@@ -64,6 +72,11 @@ func DecodeHeaderV1(r io.Reader) (*HeaderV1, error) {
     if err := binary.Read(r, binary.LittleEndian, &h.Salt); err != nil {
         return nil, err
     }
+    if h.KDF == KDFArgon2id {
+        if err := CheckArgon2idParams(h.ArgonM, h.ArgonT, h.ArgonP); err != nil {
+            return nil, err
+        }
+    }
     if err := binary.Read(r, binary.LittleEndian, &h.Nonce); err != nil {
         return nil, err
     }
@@ -73,4 +86,231 @@ func DecodeHeaderV1(r io.Reader) (*HeaderV1, error) {
 // HeaderSize returns the byte size of an encoded HeaderV1.
 func HeaderSize() int {
     return 8 + 1 + 1 + 4 + 4 + 1 + 16 + 24 // 59 bytes
-}
\ No newline at end of file
+}
+
+// Container format versions.
+const (
+    VersionV1      uint8 = 1 // single AEAD over the whole payload
+    VersionV2      uint8 = 2 // chunked STREAM payload
+    VersionV3      uint8 = 3 // v2 plus an authenticated extension area
+    CurrentVersion       = VersionV3
+)
+
+// ErrUnsupportedVersion is returned for container versions this build
+// cannot read.
+var ErrUnsupportedVersion = errors.New("unsupported container version")
+
+// HeaderV2 is the .ecrypt container header for the streaming formats
+// (versions 2 and 3). The payload that follows is a sequence of fixed-size
+// encrypted chunks (see StreamWriter). The preamble (magic, version, chunk
+// size and nonce prefix) and, in version 3, the extension area that follows
+// it are bound to every chunk as AAD; the key derivation fields are
+// authenticated implicitly because changing them yields a different key.
+type HeaderV2 struct {
+    Magic       [8]byte     // "ECRYPT01"
+    Version     uint8       // 2 or 3
+    ChunkSize   uint32      // plaintext bytes per chunk
+    NoncePrefix [16]byte    // random per-container nonce prefix
+    Extensions  []Extension // version 3 only
+    KDF         uint8       // 0=raw key, 1=Argon2id, 2=wrapped key stanzas
+    ArgonM      uint32      // Argon2 memory (KiB)
+    ArgonT      uint32      // Argon2 time cost
+    ArgonP      uint8       // Argon2 parallelism
+    Salt        [16]byte
+    Stanzas     []Stanza    // present only when KDF=2
+}
+
+// Stanza is one wrapped copy of the file key, e.g. for a single recipient
+// or a passphrase. Any stanza that unwraps yields the same file key.
+// Stanzas are not part of the AAD: each body is itself authenticated, and a
+// forged stanza cannot produce a key that decrypts the payload.
+type Stanza struct {
+    Type uint8
+    Body []byte
+}
+
+// Stanza types.
+const (
+    StanzaX25519    uint8 = 1 // wrapped for an X25519 recipient
+    StanzaArgon2id  uint8 = 2 // wrapped with an Argon2id passphrase key
+    StanzaKeyFile   uint8 = 3 // wrapped with a raw key file
+    StanzaTwoFactor uint8 = 4 // wrapped with a passphrase and a key file together
+    StanzaRecovery  uint8 = 5 // wrapped for an X25519 organization recovery key
+)
+
+// maxStanzas bounds the stanza count accepted when decoding a header.
+const maxStanzas = 1024
+
+// headerV2PreambleSize is the size of the fixed HeaderV2 fields that start
+// the AAD.
+const headerV2PreambleSize = 8 + 1 + 4 + 16 // 29 bytes
+
+// Encode serializes HeaderV2 to bytes.
+func (h *HeaderV2) Encode() []byte {
+    var buf bytes.Buffer
+    _ = binary.Write(&buf, binary.LittleEndian, h.Magic)
+    _ = binary.Write(&buf, binary.LittleEndian, h.Version)
+    _ = binary.Write(&buf, binary.LittleEndian, h.ChunkSize)
+    _ = binary.Write(&buf, binary.LittleEndian, h.NoncePrefix)
+    if h.Version >= VersionV3 {
+        buf.Write(encodeExtensions(h.Extensions))
+    }
+    _ = binary.Write(&buf, binary.LittleEndian, h.KDF)
+    _ = binary.Write(&buf, binary.LittleEndian, h.ArgonM)
+    _ = binary.Write(&buf, binary.LittleEndian, h.ArgonT)
+    _ = binary.Write(&buf, binary.LittleEndian, h.ArgonP)
+    _ = binary.Write(&buf, binary.LittleEndian, h.Salt)
+    if h.KDF == KDFWrapped {
+        _ = binary.Write(&buf, binary.LittleEndian, uint16(len(h.Stanzas)))
+        for _, st := range h.Stanzas {
+            _ = binary.Write(&buf, binary.LittleEndian, st.Type)
+            _ = binary.Write(&buf, binary.LittleEndian, uint16(len(st.Body)))
+            buf.Write(st.Body)
+        }
+    }
+    return buf.Bytes()
+}
+
+// AAD returns the header bytes authenticated with every payload chunk.
+func (h *HeaderV2) AAD() []byte {
+    return h.Encode()[:h.aadSize()]
+}
+
+// aadSize is the length of the preamble plus, in version 3, the extension
+// area.
+func (h *HeaderV2) aadSize() int {
+    if h.Version >= VersionV3 {
+        return headerV2PreambleSize + extensionsSize(h.Extensions)
+    }
+    return headerV2PreambleSize
+}
+
+// Size returns the byte size of the encoded header.
+func (h *HeaderV2) Size() int {
+    size := h.aadSize() + 1 + 4 + 4 + 1 + 16
+    if h.KDF == KDFWrapped {
+        size += 2
+        for _, st := range h.Stanzas {
+            size += 1 + 2 + len(st.Body)
+        }
+    }
+    return size
+}
+
+// DecodeHeaderV2 deserializes HeaderV2 from a reader.
+func DecodeHeaderV2(r io.Reader) (*HeaderV2, error) {
+    h := &HeaderV2{}
+    if err := binary.Read(r, binary.LittleEndian, &h.Magic); err != nil {
+        return nil, err
+    }
+    if string(h.Magic[:]) != "ECRYPT01" {
+        return nil, errors.New("invalid magic: not an ecrypto container")
+    }
+    if err := binary.Read(r, binary.LittleEndian, &h.Version); err != nil {
+        return nil, err
+    }
+    if h.Version != VersionV2 && h.Version != VersionV3 {
+        return nil, ErrUnsupportedVersion
+    }
+    if err := binary.Read(r, binary.LittleEndian, &h.ChunkSize); err != nil {
+        return nil, err
+    }
+    if h.ChunkSize < MinChunkSize || h.ChunkSize > MaxChunkSize {
+        return nil, errors.New("invalid chunk size in header")
+    }
+    if err := binary.Read(r, binary.LittleEndian, &h.NoncePrefix); err != nil {
+        return nil, err
+    }
+    if h.Version >= VersionV3 {
+        exts, err := decodeExtensions(r)
+        if err != nil {
+            return nil, err
+        }
+        h.Extensions = exts
+    }
+    if err := binary.Read(r, binary.LittleEndian, &h.KDF); err != nil {
+        return nil, err
+    }
+    if err := binary.Read(r, binary.LittleEndian, &h.ArgonM); err != nil {
+        return nil, err
+    }
+    if err := binary.Read(r, binary.LittleEndian, &h.ArgonT); err != nil {
+        return nil, err
+    }
+    if err := binary.Read(r, binary.LittleEndian, &h.ArgonP); err != nil {
+        return nil, err
+    }
+    if err := binary.Read(r, binary.LittleEndian, &h.Salt); err != nil {
+        return nil, err
+    }
+    if h.KDF == KDFArgon2id {
+        if err := CheckArgon2idParams(h.ArgonM, h.ArgonT, h.ArgonP); err != nil {
+            return nil, err
+        }
+    }
+    if h.KDF == KDFWrapped {
+        var count uint16
+        if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+            return nil, err
+        }
+        if count == 0 || count > maxStanzas {
+            return nil, errors.New("invalid key stanza count in header")
+        }
+        h.Stanzas = make([]Stanza, count)
+        for i := range h.Stanzas {
+            var bodyLen uint16
+            if err := binary.Read(r, binary.LittleEndian, &h.Stanzas[i].Type); err != nil {
+                return nil, err
+            }
+            if err := binary.Read(r, binary.LittleEndian, &bodyLen); err != nil {
+                return nil, err
+            }
+            h.Stanzas[i].Body = make([]byte, bodyLen)
+            if _, err := io.ReadFull(r, h.Stanzas[i].Body); err != nil {
+                return nil, err
+            }
+        }
+    }
+    return h, nil
+}
+
+// ReadVersion reads the magic and version byte shared by all container
+// formats, so callers can pick the matching header decoder.
+func ReadVersion(r io.Reader) (uint8, error) {
+    var magic [8]byte
+    if err := binary.Read(r, binary.LittleEndian, &magic); err != nil {
+        return 0, err
+    }
+    if string(magic[:]) != "ECRYPT01" {
+        return 0, errors.New("invalid magic: not an ecrypto container")
+    }
+    var version uint8
+    if err := binary.Read(r, binary.LittleEndian, &version); err != nil {
+        return 0, err
+    }
+    return version, nil
+}
+
+// DecodeHeader reads the header of a container of any supported version,
+// dispatching on the version byte. Exactly one of the returned headers is
+// non-nil.
+func DecodeHeader(r io.Reader) (*HeaderV1, *HeaderV2, error) {
+    var prefix [9]byte // magic + version
+    if _, err := io.ReadFull(r, prefix[:]); err != nil {
+        return nil, nil, err
+    }
+    if string(prefix[:8]) != "ECRYPT01" {
+        return nil, nil, errors.New("invalid magic: not an ecrypto container")
+    }
+    r = io.MultiReader(bytes.NewReader(prefix[:]), r)
+
+    switch prefix[8] {
+    case VersionV1:
+        h, err := DecodeHeaderV1(r)
+        return h, nil, err
+    case VersionV2, VersionV3:
+        h, err := DecodeHeaderV2(r)
+        return nil, h, err
+    }
+    return nil, nil, fmt.Errorf("%w %d", ErrUnsupportedVersion, prefix[8])
+}
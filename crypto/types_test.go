@@ -0,0 +1,145 @@
+// crypto/types_test.go
+package crypto
+
+import (
+    "bytes"
+    "errors"
+    "io"
+    "reflect"
+    "testing"
+)
+
+func testHeaderV2(version uint8) *HeaderV2 {
+    h := &HeaderV2{
+        Magic:     [8]byte{'E', 'C', 'R', 'Y', 'P', 'T', '0', '1'},
+        Version:   version,
+        ChunkSize: DefaultChunkSize,
+        KDF:       KDFWrapped,
+        Stanzas: []Stanza{
+            {Type: StanzaKeyFile, Body: bytes.Repeat([]byte{1}, 72)},
+            {Type: StanzaArgon2id, Body: bytes.Repeat([]byte{2}, 40)},
+        },
+    }
+    copy(h.NoncePrefix[:], "0123456789abcdef")
+    copy(h.Salt[:], "fedcba9876543210")
+    if version >= VersionV3 {
+        h.SetExtension(Extension{Type: 0x7f00, Value: []byte("ignored")})
+    }
+    return h
+}
+
+func TestHeaderV2RoundTrip(t *testing.T) {
+    tests := []struct {
+        name string
+        h    *HeaderV2
+    }{
+        {"v2 wrapped", testHeaderV2(VersionV2)},
+        {"v3 wrapped", testHeaderV2(VersionV3)},
+        {"v3 argon2id", &HeaderV2{
+            Magic: [8]byte{'E', 'C', 'R', 'Y', 'P', 'T', '0', '1'}, Version: VersionV3, ChunkSize: MinChunkSize,
+            KDF: KDFArgon2id, ArgonM: 64 * 1024, ArgonT: 3, ArgonP: 4,
+        }},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            enc := tt.h.Encode()
+            if len(enc) != tt.h.Size() {
+                t.Fatalf("encoded %d bytes, Size() = %d", len(enc), tt.h.Size())
+            }
+            got, err := DecodeHeaderV2(bytes.NewReader(enc))
+            if err != nil {
+                t.Fatal(err)
+            }
+            if !reflect.DeepEqual(got, tt.h) {
+                t.Errorf("decoded %+v, want %+v", got, tt.h)
+            }
+            if !bytes.Equal(got.AAD(), enc[:len(got.AAD())]) {
+                t.Error("AAD is not a prefix of the encoded header")
+            }
+        })
+    }
+}
+
+func TestDecodeHeaderV2Truncated(t *testing.T) {
+    enc := testHeaderV2(VersionV3).Encode()
+    for n := 0; n < len(enc); n++ {
+        _, err := DecodeHeaderV2(bytes.NewReader(enc[:n]))
+        if !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+            t.Fatalf("header cut to %d bytes: error = %v, want EOF", n, err)
+        }
+    }
+}
+
+func TestDecodeHeaderV2Invalid(t *testing.T) {
+    argon := func() *HeaderV2 {
+        h := testHeaderV2(VersionV3)
+        h.KDF, h.Stanzas = KDFArgon2id, nil
+        h.ArgonM, h.ArgonT, h.ArgonP = 64*1024, 3, 1
+        return h
+    }
+    // Field offsets in the encoded header.
+    const (
+        offVersion   = 8
+        offChunkSize = 9
+    )
+    offKDF := argon().aadSize()
+    offArgonT := offKDF + 1 + 4
+
+    tests := []struct {
+        name   string
+        modify func(enc []byte) []byte
+        want   error
+    }{
+        {"magic", func(enc []byte) []byte { enc[0] = 'X'; return enc }, nil},
+        {"version", func(enc []byte) []byte { enc[offVersion] = 9; return enc }, ErrUnsupportedVersion},
+        {"chunk size too small", func(enc []byte) []byte { copy(enc[offChunkSize:], []byte{1, 0, 0, 0}); return enc }, nil},
+        {"chunk size too large", func(enc []byte) []byte { copy(enc[offChunkSize:], []byte{0, 0, 0, 0x10}); return enc }, nil},
+        {"argon2id time zero", func(enc []byte) []byte { copy(enc[offArgonT:], []byte{0, 0, 0, 0}); return enc }, nil},
+        {"argon2id parallelism zero", func(enc []byte) []byte { enc[offArgonT+4] = 0; return enc }, nil},
+        {"argon2id memory too large", func(enc []byte) []byte { copy(enc[offKDF+1:], []byte{0xff, 0xff, 0xff, 0xff}); return enc }, nil},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            enc := tt.modify(argon().Encode())
+            _, err := DecodeHeaderV2(bytes.NewReader(enc))
+            if err == nil {
+                t.Fatal("decoded an invalid header")
+            }
+            if tt.want != nil && !errors.Is(err, tt.want) {
+                t.Errorf("error = %v, want %v", err, tt.want)
+            }
+        })
+    }
+}
+
+func TestHeaderTamperFailsPayload(t *testing.T) {
+    s := newTestStream(t)
+    h := testHeaderV2(VersionV3)
+    s.aad = h.AAD()
+    enc := s.seal(t, []byte("payload"))
+
+    tests := []struct {
+        name   string
+        modify func(h *HeaderV2)
+    }{
+        {"chunk size", func(h *HeaderV2) { h.ChunkSize++ }},
+        {"nonce prefix", func(h *HeaderV2) { h.NoncePrefix[3] ^= 1 }},
+        {"extension", func(h *HeaderV2) { h.Extensions[0].Value = []byte("changed") }},
+        {"extension removed", func(h *HeaderV2) { h.Extensions = nil }},
+        {"version", func(h *HeaderV2) { h.Version = VersionV2 }},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            tampered, err := DecodeHeaderV2(bytes.NewReader(h.Encode()))
+            if err != nil {
+                t.Fatal(err)
+            }
+            tt.modify(tampered)
+            s := s
+            s.aad = tampered.AAD()
+            if _, err := s.open(t, enc); !errors.Is(err, ErrChunkAuth) {
+                t.Errorf("error = %v, want ErrChunkAuth", err)
+            }
+        })
+    }
+}
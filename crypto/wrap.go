@@ -0,0 +1,241 @@
+// crypto/wrap.go
+package crypto
+
+import (
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/binary"
+    "errors"
+    "io"
+
+    "golang.org/x/crypto/chacha20poly1305"
+    "golang.org/x/crypto/hkdf"
+)
+
+// wrappedKeySize is the size of a sealed 32-byte file key.
+const wrappedKeySize = chacha20poly1305.KeySize + chacha20poly1305.Overhead
+
+// argonStanzaSize is m(4) + t(4) + p(1) + salt(16) + nonce(24) + sealed key.
+const argonStanzaSize = 4 + 4 + 1 + 16 + chacha20poly1305.NonceSizeX + wrappedKeySize
+
+// keyFileStanzaSize is nonce(24) + sealed key.
+const keyFileStanzaSize = chacha20poly1305.NonceSizeX + wrappedKeySize
+
+// ErrNoPassphraseStanza is returned when a container has no passphrase stanza.
+var ErrNoPassphraseStanza = errors.New("container has no passphrase stanza")
+
+// ErrNoKeyFileStanza is returned when a container has no key file stanza.
+var ErrNoKeyFileStanza = errors.New("container has no key file stanza")
+
+// ErrWrongPassphrase is returned when no passphrase stanza opens with the
+// passphrase.
+var ErrWrongPassphrase = errors.New("decryption failed: authentication tag mismatch or wrong passphrase")
+
+// ErrWrongKeyFile is returned when no key file stanza opens with the key.
+var ErrWrongKeyFile = errors.New("decryption failed: authentication tag mismatch or wrong key file")
+
+// ErrNoTwoFactorStanza is returned when a container has no two-factor stanza.
+var ErrNoTwoFactorStanza = errors.New("container has no passphrase + key file stanza")
+
+// ErrWrongTwoFactor is returned when no two-factor stanza opens with the
+// passphrase and key file given.
+var ErrWrongTwoFactor = errors.New("decryption failed: authentication tag mismatch or wrong passphrase or key file")
+
+// ErrTwoFactorRequired is returned when a container can only be opened
+// with both a passphrase and a key file but only one was given.
+var ErrTwoFactorRequired = errors.New("container requires both a passphrase and a key file")
+
+// twoFactorInfo separates two-factor wrapping keys from other HKDF uses.
+const twoFactorInfo = "ecrypto two-factor v1"
+
+// sealFileKey encrypts fileKey under wrapKey with a random nonce and
+// returns nonce || ciphertext.
+func sealFileKey(wrapKey, fileKey []byte) ([]byte, error) {
+    nonce := make([]byte, chacha20poly1305.NonceSizeX)
+    if _, err := rand.Read(nonce); err != nil {
+        return nil, err
+    }
+    sealed, err := EncryptAEAD(wrapKey, fileKey, nil, nonce)
+    if err != nil {
+        return nil, err
+    }
+    return append(nonce, sealed...), nil
+}
+
+// openFileKey reverses sealFileKey.
+func openFileKey(wrapKey, body []byte) ([]byte, error) {
+    if len(body) != keyFileStanzaSize {
+        return nil, errors.New("invalid wrapped key")
+    }
+    nonce := body[:chacha20poly1305.NonceSizeX]
+    return DecryptAEAD(wrapKey, body[chacha20poly1305.NonceSizeX:], nil, nonce)
+}
+
+// WrapKeyArgon2id wraps fileKey with a key derived from pass using
+// Argon2id with a fresh salt. The Argon2id parameters are stored in the stanza.
+func WrapKeyArgon2id(fileKey []byte, pass string, m, t uint32, p uint8) (Stanza, error) {
+    return wrapArgon2idStanza(StanzaArgon2id, fileKey, m, t, p, func(salt []byte) []byte {
+        return DeriveKeyArgon2id(pass, salt, m, t, p)
+    })
+}
+
+// WrapKeyTwoFactor wraps fileKey so that both pass and the key file key
+// are needed: the wrapping key is HKDF-SHA256 over the Argon2id output and
+// key, salted with the stanza salt. The stanza layout matches a passphrase
+// stanza.
+func WrapKeyTwoFactor(fileKey []byte, pass string, key []byte, m, t uint32, p uint8) (Stanza, error) {
+    return wrapArgon2idStanza(StanzaTwoFactor, fileKey, m, t, p, func(salt []byte) []byte {
+        return twoFactorKey(pass, key, salt, m, t, p)
+    })
+}
+
+// wrapArgon2idStanza builds a stanza of the given type holding m, t, p, a
+// fresh salt and fileKey sealed with derive(salt).
+func wrapArgon2idStanza(typ uint8, fileKey []byte, m, t uint32, p uint8, derive func(salt []byte) []byte) (Stanza, error) {
+    if err := CheckArgon2idParams(m, t, p); err != nil {
+        return Stanza{}, err
+    }
+    body := make([]byte, 9+16, argonStanzaSize)
+    binary.LittleEndian.PutUint32(body[0:4], m)
+    binary.LittleEndian.PutUint32(body[4:8], t)
+    body[8] = p
+    salt := body[9:25]
+    if _, err := rand.Read(salt); err != nil {
+        return Stanza{}, err
+    }
+    sealed, err := sealFileKey(derive(salt), fileKey)
+    if err != nil {
+        return Stanza{}, err
+    }
+    return Stanza{Type: typ, Body: append(body, sealed...)}, nil
+}
+
+// twoFactorKey combines the Argon2id output for pass with a key file key.
+func twoFactorKey(pass string, key, salt []byte, m, t uint32, p uint8) []byte {
+    ikm := append(DeriveKeyArgon2id(pass, salt, m, t, p), key...)
+    out := make([]byte, chacha20poly1305.KeySize)
+    if _, err := io.ReadFull(hkdf.New(sha256.New, ikm, salt, []byte(twoFactorInfo)), out); err != nil {
+        panic(err) // cannot happen: 32 bytes is far below the HKDF limit
+    }
+    return out
+}
+
+// Argon2idStanzaParams returns the Argon2id memory, time and parallelism
+// settings recorded in a passphrase or two-factor stanza. Settings outside
+// the bounds of CheckArgon2idParams are an error.
+func Argon2idStanzaParams(st Stanza) (m, t uint32, p uint8, err error) {
+    if (st.Type != StanzaArgon2id && st.Type != StanzaTwoFactor) || len(st.Body) != argonStanzaSize {
+        return 0, 0, 0, errors.New("invalid Argon2id stanza")
+    }
+    m, t, p = binary.LittleEndian.Uint32(st.Body[0:4]), binary.LittleEndian.Uint32(st.Body[4:8]), st.Body[8]
+    if err := CheckArgon2idParams(m, t, p); err != nil {
+        return 0, 0, 0, err
+    }
+    return m, t, p, nil
+}
+
+// UnwrapKeyArgon2id recovers the file key from a passphrase stanza.
+func UnwrapKeyArgon2id(st Stanza, pass string) ([]byte, error) {
+    if st.Type != StanzaArgon2id {
+        return nil, errors.New("invalid Argon2id stanza")
+    }
+    m, t, p, err := Argon2idStanzaParams(st)
+    if err != nil {
+        return nil, err
+    }
+    salt := st.Body[9:25]
+    return openFileKey(DeriveKeyArgon2id(pass, salt, m, t, p), st.Body[25:])
+}
+
+// UnwrapKeyTwoFactor recovers the file key from a two-factor stanza.
+func UnwrapKeyTwoFactor(st Stanza, pass string, key []byte) ([]byte, error) {
+    if st.Type != StanzaTwoFactor {
+        return nil, errors.New("invalid two-factor stanza")
+    }
+    m, t, p, err := Argon2idStanzaParams(st)
+    if err != nil {
+        return nil, err
+    }
+    salt := st.Body[9:25]
+    return openFileKey(twoFactorKey(pass, key, salt, m, t, p), st.Body[25:])
+}
+
+// WrapKeyWithKey wraps fileKey with a raw 32-byte key (e.g. from a key file).
+func WrapKeyWithKey(fileKey, key []byte) (Stanza, error) {
+    sealed, err := sealFileKey(key, fileKey)
+    if err != nil {
+        return Stanza{}, err
+    }
+    return Stanza{Type: StanzaKeyFile, Body: sealed}, nil
+}
+
+// UnwrapKeyWithKey recovers the file key from a key file stanza.
+func UnwrapKeyWithKey(st Stanza, key []byte) ([]byte, error) {
+    if st.Type != StanzaKeyFile {
+        return nil, errors.New("invalid key file stanza")
+    }
+    return openFileKey(key, st.Body)
+}
+
+// UnwrapPassphrase tries every passphrase stanza and returns the file key.
+func UnwrapPassphrase(stanzas []Stanza, pass string) ([]byte, error) {
+    found := false
+    for _, st := range stanzas {
+        if st.Type != StanzaArgon2id {
+            continue
+        }
+        found = true
+        if key, err := UnwrapKeyArgon2id(st, pass); err == nil {
+            return key, nil
+        }
+    }
+    if !found {
+        return nil, ErrNoPassphraseStanza
+    }
+    return nil, ErrWrongPassphrase
+}
+
+// UnwrapKeyFile tries every key file stanza and returns the file key.
+func UnwrapKeyFile(stanzas []Stanza, key []byte) ([]byte, error) {
+    found := false
+    for _, st := range stanzas {
+        if st.Type != StanzaKeyFile {
+            continue
+        }
+        found = true
+        if fileKey, err := UnwrapKeyWithKey(st, key); err == nil {
+            return fileKey, nil
+        }
+    }
+    if !found {
+        return nil, ErrNoKeyFileStanza
+    }
+    return nil, ErrWrongKeyFile
+}
+
+// UnwrapTwoFactor tries every two-factor stanza and returns the file key.
+func UnwrapTwoFactor(stanzas []Stanza, pass string, key []byte) ([]byte, error) {
+    found := false
+    for _, st := range stanzas {
+        if st.Type != StanzaTwoFactor {
+            continue
+        }
+        found = true
+        if fileKey, err := UnwrapKeyTwoFactor(st, pass, key); err == nil {
+            return fileKey, nil
+        }
+    }
+    if !found {
+        return nil, ErrNoTwoFactorStanza
+    }
+    return nil, ErrWrongTwoFactor
+}
+
+// NewFileKey returns a random 32-byte file key.
+func NewFileKey() ([]byte, error) {
+    key := make([]byte, chacha20poly1305.KeySize)
+    if _, err := rand.Read(key); err != nil {
+        return nil, err
+    }
+    return key, nil
+}
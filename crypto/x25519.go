@@ -0,0 +1,224 @@
+// crypto/x25519.go
+package crypto
+
+import (
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/base64"
+    "errors"
+    "io"
+    "os"
+    "strings"
+
+    "golang.org/x/crypto/chacha20poly1305"
+    "golang.org/x/crypto/curve25519"
+    "golang.org/x/crypto/hkdf"
+)
+
+// Text prefixes for encoded X25519 keys.
+const (
+    X25519RecipientPrefix = "x25519:"
+    X25519IdentityPrefix  = "X25519-SECRET:"
+)
+
+const x25519WrapInfo = "ecrypto/x25519 file key"
+
+// ErrNoMatchingIdentity is returned when no stanza can be unwrapped.
+var ErrNoMatchingIdentity = errors.New("no identity matched any recipient stanza")
+
+// ErrNoRecoveryStanza is returned when a container has no recovery stanza.
+var ErrNoRecoveryStanza = errors.New("container has no recovery key stanza")
+
+// ErrWrongRecoveryKey is returned when no recovery stanza opens with the
+// identities given.
+var ErrWrongRecoveryKey = errors.New("no identity matched the recovery key stanza")
+
+// GenerateX25519 returns a new X25519 private key (identity) and its public
+// key (recipient).
+func GenerateX25519() (identity, recipient []byte, err error) {
+    identity = make([]byte, curve25519.ScalarSize)
+    if _, err := rand.Read(identity); err != nil {
+        return nil, nil, err
+    }
+    recipient, err = curve25519.X25519(identity, curve25519.Basepoint)
+    if err != nil {
+        return nil, nil, err
+    }
+    return identity, recipient, nil
+}
+
+// X25519PublicKey returns the recipient public key for an identity.
+func X25519PublicKey(identity []byte) ([]byte, error) {
+    return curve25519.X25519(identity, curve25519.Basepoint)
+}
+
+// EncodeX25519Recipient returns the text form of a recipient public key.
+func EncodeX25519Recipient(recipient []byte) string {
+    return X25519RecipientPrefix + base64.RawURLEncoding.EncodeToString(recipient)
+}
+
+// EncodeX25519Identity returns the text form of an identity (private key).
+func EncodeX25519Identity(identity []byte) string {
+    return X25519IdentityPrefix + base64.RawURLEncoding.EncodeToString(identity)
+}
+
+// ParseX25519Recipient parses a recipient public key in text form.
+func ParseX25519Recipient(s string) ([]byte, error) {
+    s = strings.TrimSpace(s)
+    if !strings.HasPrefix(s, X25519RecipientPrefix) {
+        return nil, errors.New("invalid recipient: expected " + X25519RecipientPrefix + " prefix")
+    }
+    return decodeX25519Key(strings.TrimPrefix(s, X25519RecipientPrefix))
+}
+
+// ParseX25519Identity parses an identity (private key) in text form.
+func ParseX25519Identity(s string) ([]byte, error) {
+    s = strings.TrimSpace(s)
+    if !strings.HasPrefix(s, X25519IdentityPrefix) {
+        return nil, errors.New("invalid identity: expected " + X25519IdentityPrefix + " prefix")
+    }
+    return decodeX25519Key(strings.TrimPrefix(s, X25519IdentityPrefix))
+}
+
+func decodeX25519Key(s string) ([]byte, error) {
+    key, err := base64.RawURLEncoding.DecodeString(s)
+    if err != nil {
+        return nil, err
+    }
+    if len(key) != curve25519.PointSize {
+        return nil, errors.New("X25519 key must be exactly 32 bytes")
+    }
+    return key, nil
+}
+
+// ReadX25519Identities reads every identity from an identity file.
+// Blank lines and lines starting with '#' are ignored.
+func ReadX25519Identities(path string) ([][]byte, error) {
+    raw, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    var ids [][]byte
+    for _, line := range strings.Split(string(raw), "\n") {
+        line = strings.TrimSpace(line)
+        if line == "" || strings.HasPrefix(line, "#") {
+            continue
+        }
+        id, err := ParseX25519Identity(line)
+        if err != nil {
+            return nil, err
+        }
+        ids = append(ids, id)
+    }
+    if len(ids) == 0 {
+        return nil, errors.New("no identities found in " + path)
+    }
+    return ids, nil
+}
+
+// x25519WrapKey derives the key that wraps the file key for one stanza.
+func x25519WrapKey(shared, ephemeral, recipient []byte) ([]byte, error) {
+    salt := make([]byte, 0, len(ephemeral)+len(recipient))
+    salt = append(salt, ephemeral...)
+    salt = append(salt, recipient...)
+    key := make([]byte, chacha20poly1305.KeySize)
+    if _, err := io.ReadFull(hkdf.New(sha256.New, shared, salt, []byte(x25519WrapInfo)), key); err != nil {
+        return nil, err
+    }
+    return key, nil
+}
+
+// WrapKeyX25519 wraps fileKey for a recipient public key. The stanza body is
+// the ephemeral public key followed by the sealed file key. Each wrapping key
+// is used exactly once, so an all-zero nonce is safe.
+func WrapKeyX25519(fileKey, recipient []byte) (Stanza, error) {
+    ephemeral, ephemeralPub, err := GenerateX25519()
+    if err != nil {
+        return Stanza{}, err
+    }
+    shared, err := curve25519.X25519(ephemeral, recipient)
+    if err != nil {
+        return Stanza{}, err
+    }
+    wrapKey, err := x25519WrapKey(shared, ephemeralPub, recipient)
+    if err != nil {
+        return Stanza{}, err
+    }
+    nonce := make([]byte, chacha20poly1305.NonceSizeX)
+    sealed, err := EncryptAEAD(wrapKey, fileKey, nil, nonce)
+    if err != nil {
+        return Stanza{}, err
+    }
+    return Stanza{Type: StanzaX25519, Body: append(ephemeralPub, sealed...)}, nil
+}
+
+// WrapKeyRecovery wraps fileKey for an organization recovery public key.
+// The stanza is an X25519 stanza with its own type, so it is only used by
+// recovery and is kept when the container is rekeyed.
+func WrapKeyRecovery(fileKey, recipient []byte) (Stanza, error) {
+    st, err := WrapKeyX25519(fileKey, recipient)
+    if err != nil {
+        return Stanza{}, err
+    }
+    st.Type = StanzaRecovery
+    return st, nil
+}
+
+// UnwrapKeyX25519 recovers the file key from an X25519 or recovery stanza.
+func UnwrapKeyX25519(st Stanza, identity []byte) ([]byte, error) {
+    if (st.Type != StanzaX25519 && st.Type != StanzaRecovery) || len(st.Body) != curve25519.PointSize+chacha20poly1305.KeySize+chacha20poly1305.Overhead {
+        return nil, errors.New("invalid X25519 stanza")
+    }
+    ephemeralPub := st.Body[:curve25519.PointSize]
+    recipient, err := X25519PublicKey(identity)
+    if err != nil {
+        return nil, err
+    }
+    shared, err := curve25519.X25519(identity, ephemeralPub)
+    if err != nil {
+        return nil, err
+    }
+    wrapKey, err := x25519WrapKey(shared, ephemeralPub, recipient)
+    if err != nil {
+        return nil, err
+    }
+    nonce := make([]byte, chacha20poly1305.NonceSizeX)
+    return DecryptAEAD(wrapKey, st.Body[curve25519.PointSize:], nil, nonce)
+}
+
+// UnwrapStanzas tries every X25519 stanza with every identity and returns
+// the first file key that unwraps.
+func UnwrapStanzas(stanzas []Stanza, identities [][]byte) ([]byte, error) {
+    for _, st := range stanzas {
+        if st.Type != StanzaX25519 {
+            continue
+        }
+        for _, id := range identities {
+            if key, err := UnwrapKeyX25519(st, id); err == nil {
+                return key, nil
+            }
+        }
+    }
+    return nil, ErrNoMatchingIdentity
+}
+
+// UnwrapRecovery tries every recovery stanza with every identity and
+// returns the first file key that unwraps.
+func UnwrapRecovery(stanzas []Stanza, identities [][]byte) ([]byte, error) {
+    found := false
+    for _, st := range stanzas {
+        if st.Type != StanzaRecovery {
+            continue
+        }
+        found = true
+        for _, id := range identities {
+            if key, err := UnwrapKeyX25519(st, id); err == nil {
+                return key, nil
+            }
+        }
+    }
+    if !found {
+        return nil, ErrNoRecoveryStanza
+    }
+    return nil, ErrWrongRecoveryKey
+}
@@ -1,10 +1,13 @@
 const { app, BrowserWindow, ipcMain, dialog, Menu } = require("electron");
 const path = require("path");
+const fs = require("fs");
 const { spawn, spawnSync } = require("child_process");
 const axios = require("axios");
 
 let mainWindow;
 let goServer;
+let api = axios; // replaced by an authenticated client once the server starts
+let apiToken = "";
 const API_PORT = 8765;
 const API_URL = `http://127.0.0.1:${API_PORT}`; // Use IPv4 explicitly
 
@@ -28,13 +31,30 @@ function getGoBinaryPath() {
   return path.join(__dirname, "..", "bin", `ecrypto${ext}`);
 }
 
+// The Go server writes a fresh API token here (mode 0600) on every launch
+function getTokenFilePath() {
+  return path.join(app.getPath("userData"), "api-token");
+}
+
+// Read the token and send it with every API request
+function loadApiToken() {
+  apiToken = fs.readFileSync(getTokenFilePath(), "utf8").trim();
+  api = axios.create({
+    headers: { Authorization: `Bearer ${apiToken}` },
+  });
+}
+
 // Start Go API server
 function startGoServer() {
   return new Promise((resolve, reject) => {
     const binaryPath = getGoBinaryPath();
     console.log("Starting Go server:", binaryPath);
 
-    goServer = spawn(binaryPath, ["--serve", `--port=${API_PORT}`]);
+    goServer = spawn(binaryPath, [
+      "--serve",
+      `--port=${API_PORT}`,
+      `--token-file=${getTokenFilePath()}`,
+    ]);
 
     goServer.stdout.on("data", (data) => {
       console.log(`[Go Server]: ${data}`);
@@ -111,6 +131,7 @@ app.whenReady().then(async () => {
   Menu.setApplicationMenu(null);
   try {
     await startGoServer();
+    loadApiToken();
     createWindow();
   } catch (err) {
     console.error("Failed to start application:", err);
@@ -173,7 +194,7 @@ ipcMain.handle("dialog:saveFile", async (event, defaultName, filters) => {
 // API Proxy Handlers
 ipcMain.handle("api:encrypt", async (event, data) => {
   try {
-    const response = await axios.post(`${API_URL}/encrypt`, data);
+    const response = await api.post(`${API_URL}/encrypt`, data);
     return { success: true, data: response.data };
   } catch (error) {
     return {
@@ -185,7 +206,7 @@ ipcMain.handle("api:encrypt", async (event, data) => {
 
 ipcMain.handle("api:decrypt", async (event, data) => {
   try {
-    const response = await axios.post(`${API_URL}/decrypt`, data);
+    const response = await api.post(`${API_URL}/decrypt`, data);
     return { success: true, data: response.data };
   } catch (error) {
     return {
@@ -197,7 +218,7 @@ ipcMain.handle("api:decrypt", async (event, data) => {
 
 ipcMain.handle("api:keygen", async (event, data) => {
   try {
-    const response = await axios.post(`${API_URL}/keygen`, data);
+    const response = await api.post(`${API_URL}/keygen`, data);
     return { success: true, data: response.data };
   } catch (error) {
     return {
@@ -209,7 +230,7 @@ ipcMain.handle("api:keygen", async (event, data) => {
 
 ipcMain.handle("api:info", async (event, data) => {
   try {
-    const response = await axios.post(`${API_URL}/info`, data);
+    const response = await api.post(`${API_URL}/info`, data);
     return { success: true, data: response.data };
   } catch (error) {
     return {
@@ -221,7 +242,7 @@ ipcMain.handle("api:info", async (event, data) => {
 
 ipcMain.handle("api:history", async () => {
   try {
-    const response = await axios.get(`${API_URL}/history`);
+    const response = await api.get(`${API_URL}/history`);
     return { success: true, data: response.data };
   } catch (error) {
     return {
@@ -233,7 +254,7 @@ ipcMain.handle("api:history", async () => {
 
 ipcMain.handle("api:undo", async (event, operationId) => {
   try {
-    const response = await axios.post(`${API_URL}/undo`, { operationId });
+    const response = await api.post(`${API_URL}/undo`, { operationId });
     return { success: true, data: response.data };
   } catch (error) {
     return {
@@ -245,7 +266,7 @@ ipcMain.handle("api:undo", async (event, operationId) => {
 
 ipcMain.handle("api:suggest-path", async (event, inputPath) => {
   try {
-    const response = await axios.post(`${API_URL}/suggest-path`, {
+    const response = await api.post(`${API_URL}/suggest-path`, {
       path: inputPath,
     });
     return { success: true, data: response.data };
@@ -259,7 +280,7 @@ ipcMain.handle("api:suggest-path", async (event, inputPath) => {
 
 ipcMain.handle("api:check-password", async (event, password) => {
   try {
-    const response = await axios.post(`${API_URL}/check-password`, {
+    const response = await api.post(`${API_URL}/check-password`, {
       password,
     });
     return { success: true, data: response.data };
@@ -273,7 +294,10 @@ ipcMain.handle("api:check-password", async (event, password) => {
 
 // Progress updates via SSE
 ipcMain.handle("api:subscribe-progress", (event) => {
-  const eventSource = new EventSource(`${API_URL}/progress`);
+  // EventSource cannot set headers, so the token goes in the query string
+  const eventSource = new EventSource(
+    `${API_URL}/progress?token=${encodeURIComponent(apiToken)}`
+  );
 
   eventSource.onmessage = (e) => {
     const data = JSON.parse(e.data);
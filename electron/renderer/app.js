@@ -876,15 +876,19 @@ function clearDecryptForm() {
 // Progress updates from backend
 if (window.electronAPI && window.electronAPI.onProgress) {
   window.electronAPI.onProgress((data) => {
-    if (data.percentage !== undefined) {
+    if (data.event === "progress") {
       document.getElementById("progress-fill").style.width =
         data.percentage + "%";
-      document.getElementById("progress-text").textContent =
-        `${data.current} / ${data.total} files processed`;
+      document.getElementById("progress-text").textContent = data.filesTotal
+        ? `${data.filesDone} / ${data.filesTotal} files processed`
+        : `${data.filesDone} files processed`;
       document.getElementById("progress-file").textContent =
-        data.filename || "";
+        data.currentFile || "";
     }
   });
+  window.electronAPI.subscribeProgress().catch((err) => {
+    console.error("Progress updates unavailable:", err);
+  });
 }
 
 // Initial load
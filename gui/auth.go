@@ -0,0 +1,102 @@
+package gui
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// tokenSize is the number of random bytes in an API token.
+const tokenSize = 32
+
+// newToken returns a random Base64URL token for one server launch.
+func newToken() (string, error) {
+	b := make([]byte, tokenSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Token returns the bearer token clients must send in the Authorization
+// header.
+func (s *Server) Token() string {
+	return s.token
+}
+
+// AllowOrigin adds browser origins (e.g. "http://localhost:3000") that may
+// call the API. Requests without an Origin header, such as those from the
+// Electron main process, are not affected; any other origin is rejected.
+func (s *Server) AllowOrigin(origins ...string) {
+	for _, o := range origins {
+		o = strings.TrimRight(strings.TrimSpace(o), "/")
+		if o != "" {
+			s.origins[o] = true
+		}
+	}
+}
+
+// WriteTokenFile writes the token to path, readable only by the owner, so
+// the Electron app can pick it up without it appearing in process lists.
+func (s *Server) WriteTokenFile(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	// O_CREATE does not change the mode of an existing file.
+	if err := f.Chmod(0o600); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.WriteString(s.token + "\n"); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// authMiddleware rejects requests from origins that are not allow-listed
+// and requests without the server's bearer token. CORS headers are only
+// sent to allowed origins, so other web pages cannot read responses either.
+func (s *Server) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if origin := r.Header.Get("Origin"); origin != "" {
+			if !s.origins[origin] {
+				sendError(w, "Origin not allowed", http.StatusForbidden)
+				return
+			}
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, "+
+				headerPassword+", "+headerKey+", "+headerKeyFile+", "+headerFilename)
+			w.Header().Set("Access-Control-Expose-Headers", "Content-Disposition, "+headerOperationID)
+			w.Header().Add("Vary", "Origin")
+
+			// Preflight requests carry no credentials.
+			if r.Method == http.MethodOptions {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+
+		if !s.authorized(r) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="ecrypto"`)
+			sendError(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authorized reports whether r carries the server token. EventSource cannot
+// set headers, so the progress stream also accepts it as ?token=.
+func (s *Server) authorized(r *http.Request) bool {
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok && r.Method == http.MethodGet && r.URL.Path == "/progress" {
+		got, ok = r.URL.Query().Get("token"), true
+	}
+	return ok && subtle.ConstantTimeCompare([]byte(got), []byte(s.token)) == 1
+}
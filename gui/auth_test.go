@@ -0,0 +1,153 @@
+package gui
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestServer(t *testing.T) (*Server, *httptest.Server) {
+	t.Helper()
+	s, err := NewServer(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.AllowOrigin("http://localhost:3000")
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+	return s, ts
+}
+
+func doRequest(t *testing.T, method, url string, header map[string]string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func TestAuthRequiresToken(t *testing.T) {
+	s, ts := newTestServer(t)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		header map[string]string
+		want   int
+	}{
+		{"no token", "GET", "/health", nil, http.StatusUnauthorized},
+		{"wrong token", "GET", "/health", map[string]string{"Authorization": "Bearer nope"}, http.StatusUnauthorized},
+		{"not bearer", "GET", "/health", map[string]string{"Authorization": s.Token()}, http.StatusUnauthorized},
+		{"no token on undo", "POST", "/undo", nil, http.StatusUnauthorized},
+		{"no token on keygen", "POST", "/keygen", nil, http.StatusUnauthorized},
+		{"valid token", "GET", "/health", map[string]string{"Authorization": "Bearer " + s.Token()}, http.StatusOK},
+		{"wrong query token on progress", "GET", "/progress?token=nope", nil, http.StatusUnauthorized},
+		{"query token outside progress", "GET", "/health?token=" + s.Token(), nil, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := doRequest(t, tt.method, ts.URL+tt.path, tt.header)
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthOrigins(t *testing.T) {
+	s, ts := newTestServer(t)
+	auth := "Bearer " + s.Token()
+
+	resp := doRequest(t, "GET", ts.URL+"/health", map[string]string{"Authorization": auth, "Origin": "https://evil.example"})
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("disallowed origin: status = %d, want %d", resp.StatusCode, http.StatusForbidden)
+	}
+	if got := resp.Header.Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("disallowed origin got Access-Control-Allow-Origin %q", got)
+	}
+
+	resp = doRequest(t, "GET", ts.URL+"/health", map[string]string{"Authorization": auth, "Origin": "http://localhost:3000"})
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("allowed origin: status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if got := resp.Header.Get("Access-Control-Allow-Origin"); got != "http://localhost:3000" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want the request origin", got)
+	}
+
+	resp = doRequest(t, "GET", ts.URL+"/health", map[string]string{"Origin": "http://localhost:3000"})
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("allowed origin without token: status = %d, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+}
+
+func TestAuthPreflight(t *testing.T) {
+	_, ts := newTestServer(t)
+
+	resp := doRequest(t, "OPTIONS", ts.URL+"/encrypt", map[string]string{"Origin": "http://localhost:3000"})
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("allowed preflight: status = %d, want %d", resp.StatusCode, http.StatusNoContent)
+	}
+	if got := resp.Header.Get("Access-Control-Allow-Headers"); !strings.Contains(got, "Authorization") {
+		t.Errorf("Access-Control-Allow-Headers = %q, want Authorization", got)
+	}
+
+	resp = doRequest(t, "OPTIONS", ts.URL+"/encrypt", map[string]string{"Origin": "null"})
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("disallowed preflight: status = %d, want %d", resp.StatusCode, http.StatusForbidden)
+	}
+
+	resp = doRequest(t, "OPTIONS", ts.URL+"/encrypt", nil)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("OPTIONS without origin or token: status = %d, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+}
+
+func TestTokensDifferPerServer(t *testing.T) {
+	a, _ := newTestServer(t)
+	b, _ := newTestServer(t)
+	if a.Token() == b.Token() {
+		t.Error("two servers share a token")
+	}
+	if len(a.Token()) < 40 {
+		t.Errorf("token %q is too short", a.Token())
+	}
+}
+
+func TestWriteTokenFile(t *testing.T) {
+	s, _ := newTestServer(t)
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte("stale"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.WriteTokenFile(path); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("token file mode = %o, want 600", perm)
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(string(raw)) != s.Token() {
+		t.Errorf("token file holds %q, want the server token", raw)
+	}
+}
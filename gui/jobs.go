@@ -0,0 +1,389 @@
+package gui
+
+import (
+	"context"
+	"crypto/rand"
+	"ecrypto/archive"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// jobWorkers bounds how many encryptions and decryptions run at once.
+	// Each may hold an Argon2id buffer of hundreds of MiB.
+	jobWorkers = 2
+	// jobQueueSize bounds how many jobs may wait for a worker.
+	jobQueueSize = 32
+	// jobRetention is how long finished jobs stay queryable.
+	jobRetention = time.Hour
+)
+
+// errQueueFull is returned when no more jobs can be queued.
+var errQueueFull = errors.New("too many queued jobs, try again later")
+
+// JobState is the lifecycle state of a job.
+type JobState string
+
+const (
+	JobQueued    JobState = "queued"
+	JobRunning   JobState = "running"
+	JobDone      JobState = "done"
+	JobFailed    JobState = "failed"
+	JobCancelled JobState = "cancelled"
+)
+
+// Job is the status of an encryption or decryption reported by /jobs.
+type Job struct {
+	ID         string   `json:"id"`
+	Type       string   `json:"type"`
+	State      JobState `json:"state"`
+	OutputPath string   `json:"outputPath"`
+	Progress
+	Error    string     `json:"error,omitempty"`
+	Created  time.Time  `json:"created"`
+	Started  *time.Time `json:"started,omitempty"`
+	Finished *time.Time `json:"finished,omitempty"`
+}
+
+// finished reports whether the job has reached a final state.
+func (j Job) finished() bool {
+	return j.State == JobDone || j.State == JobFailed || j.State == JobCancelled
+}
+
+// jobFunc performs a job, reporting its progress to p.
+type jobFunc func(ctx context.Context, p *jobProgress) error
+
+type job struct {
+	info   Job
+	run    jobFunc
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{} // closed when the job is finished
+}
+
+// jobManager runs jobs on a fixed pool of workers.
+type jobManager struct {
+	mu     sync.Mutex
+	jobs   map[string]*job
+	queue  chan *job
+	notify func(ProgressUpdate) // called with m.mu held
+}
+
+func newJobManager(workers, queueSize int, notify func(ProgressUpdate)) *jobManager {
+	m := &jobManager{
+		jobs:   make(map[string]*job),
+		queue:  make(chan *job, queueSize),
+		notify: notify,
+	}
+	for i := 0; i < workers; i++ {
+		go m.worker()
+	}
+	return m
+}
+
+// submit queues run as a new job of the given type.
+func (m *jobManager) submit(typ, outputPath string, run jobFunc) (*job, error) {
+	id, err := newJobID()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &job{
+		info:   Job{ID: id, Type: typ, State: JobQueued, OutputPath: outputPath, Created: time.Now()},
+		run:    run,
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.prune()
+	select {
+	case m.queue <- j:
+	default:
+		cancel()
+		return nil, errQueueFull
+	}
+	m.jobs[id] = j
+	return j, nil
+}
+
+func (m *jobManager) worker() {
+	for j := range m.queue {
+		m.mu.Lock()
+		if j.info.State != JobQueued { // cancelled while waiting
+			m.mu.Unlock()
+			continue
+		}
+		now := time.Now()
+		j.info.State = JobRunning
+		j.info.Started = &now
+		m.mu.Unlock()
+
+		err := runRecovered(j, &jobProgress{m: m, j: j})
+
+		m.mu.Lock()
+		switch {
+		case err != nil && j.ctx.Err() != nil:
+			m.finish(j, JobCancelled, "")
+		case err != nil:
+			m.finish(j, JobFailed, err.Error())
+		default:
+			m.finish(j, JobDone, "")
+		}
+		m.mu.Unlock()
+	}
+}
+
+// runRecovered runs j, turning a panic into an error so that one bad
+// input fails its job instead of taking the server down.
+func runRecovered(j *job, p *jobProgress) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("job %s panicked: %v\n%s", j.info.ID, r, debug.Stack())
+			err = fmt.Errorf("internal error: %v", r)
+		}
+	}()
+	return j.run(j.ctx, p)
+}
+
+// finish moves j to a final state. m.mu must be held.
+func (m *jobManager) finish(j *job, state JobState, errMsg string) {
+	now := time.Now()
+	j.info.State = state
+	j.info.Error = errMsg
+	j.info.CurrentFile = ""
+	j.info.Finished = &now
+	if j.info.Started != nil {
+		j.info.computeRates(now.Sub(*j.info.Started))
+	}
+	j.cancel()
+	close(j.done)
+	m.notify(progressUpdate(j.info))
+}
+
+// jobProgress lets a running job report its progress.
+type jobProgress struct {
+	m    *jobManager
+	j    *job
+	sent time.Time
+}
+
+// report records the progress of the job. It is an archive.ProgressFunc.
+// Phase changes are published at once, anything else at most once per
+// progressInterval.
+func (p *jobProgress) report(ap archive.Progress) {
+	p.m.mu.Lock()
+	defer p.m.mu.Unlock()
+	info := &p.j.info
+	phaseChanged := info.Phase != string(ap.Phase)
+	info.Phase = string(ap.Phase)
+	info.FilesDone = ap.FilesDone
+	info.FilesTotal = ap.FilesTotal
+	info.BytesDone = ap.BytesDone
+	info.BytesTotal = ap.BytesTotal
+	info.CurrentFile = ap.File
+	p.publish(phaseChanged)
+}
+
+// publish updates the rates and notifies subscribers, at most once per
+// progressInterval unless force is set. p.m.mu must be held.
+func (p *jobProgress) publish(force bool) {
+	now := time.Now()
+	if !force && now.Sub(p.sent) < progressInterval {
+		return
+	}
+	p.sent = now
+	p.j.info.computeRates(now.Sub(*p.j.info.Started))
+	p.m.notify(progressUpdate(p.j.info))
+}
+
+// get returns the status of a job.
+func (m *jobManager) get(id string) (Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return j.info, true
+}
+
+// list returns the status of all known jobs, oldest first.
+func (m *jobManager) list() []Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.prune()
+	jobs := make([]Job, 0, len(m.jobs))
+	for _, j := range m.jobs {
+		jobs = append(jobs, j.info)
+	}
+	sort.Slice(jobs, func(a, b int) bool { return jobs[a].Created.Before(jobs[b].Created) })
+	return jobs
+}
+
+// cancel cancels a queued or running job and waits until it has stopped,
+// or until ctx is done. A finished job is forgotten instead.
+func (m *jobManager) cancel(ctx context.Context, id string) (Job, bool) {
+	m.mu.Lock()
+	j, ok := m.jobs[id]
+	if !ok {
+		m.mu.Unlock()
+		return Job{}, false
+	}
+	if j.info.finished() {
+		delete(m.jobs, id)
+		m.mu.Unlock()
+		return j.info, true
+	}
+	m.mu.Unlock()
+	return m.stop(ctx, j), true
+}
+
+// stop cancels j unless it has finished and waits until it has stopped, or
+// until ctx is done.
+func (m *jobManager) stop(ctx context.Context, j *job) Job {
+	m.mu.Lock()
+	switch j.info.State {
+	case JobQueued:
+		m.finish(j, JobCancelled, "")
+	case JobRunning:
+		j.cancel()
+	}
+	m.mu.Unlock()
+
+	select {
+	case <-j.done:
+	case <-ctx.Done():
+	}
+	return m.snapshot(j)
+}
+
+// wait blocks until j is finished and returns its final status. If ctx is
+// done first, for example because the client went away, j is cancelled.
+func (m *jobManager) wait(ctx context.Context, j *job) Job {
+	select {
+	case <-j.done:
+		return m.snapshot(j)
+	case <-ctx.Done():
+		return m.stop(context.Background(), j)
+	}
+}
+
+func (m *jobManager) snapshot(j *job) Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return j.info
+}
+
+// prune forgets jobs that finished more than jobRetention ago. m.mu must
+// be held.
+func (m *jobManager) prune() {
+	cutoff := time.Now().Add(-jobRetention)
+	for id, j := range m.jobs {
+		if j.info.finished() && j.info.Finished.Before(cutoff) {
+			delete(m.jobs, id)
+		}
+	}
+}
+
+func newJobID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// JobRequest starts a job. Type is "encrypt" or "decrypt"; the remaining
+// fields are those of EncryptRequest or DecryptRequest.
+type JobRequest struct {
+	Type string `json:"type"`
+}
+
+// handleJobCreate queues an encryption or decryption and returns its job
+// without waiting for it.
+func (s *Server) handleJobCreate(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	var req JobRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var run jobFunc
+	var outputPath string
+	switch req.Type {
+	case "encrypt":
+		var enc EncryptRequest
+		if err := json.Unmarshal(body, &enc); err != nil {
+			sendError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		run, err = encryptTask(&enc)
+		outputPath = enc.OutputPath
+	case "decrypt":
+		var dec DecryptRequest
+		if err := json.Unmarshal(body, &dec); err != nil {
+			sendError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		run, err = decryptTask(&dec)
+		outputPath = dec.OutputPath
+	default:
+		sendError(w, `type must be "encrypt" or "decrypt"`, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	j, err := s.jobs.submit(req.Type, outputPath, run)
+	if err != nil {
+		sendError(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Location", "/jobs/"+j.info.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	sendSuccess(w, "Job queued", s.jobs.snapshot(j))
+}
+
+func (s *Server) handleJobList(w http.ResponseWriter, r *http.Request) {
+	sendSuccess(w, "", s.jobs.list())
+}
+
+func (s *Server) handleJobGet(w http.ResponseWriter, r *http.Request) {
+	info, ok := s.jobs.get(r.PathValue("id"))
+	if !ok {
+		sendError(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	sendSuccess(w, "", info)
+}
+
+// handleJobCancel cancels a queued or running job, removing its partial
+// output, or forgets a finished one.
+func (s *Server) handleJobCancel(w http.ResponseWriter, r *http.Request) {
+	info, ok := s.jobs.cancel(r.Context(), r.PathValue("id"))
+	if !ok {
+		sendError(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	sendSuccess(w, "Job "+string(info.State), info)
+}
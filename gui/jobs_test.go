@@ -0,0 +1,288 @@
+package gui
+
+import (
+	"context"
+	"crypto/rand"
+	"ecrypto/archive"
+	"ecrypto/cmd"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestJobPanicFailsJob(t *testing.T) {
+	m := newJobManager(1, 4, func(ProgressUpdate) {})
+	j, err := m.submit("decrypt", "", func(ctx context.Context, p *jobProgress) error {
+		panic("boom")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info := m.wait(context.Background(), j); info.State != JobFailed {
+		t.Fatalf("state = %s, want %s", info.State, JobFailed)
+	}
+
+	// The worker survives the panic and runs the next job.
+	j, err = m.submit("decrypt", "", func(ctx context.Context, p *jobProgress) error {
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info := m.wait(context.Background(), j); info.State != JobDone {
+		t.Fatalf("state = %s, want %s", info.State, JobDone)
+	}
+}
+
+// isolateHome points the history and config files at a temporary
+// directory, as encryption and decryption jobs record themselves there.
+func isolateHome(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("ECRYPTO_CONFIG", filepath.Join(home, "config.toml"))
+	return home
+}
+
+// writeKey writes a fresh key file into dir.
+func writeKey(t *testing.T, dir string) string {
+	t.Helper()
+	key, err := cmd.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "test.key")
+	if err := os.WriteFile(path, []byte(key), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// writeRandom writes n random bytes to a new file in dir.
+func writeRandom(t *testing.T, dir, name string, n int) string {
+	t.Helper()
+	data := make([]byte, n)
+	rand.Read(data)
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// doJobRequest sends body to the job API and returns the status code and
+// the job in the response, if any.
+func doJobRequest(t *testing.T, s *Server, method, url, body string) (int, Job) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+s.Token())
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var r struct {
+		Data json.RawMessage `json:"data"`
+	}
+	var info Job
+	if json.NewDecoder(resp.Body).Decode(&r) == nil && len(r.Data) > 0 && r.Data[0] == '{' {
+		json.Unmarshal(r.Data, &info)
+	}
+	return resp.StatusCode, info
+}
+
+// waitJob waits until the job id has finished.
+func waitJob(t *testing.T, m *jobManager, id string) Job {
+	t.Helper()
+	m.mu.Lock()
+	j, ok := m.jobs[id]
+	m.mu.Unlock()
+	if !ok {
+		t.Fatalf("job %s not found", id)
+	}
+	return m.wait(context.Background(), j)
+}
+
+func TestJobEndpoints(t *testing.T) {
+	dir := isolateHome(t)
+	s, ts := newTestServer(t)
+	keyFile := writeKey(t, dir)
+	in := writeRandom(t, dir, "plain.bin", 1000)
+	encrypt := `{"type":"encrypt","inputPath":"` + in + `","outputPath":"` + filepath.Join(dir, "plain.ecrypt") + `","useKey":true,"keyFile":"` + keyFile + `"}`
+
+	code, queued := doJobRequest(t, s, "POST", ts.URL+"/jobs", encrypt)
+	if code != http.StatusAccepted || queued.ID == "" {
+		t.Fatalf("POST /jobs: status = %d, job %q, want %d and a job", code, queued.ID, http.StatusAccepted)
+	}
+	if info := waitJob(t, s.jobs, queued.ID); info.State != JobDone {
+		t.Fatalf("state = %s (%s), want %s", info.State, info.Error, JobDone)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"invalid body", "POST", "/jobs", "{", http.StatusBadRequest},
+		{"unknown type", "POST", "/jobs", `{"type":"shred"}`, http.StatusBadRequest},
+		{"missing input", "POST", "/jobs", `{"type":"encrypt","password":"secret"}`, http.StatusBadRequest},
+		{"missing credentials", "POST", "/jobs", `{"type":"decrypt","inputPath":"x.ecrypt"}`, http.StatusBadRequest},
+		{"list", "GET", "/jobs", "", http.StatusOK},
+		{"get", "GET", "/jobs/" + queued.ID, "", http.StatusOK},
+		{"get unknown", "GET", "/jobs/0123456789abcdef", "", http.StatusNotFound},
+		{"cancel unknown", "DELETE", "/jobs/0123456789abcdef", "", http.StatusNotFound},
+		{"forget finished", "DELETE", "/jobs/" + queued.ID, "", http.StatusOK},
+		{"get forgotten", "GET", "/jobs/" + queued.ID, "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, _ := doJobRequest(t, s, tt.method, ts.URL+tt.path, tt.body); code != tt.want {
+				t.Errorf("status = %d, want %d", code, tt.want)
+			}
+		})
+	}
+}
+
+func TestJobQueueFull(t *testing.T) {
+	dir := isolateHome(t)
+	s, ts := newTestServer(t)
+	s.jobs = newJobManager(1, 1, s.publishProgress)
+
+	// Occupy the worker, then the single queue slot.
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{})
+	block := func(ctx context.Context, p *jobProgress) error {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-release
+		return nil
+	}
+	if _, err := s.jobs.submit("encrypt", "", block); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	if _, err := s.jobs.submit("encrypt", "", block); err != nil {
+		t.Fatal(err)
+	}
+
+	in := writeRandom(t, dir, "plain.bin", 10)
+	body := `{"type":"encrypt","inputPath":"` + in + `","outputPath":"` + in + `.ecrypt","password":"secret"}`
+	if code, _ := doJobRequest(t, s, "POST", ts.URL+"/jobs", body); code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestJobCancelStopsContext(t *testing.T) {
+	s, ts := newTestServer(t)
+
+	running := make(chan struct{})
+	stopped := make(chan error, 1)
+	j, err := s.jobs.submit("encrypt", "", func(ctx context.Context, p *jobProgress) error {
+		close(running)
+		<-ctx.Done()
+		stopped <- ctx.Err()
+		return ctx.Err()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-running
+
+	code, info := doJobRequest(t, s, "DELETE", ts.URL+"/jobs/"+j.info.ID, "")
+	if code != http.StatusOK || info.State != JobCancelled {
+		t.Fatalf("DELETE: status = %d, state %s, want %d and %s", code, info.State, http.StatusOK, JobCancelled)
+	}
+	select {
+	case err := <-stopped:
+		if err != context.Canceled {
+			t.Errorf("job context error = %v, want %v", err, context.Canceled)
+		}
+	default:
+		t.Error("DELETE returned before the job stopped")
+	}
+}
+
+func TestJobRemovesPartialOutput(t *testing.T) {
+	dir := isolateHome(t)
+	s, ts := newTestServer(t)
+	keyFile := writeKey(t, dir)
+	in := writeRandom(t, dir, "plain.bin", 4*64*1024+1)
+
+	t.Run("cancelled encryption", func(t *testing.T) {
+		out := filepath.Join(t.TempDir(), "plain.ecrypt")
+		// Cancel the job as soon as it starts writing, as DELETE would.
+		var m *jobManager
+		var sawTmp bool
+		m = newJobManager(1, 1, func(u ProgressUpdate) {
+			if u.Event == EventProgress && u.Phase == string(archive.PhaseEncrypting) {
+				_, err := os.Stat(out + ".tmp")
+				sawTmp = err == nil
+				m.jobs[u.OperationID].cancel()
+			}
+		})
+		s.jobs = m
+
+		body := `{"type":"encrypt","inputPath":"` + in + `","outputPath":"` + out + `","useKey":true,"keyFile":"` + keyFile + `"}`
+		code, queued := doJobRequest(t, s, "POST", ts.URL+"/jobs", body)
+		if code != http.StatusAccepted {
+			t.Fatalf("status = %d, want %d", code, http.StatusAccepted)
+		}
+		if info := waitJob(t, m, queued.ID); info.State != JobCancelled {
+			t.Fatalf("state = %s (%s), want %s", info.State, info.Error, JobCancelled)
+		}
+		if !sawTmp {
+			t.Fatal("job was not cancelled while writing its .tmp file")
+		}
+		for _, name := range []string{out, out + ".tmp"} {
+			if _, err := os.Stat(name); !os.IsNotExist(err) {
+				t.Errorf("%s left behind (%v)", filepath.Base(name), err)
+			}
+		}
+	})
+
+	t.Run("failed decryption", func(t *testing.T) {
+		s.jobs = newJobManager(1, 1, s.publishProgress)
+		container := filepath.Join(t.TempDir(), "plain.bin.ecrypt")
+		if err := cmd.EncryptFileWithKeyFile(context.Background(), in, container, keyFile, nil); err != nil {
+			t.Fatal(err)
+		}
+		// Damage a chunk in the middle, so decryption fails part way
+		// through writing the file.
+		raw, err := os.ReadFile(container)
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw[len(raw)/2] ^= 1
+		if err := os.WriteFile(container, raw, 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		outDir := t.TempDir()
+		body := `{"type":"decrypt","inputPath":"` + container + `","outputPath":"` + outDir + `","useKey":true,"keyFile":"` + keyFile + `"}`
+		code, queued := doJobRequest(t, s, "POST", ts.URL+"/jobs", body)
+		if code != http.StatusAccepted {
+			t.Fatalf("status = %d, want %d", code, http.StatusAccepted)
+		}
+		if info := waitJob(t, s.jobs, queued.ID); info.State != JobFailed {
+			t.Fatalf("state = %s, want %s", info.State, JobFailed)
+		}
+		entries, err := os.ReadDir(outDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 0 {
+			t.Errorf("output folder holds %v, want nothing", entries)
+		}
+	})
+}
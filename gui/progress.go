@@ -0,0 +1,168 @@
+package gui
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	// progressInterval is the minimum time between progress events of one
+	// operation.
+	progressInterval = 200 * time.Millisecond
+	// progressKeepAlive is how often an idle /progress stream gets a
+	// comment line so that proxies and clients keep it open.
+	progressKeepAlive = 15 * time.Second
+	// progressBuffer is how many events a slow subscriber may fall behind
+	// before further events are dropped for it.
+	progressBuffer = 64
+)
+
+// Progress events.
+const (
+	EventProgress  = "progress"
+	EventComplete  = "complete"
+	EventError     = "error"
+	EventCancelled = "cancelled"
+)
+
+// Progress is how far an operation has got. Phase is one of the
+// archive.Phase values; totals are zero while they are not known.
+type Progress struct {
+	Phase          string  `json:"phase,omitempty"`
+	FilesDone      int     `json:"filesDone"`
+	FilesTotal     int     `json:"filesTotal"`
+	BytesDone      int64   `json:"bytesDone"`
+	BytesTotal     int64   `json:"bytesTotal"`
+	CurrentFile    string  `json:"currentFile,omitempty"`
+	BytesPerSecond float64 `json:"bytesPerSecond"`
+	ETASeconds     float64 `json:"etaSeconds,omitempty"`
+	Percentage     int     `json:"percentage"`
+}
+
+// ProgressUpdate is one event on the /progress stream. OperationID is the
+// job ID.
+type ProgressUpdate struct {
+	Event       string `json:"event"`
+	OperationID string `json:"operationId"`
+	Operation   string `json:"operation"`
+	Progress
+	Error string `json:"error,omitempty"`
+}
+
+// progressUpdate returns the event describing the current state of j.
+func progressUpdate(j Job) ProgressUpdate {
+	event := EventProgress
+	switch j.State {
+	case JobDone:
+		event = EventComplete
+	case JobFailed:
+		event = EventError
+	case JobCancelled:
+		event = EventCancelled
+	}
+	return ProgressUpdate{Event: event, OperationID: j.ID, Operation: j.Type, Progress: j.Progress, Error: j.Error}
+}
+
+// computeRates fills in throughput, ETA and percentage from the counters,
+// given how long the operation has been running.
+func (p *Progress) computeRates(elapsed time.Duration) {
+	p.BytesPerSecond = 0
+	p.ETASeconds = 0
+	if secs := elapsed.Seconds(); secs > 0 {
+		p.BytesPerSecond = float64(p.BytesDone) / secs
+	}
+	if p.BytesTotal > 0 && p.BytesPerSecond > 0 {
+		p.ETASeconds = float64(p.BytesTotal-p.BytesDone) / p.BytesPerSecond
+	}
+
+	switch {
+	case p.BytesTotal > 0:
+		p.Percentage = int(p.BytesDone * 100 / p.BytesTotal)
+	case p.FilesTotal > 0:
+		p.Percentage = p.FilesDone * 100 / p.FilesTotal
+	}
+	if p.Percentage > 100 {
+		p.Percentage = 100
+	}
+}
+
+// progressClient is one /progress subscriber. An empty operationID
+// subscribes to all operations.
+type progressClient struct {
+	operationID string
+	ch          chan ProgressUpdate
+}
+
+// publishProgress sends an event to every subscriber of its operation. A
+// subscriber that has fallen progressBuffer events behind misses it.
+func (s *Server) publishProgress(u ProgressUpdate) {
+	s.progressClients.Range(func(key, _ any) bool {
+		c := key.(*progressClient)
+		if c.operationID == "" || c.operationID == u.OperationID {
+			select {
+			case c.ch <- u:
+			default:
+			}
+		}
+		return true
+	})
+}
+
+// handleProgressSSE streams progress events. With ?operationId= only that
+// operation is reported, starting with its current state, and the stream
+// ends after its final event.
+func (s *Server) handleProgressSSE(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		sendError(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	opID := r.URL.Query().Get("operationId")
+	c := &progressClient{operationID: opID, ch: make(chan ProgressUpdate, progressBuffer)}
+	s.progressClients.Store(c, struct{}{})
+	defer s.progressClients.Delete(c)
+
+	var current Job
+	if opID != "" {
+		if current, ok = s.jobs.get(opID); !ok {
+			sendError(w, "Operation not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	fmt.Fprintf(w, "data: {\"status\": \"connected\"}\n\n")
+	flusher.Flush()
+
+	// send writes an event and reports whether the stream continues.
+	send := func(u ProgressUpdate) bool {
+		data, _ := json.Marshal(u)
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		flusher.Flush()
+		return opID == "" || u.Event == EventProgress
+	}
+	if opID != "" && !send(progressUpdate(current)) {
+		return
+	}
+
+	keepAlive := time.NewTicker(progressKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case u := <-c.ch:
+			if !send(u) {
+				return
+			}
+		case <-keepAlive.C:
+			fmt.Fprintf(w, ": keep-alive\n\n")
+			flusher.Flush()
+		}
+	}
+}
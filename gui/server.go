@@ -1,11 +1,13 @@
 package gui
 
 import (
-	"bytes"
+	"context"
 	"ecrypto/ai"
+	"ecrypto/archive"
 	"ecrypto/cmd"
 	"ecrypto/crypto"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -16,15 +18,11 @@ import (
 
 type Server struct {
 	port            int
-	progressClients sync.Map // map[string]chan ProgressUpdate
-}
-
-type ProgressUpdate struct {
-	OperationID string `json:"operationId"`
-	Current     int    `json:"current"`
-	Total       int    `json:"total"`
-	Filename    string `json:"filename"`
-	Percentage  int    `json:"percentage"`
+	token           string          // bearer token required on every request
+	origins         map[string]bool // browser origins allowed to call the API
+	jobs            *jobManager
+	progressClients sync.Map // map[*progressClient]struct{}
+	maxUpload       int64    // cap on a spooled /stream/decrypt body; 0 = none
 }
 
 type EncryptRequest struct {
@@ -51,6 +49,13 @@ type InfoRequest struct {
 	FilePath string `json:"filePath"`
 }
 
+type ListRequest struct {
+	InputPath string `json:"inputPath"`
+	Password  string `json:"password,omitempty"`
+	KeyFile   string `json:"keyFile,omitempty"`
+	UseKey    bool   `json:"useKey"`
+}
+
 type Response struct {
 	Success bool        `json:"success"`
 	Message string      `json:"message,omitempty"`
@@ -58,12 +63,20 @@ type Response struct {
 	Error   string      `json:"error,omitempty"`
 }
 
-func NewServer(port int) *Server {
-	return &Server{port: port}
+// NewServer returns a server for the given port with a fresh random API
+// token. No browser origins are allowed until AllowOrigin is called.
+func NewServer(port int) (*Server, error) {
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{port: port, token: token, origins: make(map[string]bool), maxUpload: DefaultMaxUpload}
+	s.jobs = newJobManager(jobWorkers, jobQueueSize, s.publishProgress)
+	return s, nil
 }
 
-func (s *Server) Start() error {
-	// Enable CORS for development
+// Handler returns the API routes wrapped in token and origin checks.
+func (s *Server) Handler() http.Handler {
 	mux := http.NewServeMux()
 	
 	mux.HandleFunc("/", s.handleRoot)
@@ -71,33 +84,29 @@ func (s *Server) Start() error {
 	mux.HandleFunc("/decrypt", s.handleDecrypt)
 	mux.HandleFunc("/keygen", s.handleKeygen)
 	mux.HandleFunc("/info", s.handleInfo)
+	mux.HandleFunc("/list", s.handleList)
+	mux.HandleFunc("/verify", s.handleVerify)
+	mux.HandleFunc("/profile", s.handleProfile)
 	mux.HandleFunc("/history", s.handleHistory)
 	mux.HandleFunc("/undo", s.handleUndo)
 	mux.HandleFunc("/suggest-path", s.handleSuggestPath)
 	mux.HandleFunc("/check-password", s.handleCheckPassword)
 	mux.HandleFunc("/progress", s.handleProgressSSE)
 	mux.HandleFunc("/health", s.handleHealth)
+	mux.HandleFunc("POST /jobs", s.handleJobCreate)
+	mux.HandleFunc("GET /jobs", s.handleJobList)
+	mux.HandleFunc("GET /jobs/{id}", s.handleJobGet)
+	mux.HandleFunc("DELETE /jobs/{id}", s.handleJobCancel)
+	mux.HandleFunc("POST /stream/encrypt", s.handleStreamEncrypt)
+	mux.HandleFunc("POST /stream/decrypt", s.handleStreamDecrypt)
+
+	return s.authMiddleware(mux)
+}
 
-	handler := corsMiddleware(mux)
-
+func (s *Server) Start() error {
 	addr := fmt.Sprintf("localhost:%d", s.port)
 	log.Printf("Server started on http://%s\n", addr)
-	return http.ListenAndServe(addr, handler)
-}
-
-func corsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-		
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-		
-		next.ServeHTTP(w, r)
-	})
+	return http.ListenAndServe(addr, s.Handler())
 }
 
 func (s *Server) handleRoot(w http.ResponseWriter, r *http.Request) {
@@ -116,12 +125,21 @@ func (s *Server) handleRoot(w http.ResponseWriter, r *http.Request) {
 			"POST /decrypt",
 			"POST /keygen",
 			"POST /info",
+			"POST /list",
+			"POST /verify",
+			"GET  /profile",
 			"GET  /history",
 			"POST /undo",
 			"POST /suggest-path",
 			"POST /check-password",
 			"GET  /progress",
 			"GET  /health",
+			"POST /jobs",
+			"GET  /jobs",
+			"GET  /jobs/{id}",
+			"DELETE /jobs/{id}",
+			"POST /stream/encrypt",
+			"POST /stream/decrypt",
 		},
 	})
 }
@@ -138,69 +156,53 @@ func (s *Server) handleEncrypt(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.InputPath == "" || req.OutputPath == "" {
-		sendError(w, "inputPath and outputPath are required", http.StatusBadRequest)
+	run, err := encryptTask(&req)
+	if err != nil {
+		sendError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	s.runJob(w, r, "encrypt", req.OutputPath, run)
+}
+
+// encryptTask validates req, filling in defaults, and returns the function
+// that performs the encryption and records it in the history.
+func encryptTask(req *EncryptRequest) (jobFunc, error) {
+	if req.OutputPath == "" && req.InputPath != "" {
+		req.OutputPath = cmd.DefaultEncryptOutput(req.InputPath)
+	}
+	profileKey(&req.UseKey, &req.KeyFile, req.Password)
+	if req.InputPath == "" || req.OutputPath == "" {
+		return nil, errors.New("inputPath and outputPath are required")
+	}
 
 	// Check if input is a file or folder
 	info, err := os.Stat(req.InputPath)
 	if err != nil {
-		sendError(w, fmt.Sprintf("Cannot access input path: %v", err), http.StatusBadRequest)
-		return
-	}
-
-	// Progress callback
-	progressCb := func(filename string) {
-		// Could broadcast to SSE clients here
-		log.Printf("Progress: %s\n", filename)
-	}
-
-	var encryptErr error
-	if info.IsDir() {
-		// Folder encryption
-		if req.UseKey {
-			if req.KeyFile == "" {
-				sendError(w, "keyFile is required when useKey is true", http.StatusBadRequest)
-				return
-			}
-			encryptErr = cmd.EncryptWithKeyFile(req.InputPath, req.OutputPath, req.KeyFile, progressCb)
-		} else {
-			if req.Password == "" {
-				sendError(w, "password is required when useKey is false", http.StatusBadRequest)
-				return
-			}
-			encryptErr = cmd.EncryptWithPassphrase(req.InputPath, req.OutputPath, req.Password, progressCb)
+		return nil, fmt.Errorf("Cannot access input path: %v", err)
+	}
+	if req.UseKey && req.KeyFile == "" {
+		return nil, errors.New("keyFile is required when useKey is true")
+	}
+	if !req.UseKey && req.Password == "" {
+		return nil, errors.New("password is required when useKey is false")
+	}
+
+	return func(ctx context.Context, p *jobProgress) error {
+		progressCb := p.report
+		var err error
+		switch {
+		case info.IsDir() && req.UseKey:
+			err = cmd.EncryptWithKeyFile(ctx, req.InputPath, req.OutputPath, req.KeyFile, progressCb)
+		case info.IsDir():
+			err = cmd.EncryptWithPassphrase(ctx, req.InputPath, req.OutputPath, req.Password, progressCb)
+		case req.UseKey:
+			err = cmd.EncryptFileWithKeyFile(ctx, req.InputPath, req.OutputPath, req.KeyFile, progressCb)
+		default:
+			err = cmd.EncryptFileWithPassphrase(ctx, req.InputPath, req.OutputPath, req.Password, progressCb)
 		}
-	} else {
-		// Single file encryption
-		if req.UseKey {
-			if req.KeyFile == "" {
-				sendError(w, "keyFile is required when useKey is true", http.StatusBadRequest)
-				return
-			}
-			encryptErr = cmd.EncryptFileWithKeyFile(req.InputPath, req.OutputPath, req.KeyFile, progressCb)
-		} else {
-			if req.Password == "" {
-				sendError(w, "password is required when useKey is false", http.StatusBadRequest)
-				return
-			}
-			encryptErr = cmd.EncryptFileWithPassphrase(req.InputPath, req.OutputPath, req.Password, progressCb)
-		}
-	}
-
-	if encryptErr != nil {
-		ai.AddOperation("encrypt", req.InputPath, req.OutputPath, getMethodName(req.UseKey), false)
-		sendError(w, fmt.Sprintf("Encryption failed: %v", encryptErr), http.StatusInternalServerError)
-		return
-	}
-
-	// Save to history
-	ai.AddOperation("encrypt", req.InputPath, req.OutputPath, getMethodName(req.UseKey), true)
-
-	sendSuccess(w, "Encryption completed successfully", map[string]interface{}{
-		"outputPath": req.OutputPath,
-	})
+		ai.AddOperation("encrypt", req.InputPath, req.OutputPath, getMethodName(req.UseKey), err == nil)
+		return err
+	}, nil
 }
 
 func (s *Server) handleDecrypt(w http.ResponseWriter, r *http.Request) {
@@ -215,42 +217,74 @@ func (s *Server) handleDecrypt(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.InputPath == "" || req.OutputPath == "" {
-		sendError(w, "inputPath and outputPath are required", http.StatusBadRequest)
+	run, err := decryptTask(&req)
+	if err != nil {
+		sendError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	s.runJob(w, r, "decrypt", req.OutputPath, run)
+}
 
-	progressCb := func(filename string) {
-		log.Printf("Progress: %s\n", filename)
+// decryptTask validates req, filling in defaults, and returns the function
+// that performs the decryption and records it in the history.
+func decryptTask(req *DecryptRequest) (jobFunc, error) {
+	if req.OutputPath == "" && req.InputPath != "" {
+		req.OutputPath = cmd.DefaultDecryptOutput(req.InputPath)
 	}
-
-	var decryptErr error
-	if req.UseKey {
-		if req.KeyFile == "" {
-			sendError(w, "keyFile is required when useKey is true", http.StatusBadRequest)
-			return
-		}
-		decryptErr = cmd.DecryptWithKeyFile(req.InputPath, req.OutputPath, req.KeyFile, progressCb)
-	} else {
-		if req.Password == "" {
-			sendError(w, "password is required when useKey is false", http.StatusBadRequest)
-			return
+	profileKey(&req.UseKey, &req.KeyFile, req.Password)
+	if req.InputPath == "" || req.OutputPath == "" {
+		return nil, errors.New("inputPath and outputPath are required")
+	}
+	if req.UseKey && req.KeyFile == "" {
+		return nil, errors.New("keyFile is required when useKey is true")
+	}
+	if !req.UseKey && req.Password == "" {
+		return nil, errors.New("password is required when useKey is false")
+	}
+
+	return func(ctx context.Context, p *jobProgress) error {
+		progressCb := p.report
+		var err error
+		switch {
+		case req.UseKey && req.Password != "":
+			// Both given: the container may need them together.
+			err = cmd.DecryptWithTwoFactor(ctx, req.InputPath, req.OutputPath, req.Password, req.KeyFile, progressCb)
+		case req.UseKey:
+			err = cmd.DecryptWithKeyFile(ctx, req.InputPath, req.OutputPath, req.KeyFile, progressCb)
+		default:
+			err = cmd.DecryptWithPassphrase(ctx, req.InputPath, req.OutputPath, req.Password, progressCb)
 		}
-		decryptErr = cmd.DecryptWithPassphrase(req.InputPath, req.OutputPath, req.Password, progressCb)
-	}
+		ai.AddOperation("decrypt", req.InputPath, req.OutputPath, getMethodName(req.UseKey), err == nil)
+		return err
+	}, nil
+}
 
-	if decryptErr != nil {
-		ai.AddOperation("decrypt", req.InputPath, req.OutputPath, getMethodName(req.UseKey), false)
-		sendError(w, fmt.Sprintf("Decryption failed: %v", decryptErr), http.StatusInternalServerError)
+// runJob runs a task in the job pool and responds once it has finished,
+// as /encrypt and /decrypt always did. The job is cancelled if the client
+// goes away.
+func (s *Server) runJob(w http.ResponseWriter, r *http.Request, typ, outputPath string, run jobFunc) {
+	j, err := s.jobs.submit(typ, outputPath, run)
+	if err != nil {
+		sendError(w, err.Error(), http.StatusServiceUnavailable)
 		return
 	}
+	info := s.jobs.wait(r.Context(), j)
 
-	// Save to history
-	ai.AddOperation("decrypt", req.InputPath, req.OutputPath, getMethodName(req.UseKey), true)
-
-	sendSuccess(w, "Decryption completed successfully", map[string]interface{}{
-		"outputPath": req.OutputPath,
-	})
+	action := "Encryption"
+	if typ == "decrypt" {
+		action = "Decryption"
+	}
+	switch info.State {
+	case JobDone:
+		sendSuccess(w, action+" completed successfully", map[string]interface{}{
+			"outputPath":  outputPath,
+			"operationId": info.ID,
+		})
+	case JobCancelled:
+		sendError(w, action+" cancelled", http.StatusInternalServerError)
+	default:
+		sendError(w, fmt.Sprintf("%s failed: %s", action, info.Error), http.StatusInternalServerError)
+	}
 }
 
 func (s *Server) handleKeygen(w http.ResponseWriter, r *http.Request) {
@@ -303,38 +337,160 @@ func (s *Server) handleInfo(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Read the info to send as JSON
-	data, err := os.ReadFile(req.FilePath)
+	h, err := cmd.ReadContainerInfo(req.FilePath)
 	if err != nil {
 		sendError(w, fmt.Sprintf("Failed to read container: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	h, err := crypto.DecodeHeaderV1(bytes.NewReader(data))
-	if err != nil {
-		sendError(w, fmt.Sprintf("Failed to decode header: %v", err), http.StatusInternalServerError)
-		return
-	}
-
-	kdfType := "Raw Key"
-	if h.KDF == 1 {
-		kdfType = "Argon2id"
+	extensions := make([]map[string]interface{}, 0, len(h.Extensions))
+	for _, ext := range h.Extensions {
+		extensions = append(extensions, map[string]interface{}{
+			"type":     ext.Type,
+			"name":     crypto.ExtensionName(ext.Type),
+			"critical": ext.Critical,
+			"size":     len(ext.Value),
+		})
 	}
 
 	info := map[string]interface{}{
-		"magic":            string(h.Magic[:]),
+		"magic":            h.Magic,
 		"version":          h.Version,
-		"kdfType":          kdfType,
+		"kdfType":          h.KDFName,
 		"argonMemory":      h.ArgonM,
 		"argonTime":        h.ArgonT,
 		"argonParallelism": h.ArgonP,
-		"size":             len(data),
-		"headerSize":       crypto.HeaderSize(),
-		"encryptedSize":    len(data) - crypto.HeaderSize(),
+		"chunkSize":        h.ChunkSize,
+		"size":             h.Size,
+		"headerSize":       h.HeaderSize,
+		"encryptedSize":    h.EncryptedSize,
+		"twoFactor":        h.HasTwoFactor,
+		"recoveryStanzas":  h.Recovery,
+		"signer":           h.Signer,
+		"extensions":       extensions,
 	}
 
 	sendSuccess(w, "Container info retrieved successfully", info)
 }
 
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ListRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	profileKey(&req.UseKey, &req.KeyFile, req.Password)
+
+	if req.InputPath == "" {
+		sendError(w, "inputPath is required", http.StatusBadRequest)
+		return
+	}
+
+	var manifest *archive.Manifest
+	var err error
+	if req.UseKey {
+		if req.KeyFile == "" {
+			sendError(w, "keyFile is required when useKey is true", http.StatusBadRequest)
+			return
+		}
+		manifest, err = cmd.ListContents(req.InputPath, req.Password, req.KeyFile, "")
+	} else {
+		if req.Password == "" {
+			sendError(w, "password is required when useKey is false", http.StatusBadRequest)
+			return
+		}
+		manifest, err = cmd.ListContents(req.InputPath, req.Password, "", "")
+	}
+	if err != nil {
+		sendError(w, fmt.Sprintf("Failed to list container: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	sendSuccess(w, "Container contents listed successfully", map[string]interface{}{
+		"version":   manifest.Version,
+		"files":     manifest.Files,
+		"fileCount": len(manifest.Files),
+		"totalSize": manifest.TotalSize(),
+	})
+}
+
+func (s *Server) handleVerify(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ListRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	profileKey(&req.UseKey, &req.KeyFile, req.Password)
+
+	if req.InputPath == "" {
+		sendError(w, "inputPath is required", http.StatusBadRequest)
+		return
+	}
+
+	var result *cmd.VerifyResult
+	var err error
+	if req.UseKey {
+		if req.KeyFile == "" {
+			sendError(w, "keyFile is required when useKey is true", http.StatusBadRequest)
+			return
+		}
+		result, err = cmd.VerifyContents(req.InputPath, req.Password, req.KeyFile, "")
+	} else {
+		if req.Password == "" {
+			sendError(w, "password is required when useKey is false", http.StatusBadRequest)
+			return
+		}
+		result, err = cmd.VerifyContents(req.InputPath, req.Password, "", "")
+	}
+
+	var verr *cmd.VerifyError
+	if errors.As(err, &verr) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(Response{
+			Success: false,
+			Error:   verr.Error(),
+			Data:    map[string]interface{}{"reason": verr.Reason},
+		})
+		return
+	}
+	if err != nil {
+		sendError(w, fmt.Sprintf("Verification failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	sendSuccess(w, "Container verified successfully", result)
+}
+
+// profileKey makes a request use the active profile's key file when it
+// names no key file and, unless useKey is set, no password either.
+func profileKey(useKey *bool, keyFile *string, password string) {
+	p := cmd.ActiveProfile()
+	if p.KeyFile == "" || *keyFile != "" || (!*useKey && password != "") {
+		return
+	}
+	*useKey = true
+	*keyFile = p.KeyFile
+}
+
+func (s *Server) handleProfile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	sendSuccess(w, "Active profile", cmd.ActiveProfile())
+}
+
 func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -478,30 +634,6 @@ func analyzePasswordStrength(password string) map[string]interface{} {
 	}
 }
 
-func (s *Server) handleProgressSSE(w http.ResponseWriter, r *http.Request) {
-	// Server-Sent Events for real-time progress
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-	
-	// Keep connection open
-	flusher, ok := w.(http.Flusher)
-	if !ok {
-		sendError(w, "Streaming not supported", http.StatusInternalServerError)
-		return
-	}
-
-	// Send keep-alive
-	fmt.Fprintf(w, "data: {\"status\": \"connected\"}\n\n")
-	flusher.Flush()
-
-	// Keep alive for now
-	select {
-	case <-r.Context().Done():
-		return
-	}
-}
-
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	sendSuccess(w, "Server is healthy", map[string]interface{}{
 		"status":  "ok",
@@ -0,0 +1,283 @@
+package gui
+
+import (
+	"context"
+	"ecrypto/archive"
+	"ecrypto/cmd"
+	"ecrypto/crypto"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Headers of the /stream endpoints. Credentials travel in headers because
+// the request body is the data itself.
+const (
+	headerPassword    = "X-Ecrypto-Password"
+	headerKey         = "X-Ecrypto-Key"      // Base64(URL) 32-byte key
+	headerKeyFile     = "X-Ecrypto-Key-File" // key file on the server
+	headerFilename    = "X-Ecrypto-Filename"
+	headerOperationID = "X-Ecrypto-Operation-Id"
+)
+
+// DefaultMaxUpload is the largest container /stream/decrypt accepts unless
+// SetMaxUpload changes it.
+const DefaultMaxUpload = 64 << 30 // 64 GiB
+
+// SetMaxUpload caps the size of a container uploaded to /stream/decrypt,
+// which is spooled to disk; larger uploads get 413. 0 removes the cap.
+func (s *Server) SetMaxUpload(n int64) {
+	s.maxUpload = n
+}
+
+// streamCredentials reads the passphrase and key of a /stream request.
+// Giving both selects two-factor protection.
+func streamCredentials(r *http.Request) (cmd.Credentials, error) {
+	cr := cmd.Credentials{Passphrase: r.Header.Get(headerPassword)}
+	var err error
+	switch {
+	case r.Header.Get(headerKey) != "":
+		if cr.Key, err = crypto.ParseKey(r.Header.Get(headerKey)); err != nil {
+			return cr, fmt.Errorf("invalid %s: %v", headerKey, err)
+		}
+	case r.Header.Get(headerKeyFile) != "":
+		if cr.Key, err = crypto.ReadKeyFromFile(r.Header.Get(headerKeyFile)); err != nil {
+			return cr, fmt.Errorf("invalid %s: %v", headerKeyFile, err)
+		}
+	}
+	if cr.Passphrase == "" && cr.Key == nil {
+		return cr, fmt.Errorf("%s, %s or %s is required", headerPassword, headerKey, headerKeyFile)
+	}
+	return cr, nil
+}
+
+// streamName returns the base name given in the X-Ecrypto-Filename header,
+// or fallback.
+func streamName(r *http.Request, fallback string) string {
+	name := path.Base(strings.ReplaceAll(r.Header.Get(headerFilename), `\`, "/"))
+	if name == "." || name == "/" {
+		return fallback
+	}
+	return name
+}
+
+// attachment returns a Content-Disposition value offering the response as
+// a download named name.
+func attachment(name string) string {
+	return mime.FormatMediaType("attachment", map[string]string{"filename": name})
+}
+
+// streamResponse holds back the response headers until the first write,
+// so that a job failing before it produces output still gets an error
+// status.
+type streamResponse struct {
+	w       http.ResponseWriter
+	header  http.Header // sent with the first write
+	started bool
+}
+
+func (sr *streamResponse) start() {
+	if sr.started {
+		return
+	}
+	sr.started = true
+	for k, v := range sr.header {
+		sr.w.Header()[k] = v
+	}
+	sr.w.WriteHeader(http.StatusOK)
+}
+
+func (sr *streamResponse) Write(p []byte) (int, error) {
+	sr.start()
+	return sr.w.Write(p)
+}
+
+// streamJob runs a task writing the response body in the job pool, like
+// runJob. The handler waits for the job, so the task may use w and the
+// request body. Once output has started a failure can no longer change
+// the status, so the connection is aborted instead and the client sees an
+// incomplete transfer rather than a short file.
+func (s *Server) streamJob(w http.ResponseWriter, r *http.Request, typ string, run func(ctx context.Context, out *streamResponse, p *jobProgress) error) {
+	out := &streamResponse{w: w, header: make(http.Header)}
+	j, err := s.jobs.submit(typ, "", func(ctx context.Context, p *jobProgress) error {
+		out.header.Set(headerOperationID, p.j.info.ID)
+		return run(ctx, out, p)
+	})
+	if err != nil {
+		sendError(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	info := s.jobs.wait(r.Context(), j)
+
+	action := "Encryption"
+	if typ == "decrypt" {
+		action = "Decryption"
+	}
+	switch {
+	case info.State == JobDone:
+		out.start()
+	case out.started:
+		reason := info.Error
+		if reason == "" {
+			reason = string(info.State)
+		}
+		log.Printf("%s %s: %s after the response started, aborting", r.Method, r.URL.Path, reason)
+		panic(http.ErrAbortHandler)
+	case info.State == JobCancelled:
+		sendError(w, action+" cancelled", http.StatusInternalServerError)
+	default:
+		sendError(w, fmt.Sprintf("%s failed: %s", action, info.Error), http.StatusInternalServerError)
+	}
+}
+
+// handleStreamEncrypt encrypts the request body and streams the container
+// back. A multipart/form-data body is a folder upload: its file parts are
+// archived under their filenames, which may include directories. Any other
+// body is encrypted as a single file.
+func (s *Server) handleStreamEncrypt(w http.ResponseWriter, r *http.Request) {
+	cr, err := streamCredentials(r)
+	if err != nil {
+		sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The container is written while the body is still being read, which
+	// HTTP/1 handlers must opt in to.
+	if err := http.NewResponseController(w).EnableFullDuplex(); err != nil {
+		sendError(w, fmt.Sprintf("Streaming not supported: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	var fill func(w io.Writer, progress archive.ProgressFunc) error
+	name := streamName(r, "upload")
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+		mr, err := r.MultipartReader()
+		if err != nil {
+			sendError(w, "Invalid multipart body", http.StatusBadRequest)
+			return
+		}
+		fill = func(w io.Writer, progress archive.ProgressFunc) error {
+			return zipParts(w, mr, progress)
+		}
+	} else {
+		fill = func(w io.Writer, progress archive.ProgressFunc) error {
+			m := archive.NewMeter(progress)
+			m.SetPhase(archive.PhaseEncrypting)
+			if r.ContentLength > 0 {
+				m.SetTotals(1, r.ContentLength)
+			}
+			m.StartFile(name)
+			if _, err := io.Copy(w, m.Reader(r.Body)); err != nil {
+				return err
+			}
+			m.FinishFile()
+			m.SetPhase(archive.PhaseWriting)
+			return nil
+		}
+	}
+
+	// The container header goes out before the body is read. A client
+	// still waiting for "100 Continue" would then never send the body.
+	if strings.EqualFold(r.Header.Get("Expect"), "100-continue") {
+		w.WriteHeader(http.StatusContinue)
+	}
+
+	s.streamJob(w, r, "encrypt", func(ctx context.Context, out *streamResponse, p *jobProgress) error {
+		out.header.Set("Content-Type", "application/octet-stream")
+		out.header.Set("Content-Disposition", attachment(name+".ecrypt"))
+		return cmd.EncryptStream(ctx, out, cr, func(w io.Writer) error {
+			return fill(w, p.report)
+		})
+	})
+}
+
+// zipParts archives the file parts of a multipart upload. Other form
+// fields are skipped.
+func zipParts(w io.Writer, mr *multipart.Reader, progress archive.ProgressFunc) error {
+	zs := archive.NewZipStream(w, progress)
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		// part.FileName() drops the directories browsers send for folder
+		// uploads, so the parameter is read directly.
+		_, params, _ := mime.ParseMediaType(part.Header.Get("Content-Disposition"))
+		if name := params["filename"]; name != "" {
+			err = zs.Add(name, part)
+		}
+		part.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return zs.Close()
+}
+
+// handleStreamDecrypt decrypts the container in the request body and
+// streams back the plaintext of a single file, or a tar archive of a
+// folder. The upload is spooled to a temporary file, removed afterwards,
+// because the key check and the ZIP index need random access; memory use
+// does not grow with its size, and disk use is capped by SetMaxUpload.
+func (s *Server) handleStreamDecrypt(w http.ResponseWriter, r *http.Request) {
+	cr, err := streamCredentials(r)
+	if err != nil {
+		sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tooLarge := fmt.Sprintf("Container too large (limit %d bytes)", s.maxUpload)
+	body := r.Body
+	if s.maxUpload > 0 {
+		if r.ContentLength > s.maxUpload {
+			sendError(w, tooLarge, http.StatusRequestEntityTooLarge)
+			return
+		}
+		body = http.MaxBytesReader(w, r.Body, s.maxUpload)
+	}
+
+	f, err := os.CreateTemp("", "ecrypto-stream-*.ecrypt")
+	if err != nil {
+		sendError(w, fmt.Sprintf("Cannot create temporary file: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if _, err := io.Copy(f, body); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			sendError(w, tooLarge, http.StatusRequestEntityTooLarge)
+			return
+		}
+		sendError(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	name := strings.TrimSuffix(streamName(r, "decrypted.ecrypt"), ".ecrypt")
+	s.streamJob(w, r, "decrypt", func(ctx context.Context, out *streamResponse, p *jobProgress) error {
+		pt, err := cmd.OpenStream(f, cr)
+		if err != nil {
+			return err
+		}
+		if pt.Folder() {
+			out.header.Set("Content-Type", "application/x-tar")
+			out.header.Set("Content-Disposition", attachment(name+".tar"))
+		} else {
+			out.header.Set("Content-Type", "application/octet-stream")
+			out.header.Set("Content-Disposition", attachment(name))
+			out.header.Set("Content-Length", strconv.FormatInt(pt.Size(), 10))
+		}
+		return pt.Stream(ctx, out, p.report)
+	})
+}
@@ -0,0 +1,180 @@
+package gui
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/rand"
+	"ecrypto/cmd"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"testing"
+)
+
+func TestStreamDecryptUploadLimit(t *testing.T) {
+	s, ts := newTestServer(t)
+	s.SetMaxUpload(1024)
+
+	tests := []struct {
+		name    string
+		body    io.Reader
+		chunked bool
+	}{
+		{"declared length", bytes.NewReader(make([]byte, 2048)), false},
+		{"chunked", io.MultiReader(bytes.NewReader(make([]byte, 2048))), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", ts.URL+"/stream/decrypt", tt.body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.chunked {
+				req.ContentLength = -1
+			}
+			req.Header.Set("Authorization", "Bearer "+s.Token())
+			req.Header.Set(headerPassword, "secret")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusRequestEntityTooLarge {
+				t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusRequestEntityTooLarge)
+			}
+		})
+	}
+}
+
+// streamRequest posts body to a /stream endpoint with the key header set
+// and returns the response and its body.
+func streamRequest(t *testing.T, s *Server, url, key, contentType string, body io.Reader) (*http.Response, []byte) {
+	t.Helper()
+	req, err := http.NewRequest("POST", url, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+s.Token())
+	req.Header.Set(headerKey, key)
+	req.Header.Set(headerFilename, "report")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST %s: status = %d: %s", url, resp.StatusCode, data)
+	}
+	return resp, data
+}
+
+func TestStreamRoundTripFile(t *testing.T) {
+	isolateHome(t)
+	s, ts := newTestServer(t)
+	key, err := cmd.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := make([]byte, 3*64*1024+7)
+	rand.Read(plain)
+
+	resp, container := streamRequest(t, s, ts.URL+"/stream/encrypt", key, "application/octet-stream", bytes.NewReader(plain))
+	if got := resp.Header.Get("Content-Disposition"); got != attachment("report.ecrypt") {
+		t.Errorf("encrypt Content-Disposition = %q", got)
+	}
+	if bytes.Contains(container, plain[:64]) {
+		t.Fatal("container holds plaintext")
+	}
+
+	resp, got := streamRequest(t, s, ts.URL+"/stream/decrypt", key, "", bytes.NewReader(container))
+	if ct := resp.Header.Get("Content-Type"); ct != "application/octet-stream" {
+		t.Errorf("decrypt Content-Type = %q, want application/octet-stream", ct)
+	}
+	if !bytes.Equal(got, plain) {
+		t.Errorf("decrypted %d bytes, want the %d uploaded", len(got), len(plain))
+	}
+}
+
+func TestStreamRoundTripFolder(t *testing.T) {
+	isolateHome(t)
+	s, ts := newTestServer(t)
+	key, err := cmd.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	big := make([]byte, 100*1024)
+	rand.Read(big)
+	files := map[string][]byte{
+		"notes.txt":         []byte("top level"),
+		"docs/a.txt":        []byte("alpha"),
+		"docs/images/b.bin": big,
+		"docs/images/empty": {},
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	if err := mw.WriteField("comment", "not a file"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"notes.txt", "docs/a.txt", "docs/images/b.bin", "docs/images/empty"} {
+		// CreateFormFile would drop the directories.
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Disposition", `form-data; name="files"; filename="`+name+`"`)
+		w, err := mw.CreatePart(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(files[name])
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, container := streamRequest(t, s, ts.URL+"/stream/encrypt", key, mw.FormDataContentType(), &body)
+	resp, tarball := streamRequest(t, s, ts.URL+"/stream/decrypt", key, "", bytes.NewReader(container))
+	if ct := resp.Header.Get("Content-Type"); ct != "application/x-tar" {
+		t.Errorf("decrypt Content-Type = %q, want application/x-tar", ct)
+	}
+	if got := resp.Header.Get("Content-Disposition"); got != attachment("report.tar") {
+		t.Errorf("decrypt Content-Disposition = %q", got)
+	}
+
+	tr := tar.NewReader(bytes.NewReader(tarball))
+	seen := make(map[string]bool)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, ok := files[hdr.Name]
+		if !ok || hdr.Typeflag != tar.TypeReg {
+			t.Errorf("unexpected tar entry %q (type %c)", hdr.Name, hdr.Typeflag)
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, want) {
+			t.Errorf("%s: got %d bytes, want %d", hdr.Name, len(data), len(want))
+		}
+		seen[hdr.Name] = true
+	}
+	for name := range files {
+		if !seen[name] {
+			t.Errorf("%s missing from the tar", name)
+		}
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
 )
 
 var Version = "dev"
@@ -23,16 +24,41 @@ func main() {
     // Check for --serve flag (API server mode for GUI)
     serveFlag := flag.Bool("serve", false, "Run HTTP API server for GUI")
     portFlag := flag.Int("port", 8765, "API server port")
+    profileFlag := flag.String("profile", "", "Config profile for the menu and API server")
+    tokenFileFlag := flag.String("token-file", "", "Write the API server token to this file (mode 0600) instead of printing it")
+    originFlag := flag.String("allow-origin", "", "Comma-separated browser origins allowed to call the API server")
+    maxUploadFlag := flag.Int64("max-upload", gui.DefaultMaxUpload, "Largest container the API server accepts on /stream/decrypt (bytes, 0 = unlimited)")
+    maskFlag := flag.Bool("mask-passphrase", false, "Echo an asterisk per character at menu passphrase prompts")
     flag.Parse()
 
+    if *serveFlag || flag.NArg() == 0 {
+        if err := cmd.SetProfile(*profileFlag); err != nil {
+            fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+            os.Exit(1)
+        }
+    }
+
     if *serveFlag {
-        server := gui.NewServer(*portFlag)
+        server, err := gui.NewServer(*portFlag)
+        if err != nil {
+            log.Fatal(err)
+        }
+        server.AllowOrigin(strings.Split(*originFlag, ",")...)
+        server.SetMaxUpload(*maxUploadFlag)
+        if *tokenFileFlag != "" {
+            if err := server.WriteTokenFile(*tokenFileFlag); err != nil {
+                log.Fatal(err)
+            }
+        } else {
+            fmt.Printf("API token: %s\n", server.Token())
+        }
         log.Fatal(server.Start())
         return
     }
 
-    // If no CLI args, run interactive menu
-    if len(os.Args) == 1 {
+    // If no command was given, run interactive menu
+    if flag.NArg() == 0 {
+        ui.MaskPassphrase = *maskFlag || cmd.ActiveProfile().MaskPassphrase || os.Getenv("ECRYPTO_MASK_PASSPHRASE") != ""
         if err := ui.RunInteractiveMenu(); err != nil {
             os.Exit(1)
         }
@@ -41,6 +67,6 @@ func main() {
 
     // Otherwise, use traditional CLI mode
     if err := cmd.Execute(); err != nil {
-        os.Exit(1)
+        os.Exit(cmd.ExitCode(err))
     }
 }
\ No newline at end of file
@@ -1,8 +1,8 @@
 package ui
 
 import (
-	"bufio"
 	"ecrypto/ai"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -13,7 +13,6 @@ import (
 
 // PromptUser displays a styled prompt and reads input
 func PromptUser(label string, defaultVal string) string {
-	reader := bufio.NewReader(os.Stdin)
 	prompt := label
 	if defaultVal != "" {
 		prompt += fmt.Sprintf(" [%s]", defaultVal)
@@ -26,7 +25,7 @@ func PromptUser(label string, defaultVal string) string {
 		Bold(true)
 	
 	fmt.Print(inlineStyle.Render("› " + prompt))
-	input, _ := reader.ReadString('\n')
+	input, _ := stdin.ReadString('\n')
 	input = strings.TrimSpace(input)
 
 	if input == "" && defaultVal != "" {
@@ -209,7 +208,7 @@ func ClearScreen() {
 func Pause() {
 	fmt.Println()
 	fmt.Print(HelpStyle.Render("Press Enter to continue..."))
-	bufio.NewReader(os.Stdin).ReadString('\n')
+	stdin.ReadString('\n')
 	fmt.Println()
 }
 
@@ -226,7 +225,6 @@ func parseChoice(input string, maxOptions int) (int, error) {
 
 // PromptPassphrase securely prompts for passphrase (no echo)
 func PromptPassphrase(label string) string {
-	reader := bufio.NewReader(os.Stdin)
 	inlineStyle := lipgloss.NewStyle().
 		Foreground(ColorSecondary).
 		Bold(true)
@@ -239,41 +237,76 @@ func PromptPassphrase(label string) string {
 	}
 	
 	fmt.Print(inlineStyle.Render(label + ": "))
-	pass, _ := reader.ReadString('\n')
-	pass = strings.TrimSpace(pass)
+	pass, err := readPassphrase(MaskPassphrase)
+	if err != nil {
+		return ""
+	}
 	
 	// Analyze password strength and show suggestions
 	if pass != "" {
-		strength, suggestions, score := ai.AnalyzePasswordStrength(pass)
-		
-		// Color code based on strength
-		var strengthColor lipgloss.Color
-		switch strength {
-		case "Strong":
-			strengthColor = ColorSuccess
-		case "Medium":
-			strengthColor = ColorWarning
-		case "Weak", "Very Weak":
-			strengthColor = ColorError
-		default:
-			strengthColor = ColorDark
+		showPassphraseStrength(pass)
+	}
+	
+	return pass
+}
+
+// PromptNewPassphrase prompts for a new passphrase and asks for it again,
+// so a typo can't make a backup unrecoverable. Mismatches are rejected and
+// the user gets up to three attempts.
+func PromptNewPassphrase(label string) (string, error) {
+	inlineStyle := lipgloss.NewStyle().
+		Foreground(ColorSecondary).
+		Bold(true)
+
+	for attempt := 0; attempt < 3; attempt++ {
+		pass := PromptPassphrase(label)
+		if pass == "" {
+			return "", errors.New("passphrase cannot be empty")
 		}
-		
-		// Show strength indicator
-		strengthStyle := lipgloss.NewStyle().Foreground(strengthColor).Bold(true)
-		fmt.Println(strengthStyle.Render(fmt.Sprintf("\n  Strength: %s (%.0f%%)", strength, score*100)))
-		
-		// Show suggestions if any
-		if len(suggestions) > 0 && strength != "Strong" {
-			fmt.Println()
-			for _, suggestion := range suggestions {
-				fmt.Println(lipgloss.NewStyle().Foreground(ColorDark).Render("  " + suggestion))
-			}
+
+		fmt.Print(inlineStyle.Render("Confirm passphrase: "))
+		confirm, err := readPassphrase(MaskPassphrase)
+		if err != nil {
+			return "", err
 		}
+		if confirm == pass {
+			return pass, nil
+		}
+		PrintError("Passphrases do not match, please try again.")
 		fmt.Println()
 	}
+	return "", errors.New("passphrases do not match")
+}
+
+// showPassphraseStrength prints a strength rating and suggestions.
+func showPassphraseStrength(pass string) {
+	strength, suggestions, score := ai.AnalyzePasswordStrength(pass)
 	
-	return pass
+	// Color code based on strength
+	var strengthColor lipgloss.Color
+	switch strength {
+	case "Strong":
+		strengthColor = ColorSuccess
+	case "Medium":
+		strengthColor = ColorWarning
+	case "Weak", "Very Weak":
+		strengthColor = ColorError
+	default:
+		strengthColor = ColorDark
+	}
+	
+	// Show strength indicator
+	strengthStyle := lipgloss.NewStyle().Foreground(strengthColor).Bold(true)
+	fmt.Println(strengthStyle.Render(fmt.Sprintf("\n  Strength: %s (%.0f%%)", strength, score*100)))
+	
+	// Show suggestions if any
+	if len(suggestions) > 0 && strength != "Strong" {
+		fmt.Println()
+		for _, suggestion := range suggestions {
+			fmt.Println(lipgloss.NewStyle().Foreground(ColorDark).Render("  " + suggestion))
+		}
+	}
+	fmt.Println()
 }
 
 // PrintBanner displays colorful banner
@@ -310,8 +343,7 @@ func ConfirmAction(msg string) bool {
 		Bold(true)
 	fmt.Println()
 	fmt.Print(inlineStyle.Render("⚠ " + msg + " (type 'yes' to confirm): "))
-	reader := bufio.NewReader(os.Stdin)
-	input, _ := reader.ReadString('\n')
+	input, _ := stdin.ReadString('\n')
 	result := strings.ToLower(strings.TrimSpace(input)) == "yes"
 	if !result {
 		fmt.Println(HelpStyle.Render("✓ Operation cancelled."))
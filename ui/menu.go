@@ -1,8 +1,11 @@
 package ui
 
 import (
+	"context"
 	"ecrypto/ai"
 	"ecrypto/cmd"
+	"ecrypto/crypto"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -159,8 +162,15 @@ func encryptInteractive() error {
 		Bold(true).
 		Render("Step 2: Choose Output Location"))
 	
-	// Use AI-powered output path suggestion
-	outFile := SelectOutputPath(inPath)
+	// Use the profile's output folder if it has one, otherwise an
+	// AI-powered output path suggestion
+	var outFile string
+	if profileOut := cmd.DefaultEncryptOutput(inPath); profileOut != "" {
+		fmt.Println(HelpStyle.Render(fmt.Sprintf("Profile default: %s", profileOut)))
+		outFile = strings.Trim(PromptUser("Output file (press Enter to use default)", profileOut), "\"")
+	} else {
+		outFile = SelectOutputPath(inPath)
+	}
 	
 	// Make absolute path
 	if !filepath.IsAbs(outFile) {
@@ -193,17 +203,24 @@ func encryptInteractive() error {
 		"💡 Passphrase (easier to remember)",
 		"🔑 Random Key (maximum security)",
 	}
+	profileKeyFile := cmd.ActiveProfile().KeyFile
+	if profileKeyFile != "" {
+		keyModeOpts = append(keyModeOpts, "📋 Profile key file ("+filepath.Base(profileKeyFile)+")")
+	}
 	keyMode := SelectOption("Security Method", keyModeOpts)
 
 	var pass, keyFile string
-	if keyMode == 0 {
+	if keyMode == 2 {
+		keyMode = 1
+		keyFile = profileKeyFile
+	} else if keyMode == 0 {
 		// Passphrase mode
 		fmt.Println()
 		fmt.Println(HelpStyle.Render("💡 Use a strong passphrase (16+ characters with symbols)"))
-		pass = PromptPassphrase("Enter passphrase")
-		confirm := PromptPassphrase("Confirm passphrase")
-		if pass != confirm {
-			PrintError("Passphrases do not match!")
+		var err error
+		pass, err = PromptNewPassphrase("Enter passphrase")
+		if err != nil {
+			PrintError(err.Error())
 			Pause()
 			return nil
 		}
@@ -285,47 +302,26 @@ func encryptInteractive() error {
 	PrintInfo("Encrypting your data...")
 	
 	// Create and start progress tracker
-	var progress *ProgressTracker
-	if fileCount > 0 {
-		progress = NewProgressTracker("Encrypting", fileCount)
-		progress.Start()
-	}
+	progress := NewProgressTracker("Encrypting", fileCount)
+	progress.Start()
 
 	var encErr error
 	if keyMode == 0 {
 		if isFolder {
-			encErr = cmd.EncryptWithPassphrase(inPath, outFile, pass, func(filename string) {
-				if progress != nil {
-					progress.Update(filename)
-				}
-			})
+			encErr = cmd.EncryptWithPassphrase(context.Background(), inPath, outFile, pass, progress.Report)
 		} else {
-			encErr = cmd.EncryptFileWithPassphrase(inPath, outFile, pass, func(filename string) {
-				if progress != nil {
-					progress.Update(filename)
-				}
-			})
+			encErr = cmd.EncryptFileWithPassphrase(context.Background(), inPath, outFile, pass, progress.Report)
 		}
 	} else {
 		if isFolder {
-			encErr = cmd.EncryptWithKeyFile(inPath, outFile, keyFile, func(filename string) {
-				if progress != nil {
-					progress.Update(filename)
-				}
-			})
+			encErr = cmd.EncryptWithKeyFile(context.Background(), inPath, outFile, keyFile, progress.Report)
 		} else {
-			encErr = cmd.EncryptFileWithKeyFile(inPath, outFile, keyFile, func(filename string) {
-				if progress != nil {
-					progress.Update(filename)
-				}
-			})
+			encErr = cmd.EncryptFileWithKeyFile(context.Background(), inPath, outFile, keyFile, progress.Report)
 		}
 	}
 	
-	if progress != nil {
-		progress.Stop()
-		fmt.Println()
-	}
+	progress.Stop()
+	fmt.Println()
 	
 	if encErr != nil {
 		PrintError(fmt.Sprintf("Encryption failed: %v", encErr))
@@ -434,7 +430,10 @@ func decryptInteractive() error {
 		Bold(true).
 		Render("Step 2: Choose Output Location"))
 	
-	defaultOutDir := filepath.Join(filepath.Dir(inFile), "restored")
+	defaultOutDir := cmd.DefaultDecryptOutput(inFile)
+	if defaultOutDir == "" {
+		defaultOutDir = filepath.Join(filepath.Dir(inFile), "restored")
+	}
 	fmt.Println(HelpStyle.Render(fmt.Sprintf("Default: %s", defaultOutDir)))
 	
 	outDir := strings.Trim(PromptUser("Output folder path (press Enter to use default)", defaultOutDir), "\"")
@@ -468,10 +467,17 @@ func decryptInteractive() error {
 		Render("Step 4: Choose Decryption Method"))
 	
 	keyModeOpts := []string{"🔐 Use Passphrase", "🔑 Use Key File"}
+	profileKeyFile := cmd.ActiveProfile().KeyFile
+	if profileKeyFile != "" {
+		keyModeOpts = append(keyModeOpts, "📋 Use Profile Key File ("+filepath.Base(profileKeyFile)+")")
+	}
 	keyMode := SelectOption("Decryption Method", keyModeOpts)
 
 	var pass, keyFile string
-	if keyMode == 0 {
+	if keyMode == 2 {
+		keyMode = 1
+		keyFile = profileKeyFile
+	} else if keyMode == 0 {
 		pass = PromptPassphrase("Enter passphrase")
 	} else {
 		keyFile = SelectFileEnhanced("Select key file")
@@ -499,22 +505,27 @@ func decryptInteractive() error {
 
 	PrintInfo("Decrypting your file...")
 	
-	stopSpinner := ShowSimpleProgress("Decrypting")
+	progress := NewProgressTracker("Decrypting", 0)
+	progress.Start()
 	
 	var decErr error
 	if keyMode == 0 {
-		decErr = cmd.DecryptWithPassphrase(inFile, outDir, pass, nil)
+		decErr = cmd.DecryptWithPassphrase(context.Background(), inFile, outDir, pass, progress.Report)
 	} else {
-		decErr = cmd.DecryptWithKeyFile(inFile, outDir, keyFile, nil)
+		decErr = cmd.DecryptWithKeyFile(context.Background(), inFile, outDir, keyFile, progress.Report)
 	}
 	
-	stopSpinner()
+	progress.Stop()
 	fmt.Println()
 	
 	if decErr != nil {
 		// Better error handling for common decryption errors
 		errMsg := decErr.Error()
-		if strings.Contains(errMsg, "authentication tag") {
+		if errors.Is(decErr, crypto.ErrWrongKey) {
+			PrintError("Wrong passphrase or key file.\n\nDouble-check your passphrase/key and try again.")
+		} else if errors.Is(decErr, crypto.ErrCorruptData) {
+			PrintError(fmt.Sprintf("The container is corrupted: %v", decErr))
+		} else if strings.Contains(errMsg, "authentication tag") {
 			PrintError("Authentication failed! This usually means:\n  • Wrong passphrase or key file\n  • File is corrupted\n\nDouble-check your passphrase/key and try again.")
 		} else {
 			PrintError(fmt.Sprintf("Decryption failed: %v", decErr))
@@ -774,9 +785,9 @@ func undoInteractive() error {
 
 	var decErr error
 	if keyMode == 0 {
-		decErr = cmd.DecryptWithPassphrase(selectedOp.OutputPath, restoreDir, pass, nil)
+		decErr = cmd.DecryptWithPassphrase(context.Background(), selectedOp.OutputPath, restoreDir, pass, nil)
 	} else {
-		decErr = cmd.DecryptWithKeyFile(selectedOp.OutputPath, restoreDir, keyFile, nil)
+		decErr = cmd.DecryptWithKeyFile(context.Background(), selectedOp.OutputPath, restoreDir, keyFile, nil)
 	}
 
 	stopSpinner()
@@ -784,7 +795,9 @@ func undoInteractive() error {
 
 	if decErr != nil {
 		errMsg := decErr.Error()
-		if strings.Contains(errMsg, "authentication tag") {
+		if errors.Is(decErr, crypto.ErrCorruptData) {
+			PrintError(fmt.Sprintf("The container is corrupted: %v", decErr))
+		} else if errors.Is(decErr, crypto.ErrWrongKey) || strings.Contains(errMsg, "authentication tag") {
 			PrintError("Authentication failed! Wrong passphrase or key file.")
 		} else {
 			PrintError(fmt.Sprintf("Restoration failed: %v", decErr))
@@ -0,0 +1,99 @@
+package ui
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// MaskPassphrase makes passphrase prompts echo an asterisk per character
+// instead of nothing. main sets it from --mask-passphrase, the profile's
+// mask_passphrase setting or ECRYPTO_MASK_PASSPHRASE.
+var MaskPassphrase bool
+
+// stdin is the one reader of all menu input. Separate buffered readers
+// would each swallow input typed or piped ahead of the prompt they serve.
+var stdin = bufio.NewReader(os.Stdin)
+
+// errInterrupted is returned when the user presses Ctrl+C at a prompt.
+var errInterrupted = errors.New("input cancelled")
+
+// readPassphrase reads one line from the terminal without echoing it,
+// optionally printing an asterisk per character. When stdin is not a
+// terminal (e.g. piped input) the line is read normally.
+func readPassphrase(mask bool) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		line, err := stdin.ReadString('\n')
+		if err != nil && line == "" {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return "", err
+	}
+	defer term.Restore(fd, state)
+
+	var buf []byte
+	for {
+		c, err := stdin.ReadByte()
+		if err != nil {
+			fmt.Print("\r\n")
+			return "", err
+		}
+		switch {
+		case c == '\r' || c == '\n':
+			fmt.Print("\r\n")
+			return string(buf), nil
+		case c == 3: // Ctrl+C
+			fmt.Print("\r\n")
+			return "", errInterrupted
+		case c == 127 || c == 8: // Backspace
+			if len(buf) > 0 {
+				_, size := utf8.DecodeLastRune(buf)
+				buf = buf[:len(buf)-size]
+				if mask {
+					fmt.Print("\b \b")
+				}
+			}
+		case c == 21: // Ctrl+U clears the line
+			if mask {
+				fmt.Print(strings.Repeat("\b \b", utf8.RuneCount(buf)))
+			}
+			buf = buf[:0]
+		case c == 27: // Skip escape sequences such as arrow keys
+			skipEscapeSequence()
+		case c < 32:
+			// Ignore other control characters
+		default:
+			buf = append(buf, c)
+			if mask && utf8.RuneStart(c) {
+				fmt.Print("*")
+			}
+		}
+	}
+}
+
+// skipEscapeSequence discards the rest of a CSI sequence after ESC.
+func skipEscapeSequence() {
+	if c, err := stdin.ReadByte(); err != nil || c != '[' {
+		return
+	}
+	for {
+		c, err := stdin.ReadByte()
+		if err != nil {
+			return
+		}
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || c == '~' {
+			return
+		}
+	}
+}
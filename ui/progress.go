@@ -1,10 +1,12 @@
 package ui
 
 import (
+	"ecrypto/archive"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/charmbracelet/lipgloss"
@@ -17,6 +19,8 @@ type ProgressTracker struct {
 	CurrentFile string
 	StartTime   time.Time
 	Operation   string
+	mu          sync.Mutex
+	progress    archive.Progress // byte-level progress from Report
 	done        chan bool
 }
 
@@ -38,15 +42,30 @@ func (p *ProgressTracker) Start() {
 
 // Update increments progress
 func (p *ProgressTracker) Update(filename string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 	p.Current++
 	p.CurrentFile = filename
 }
 
+// Report records byte-level progress. It has the signature of an
+// archive.ProgressFunc, so it can be passed to the cmd wrappers directly.
+func (p *ProgressTracker) Report(progress archive.Progress) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.progress = progress
+	p.Current = progress.FilesDone
+	if progress.FilesTotal > 0 {
+		p.Total = progress.FilesTotal
+	}
+	p.CurrentFile = progress.File
+}
+
 // Stop stops the progress display
 func (p *ProgressTracker) Stop() {
 	p.done <- true
 	time.Sleep(50 * time.Millisecond) // Let final update show
-	fmt.Print("\r" + strings.Repeat(" ", 100) + "\r") // Clear line
+	fmt.Print("\r" + strings.Repeat(" ", 160) + "\r") // Clear line
 }
 
 // animate shows animated progress
@@ -70,9 +89,17 @@ func (p *ProgressTracker) animate() {
 
 // render draws the progress bar
 func (p *ProgressTracker) render(spinner string) {
+	p.mu.Lock()
+	progress := p.progress
+	current, total, currentFile := p.Current, p.Total, p.CurrentFile
+	p.mu.Unlock()
+
 	percent := 0
-	if p.Total > 0 {
-		percent = (p.Current * 100) / p.Total
+	switch {
+	case progress.BytesTotal > 0:
+		percent = progress.Percent()
+	case total > 0:
+		percent = (current * 100) / total
 	}
 
 	// Progress bar
@@ -84,20 +111,31 @@ func (p *ProgressTracker) render(spinner string) {
 	elapsed := time.Since(p.StartTime)
 	elapsedStr := fmt.Sprintf("%02d:%02d", int(elapsed.Minutes()), int(elapsed.Seconds())%60)
 
+	// Bytes, throughput and time left, once the core API reports them
+	detail := ""
+	if progress.BytesTotal > 0 {
+		detail = fmt.Sprintf(" | %s/%s | %s/s", FormatBytes(progress.BytesDone), FormatBytes(progress.BytesTotal),
+			FormatBytes(int64(progress.Rate(elapsed))))
+		if eta, ok := progress.ETA(elapsed); ok {
+			detail += fmt.Sprintf(" | ETA %02d:%02d", int(eta.Minutes()), int(eta.Seconds())%60)
+		}
+	}
+
 	// File name truncation
-	displayFile := p.CurrentFile
+	displayFile := currentFile
 	if len(displayFile) > 40 {
 		displayFile = "..." + displayFile[len(displayFile)-37:]
 	}
 
 	// Build status line
-	status := fmt.Sprintf("%s %s [%s] %d%% (%d/%d files) | %s | %s",
+	status := fmt.Sprintf("%s %s [%s] %d%% (%d/%d files)%s | %s | %s",
 		spinner,
 		p.Operation,
 		bar,
 		percent,
-		p.Current,
-		p.Total,
+		current,
+		total,
+		detail,
 		elapsedStr,
 		displayFile,
 	)